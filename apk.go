@@ -0,0 +1,309 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// DefaultAPKDatabase is the location of the apk installed database, relative
+// to the root of the file system
+const DefaultAPKDatabase = "lib/apk/db/installed"
+
+// APKSHA1Policy determines how the SHA-1 checksums (Q1 prefix) found in the
+// apk installed database are recorded. SHA-1 is not in the hash algorithm
+// registry, so that such checksums would not pass ValidHashEntry unless
+// an implementation is registered.
+type APKSHA1Policy int
+
+const (
+	// APKSHA1Drop drops SHA-1 checksums
+	APKSHA1Drop APKSHA1Policy = iota
+
+	// APKSHA1Unknown records SHA-1 checksums with the unknown hash
+	// algorithm. They are kept in the tags, but do not take part in
+	// comparisons (e.g., in Appraise).
+	APKSHA1Unknown
+
+	// APKSHA1Registered records SHA-1 checksums with the algorithm registered
+	// under the name "sha1" (see RegisterHashAlgorithm). The import fails if
+	// no such algorithm is registered.
+	APKSHA1Registered
+)
+
+// APKOptions controls how ImportAPK reads the apk installed database
+type APKOptions struct {
+	ImportOptions
+
+	// The location of the installed database in the file system. If empty,
+	// DefaultAPKDatabase is used.
+	Database string
+
+	// The distributor of the packages, also used as package URL namespace
+	// (lower case). If empty, "Alpine" is used.
+	Vendor string
+
+	// How SHA-1 checksums are recorded. The default is APKSHA1Drop.
+	SHA1Policy APKSHA1Policy
+}
+
+// ImportAPK reads the apk installed database found in the supplied file
+// system, whose root is the root of an Alpine host (e.g., os.DirFS("/") or an
+// unpacked container image), and returns one primary tag per installed
+// package, in database order. Each tag has:
+//
+//   - a package URL as tag ID, e.g., pkg:apk/alpine/curl@7.79.1-r0?arch=x86_64;
+//   - the distributor (tag creator unless one is supplied) and the maintainer
+//     as entities;
+//   - the one-line description (T field) as summary and the origin package
+//     as product, in the software meta;
+//   - a "see-also" link to the project URL;
+//   - a "requires" link for each package listed in the dependencies,
+//     referencing the package URL with no version. Conflicts and
+//     dependencies on shared objects, commands and other virtual provides
+//     (e.g., "so:libc.musl-x86_64.so.1", "cmd:sh") are not recorded;
+//   - a payload with the installed regular files, with the checksums recorded
+//     in the database: SHA-256 checksums (Q2 prefix) are always used, SHA-1
+//     checksums (Q1 prefix) as established by the SHA1Policy option.
+func ImportAPK(fsys fs.FS, opts *APKOptions) ([]*SoftwareIdentity, error) {
+	var o APKOptions
+
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.Database == "" {
+		o.Database = DefaultAPKDatabase
+	}
+
+	if o.Vendor == "" {
+		o.Vendor = "Alpine"
+	}
+
+	sha1, err := o.sha1AlgID()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fsys.Open(o.Database)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		tags []*SoftwareIdentity
+		cur  *apkPackage
+	)
+
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+
+		p, err := cur.toPackage(o.Vendor)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", cur.line, err)
+		}
+
+		tag, err := p.toTag(fsys, &o.ImportOptions)
+		if err != nil {
+			return fmt.Errorf("package %s: %w", p.name, err)
+		}
+
+		tags = append(tags, tag)
+		cur = nil
+
+		return nil
+	}
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+
+		if line == "" {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if len(line) < 2 || line[1] != ':' {
+			return nil, fmt.Errorf("line %d: bad format: expecting <key>:<value>", n)
+		}
+
+		if cur == nil {
+			cur = &apkPackage{line: n, fields: map[byte]string{}}
+		}
+
+		if err := cur.add(line[0], line[2:], sha1); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// sha1AlgID returns the algorithm used to record SHA-1 checksums, or nil if
+// they are dropped
+func (o APKOptions) sha1AlgID() (*uint64, error) {
+	switch o.SHA1Policy {
+	case APKSHA1Drop:
+		return nil, nil
+	case APKSHA1Unknown:
+		id := UnknownHashAlg
+		return &id, nil
+	case APKSHA1Registered:
+		a, ok := LookupHashAlgorithmByName("sha1")
+		if !ok {
+			return nil, errors.New("no hash algorithm registered as sha1")
+		}
+		return &a.ID, nil
+	default:
+		return nil, fmt.Errorf("unknown SHA-1 policy %d", o.SHA1Policy)
+	}
+}
+
+// apkPackage accumulates the records of a package of the installed database
+type apkPackage struct {
+	// the line at which the package starts
+	line int
+
+	// single-valued records, indexed by key
+	fields map[byte]string
+
+	// the current directory (F record) and the installed files
+	dir   string
+	files []installedFile
+}
+
+func (a *apkPackage) add(key byte, value string, sha1 *uint64) error {
+	switch key {
+	case 'F':
+		a.dir = value
+	case 'R':
+		a.files = append(a.files, installedFile{path: path.Join("/", a.dir, value)})
+	case 'Z':
+		if len(a.files) == 0 {
+			return errors.New("checksum with no file")
+		}
+
+		h, ok, err := parseAPKChecksum(value, sha1)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			f := &a.files[len(a.files)-1]
+			f.digests = append(f.digests, h)
+		}
+	default:
+		a.fields[key] = value
+	}
+
+	return nil
+}
+
+// parseAPKChecksum decodes a checksum made of a Q1 (SHA-1) or Q2 (SHA-256)
+// prefix followed by the base64 encoded digest
+func parseAPKChecksum(v string, sha1 *uint64) (HashEntry, bool, error) {
+	if len(v) < 2 {
+		return HashEntry{}, false, fmt.Errorf("bad checksum %q", v)
+	}
+
+	var algID uint64
+
+	switch v[:2] {
+	case "Q1":
+		if sha1 == nil {
+			return HashEntry{}, false, nil
+		}
+		algID = *sha1
+	case "Q2":
+		algID = Sha256
+	default:
+		return HashEntry{}, false, fmt.Errorf("unsupported checksum %q", v)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(v[2:])
+	if err != nil {
+		return HashEntry{}, false, fmt.Errorf("bad checksum %q: %w", v, err)
+	}
+
+	var h HashEntry
+
+	if err := h.Set(algID, value); err != nil {
+		return HashEntry{}, false, fmt.Errorf("bad checksum %q: %w", v, err)
+	}
+
+	return h, true, nil
+}
+
+func (a *apkPackage) toPackage(vendor string) (*installedPackage, error) {
+	name, version := a.fields['P'], a.fields['V']
+
+	if name == "" || version == "" {
+		return nil, errors.New("missing P or V record")
+	}
+
+	p := installedPackage{
+		purl: packageURL{
+			Type:       "apk",
+			Namespace:  strings.ToLower(vendor),
+			Name:       name,
+			Version:    version,
+			Qualifiers: map[string]string{"arch": a.fields['A']},
+		},
+		name:        name,
+		version:     version,
+		summary:     a.fields['T'],
+		distributor: vendor,
+		maintainer:  entityName(a.fields['m']),
+		homepage:    a.fields['U'],
+		files:       a.files,
+	}
+
+	if origin := a.fields['o']; origin != name {
+		p.product = origin
+	}
+
+	for _, d := range strings.Fields(a.fields['D']) {
+		if strings.HasPrefix(d, "!") || strings.ContainsAny(d, ":/") {
+			continue
+		}
+
+		// drop version constraints and repository pins, e.g.,
+		// "musl>=1.2.2-r0", "curl@edge"
+		if i := strings.IndexAny(d, "<>=~@"); i >= 0 {
+			d = d[:i]
+		}
+
+		if d == "" {
+			continue
+		}
+
+		ref := p.purl.versionless()
+		ref.Name = d
+
+		p.deps = append(p.deps, dependency{href: ref.String(), use: UseRequired})
+	}
+
+	return &p, nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// a private use ID for SHA-1, which is not in the IANA registry
+const testSHA1HashAlg uint64 = 0x10002
+
+// testRegisterSHA1 registers SHA-1 for the duration of the test
+func testRegisterSHA1(t *testing.T) {
+	require.Nil(t, RegisterHashAlgorithm(HashAlgorithm{
+		ID:       testSHA1HashAlg,
+		Name:     "sha1",
+		ValueLen: sha1.Size,
+		New:      sha1.New,
+	}))
+
+	t.Cleanup(func() {
+		hashAlgs.mu.Lock()
+		defer hashAlgs.mu.Unlock()
+
+		delete(hashAlgs.byID, testSHA1HashAlg)
+		delete(hashAlgs.byName, "sha1")
+	})
+}
+
+func testSHA1(data string) []byte {
+	sum := sha1.Sum([]byte(data))
+	return sum[:]
+}
+
+func testAPKQ1(data string) string {
+	return "Q1" + base64.StdEncoding.EncodeToString(testSHA1(data))
+}
+
+func testAPKQ2(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return "Q2" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+var testAPKInstalled = `C:Q1ignoredpackagechecksum=
+P:rrdetector
+V:4.1.5-r1
+A:x86_64
+S:12345
+I:45678
+T:detects roadrunners
+U:https://acme.example/rrd
+L:MIT
+o:rrdetector-src
+m:Wile E. Coyote <wile@acme.example>
+D:musl>=1.2.2-r0 so:libc.musl-x86_64.so.1 cmd:sh /bin/sh !rrjammer librr=4.1.5-r1 anvil@edge
+F:etc
+R:rrdetector.conf
+Z:` + testAPKQ1("sensitivity=high") + `
+F:usr/bin
+R:rrdetector
+Z:` + testAPKQ2("roadrunner detector") + `
+R:rrd
+Z:` + testAPKQ1("roadrunner detector") + `
+
+P:librr
+V:4.1.5-r1
+A:x86_64
+F:usr/lib
+R:librr.so.1
+`
+
+func testAPKFS() fstest.MapFS {
+	return fstest.MapFS{
+		"lib/apk/db/installed":  {Data: []byte(testAPKInstalled)},
+		"etc/rrdetector.conf":   {Data: []byte("sensitivity=high")},
+		"usr/bin/rrd":           {Data: []byte("roadrunner detector")},
+		"usr/lib/librr.so.1":    {Data: []byte("beep")},
+		"usr/share/unowned.txt": {Data: []byte("nobody")},
+	}
+}
+
+func TestImportAPK(t *testing.T) {
+	tags, err := ImportAPK(testAPKFS(), nil)
+	require.Nil(t, err)
+	require.Len(t, tags, 2)
+
+	rrd := tags[0]
+	assert.Equal(t, "pkg:apk/alpine/rrdetector@4.1.5-r1?arch=x86_64", rrd.TagID.String())
+	assert.Equal(t, "rrdetector", rrd.SoftwareName)
+	assert.Equal(t, "4.1.5-r1", rrd.SoftwareVersion)
+
+	require.Len(t, rrd.Entities, 2)
+	assert.Equal(t, "Alpine", rrd.Entities[0].EntityName)
+	assert.Equal(t, "tagCreator distributor", rrd.Entities[0].Roles.String())
+	assert.Equal(t, "Wile E. Coyote", rrd.Entities[1].EntityName)
+	assert.Equal(t, "maintainer", rrd.Entities[1].Roles.String())
+
+	require.NotNil(t, rrd.SoftwareMetas)
+	meta := (*rrd.SoftwareMetas)[0]
+	assert.Equal(t, "detects roadrunners", meta.Summary)
+	assert.Equal(t, "rrdetector-src", meta.Product)
+
+	require.NotNil(t, rrd.Links)
+
+	var links []string
+	for _, l := range *rrd.Links {
+		use := ""
+		if l.Use != nil {
+			use = l.Use.String()
+		}
+		links = append(links, l.Rel.String()+" "+l.Href+" "+use)
+	}
+
+	assert.Equal(t, []string{
+		"see also https://acme.example/rrd ",
+		"requires pkg:apk/alpine/musl required",
+		"requires pkg:apk/alpine/librr required",
+		"requires pkg:apk/alpine/anvil required",
+	}, links)
+
+	// SHA-1 checksums are dropped: files missing from the file system are
+	// only kept if they have a SHA-256 checksum
+	files := testPayloadFiles(t, rrd)
+	require.Len(t, files, 3)
+
+	f := files["/usr/bin/rrdetector"]
+	assert.Equal(t, testSha256(t, "roadrunner detector"), f.Hash)
+	assert.Nil(t, f.Size)
+
+	for _, p := range []string{"/etc/rrdetector.conf", "/usr/bin/rrd"} {
+		assert.Nil(t, files[p].Hash, p)
+		assert.NotNil(t, files[p].Size, p)
+	}
+
+	librr := tags[1]
+	assert.Equal(t, "pkg:apk/alpine/librr@4.1.5-r1?arch=x86_64", librr.TagID.String())
+	assert.Nil(t, librr.SoftwareMetas)
+	assert.Nil(t, librr.Links)
+	assert.Contains(t, testPayloadFiles(t, librr), "/usr/lib/librr.so.1")
+}
+
+func TestImportAPK_sha1Policy(t *testing.T) {
+	creator, err := NewEntity("ACME Inventory", RoleTagCreator)
+	require.Nil(t, err)
+
+	opts := APKOptions{
+		ImportOptions: ImportOptions{HashAlgIDs: []uint64{Sha256}, TagCreator: creator},
+		Vendor:        "ACME",
+		SHA1Policy:    APKSHA1Unknown,
+	}
+
+	tags, err := ImportAPK(testAPKFS(), &opts)
+	require.Nil(t, err)
+
+	rrd := tags[0]
+	assert.Equal(t, "pkg:apk/acme/rrdetector@4.1.5-r1?arch=x86_64", rrd.TagID.String())
+	require.Len(t, rrd.Entities, 3)
+	assert.Equal(t, "ACME Inventory", rrd.Entities[0].EntityName)
+	assert.Equal(t, "distributor", rrd.Entities[1].Roles.String())
+
+	files := testPayloadFiles(t, rrd)
+
+	f := files["/etc/rrdetector.conf"]
+	assert.Equal(t, &HashEntry{HashAlgID: UnknownHashAlg, HashValue: testSHA1("sensitivity=high")}, f.Hash)
+	assert.Equal(t, HashEntries{*testSha256(t, "sensitivity=high")}, f.Hashes)
+
+	testRegisterSHA1(t)
+
+	opts.SHA1Policy = APKSHA1Registered
+
+	tags, err = ImportAPK(testAPKFS(), &opts)
+	require.Nil(t, err)
+
+	f = testPayloadFiles(t, tags[0])["/usr/bin/rrd"]
+	assert.Equal(t, &HashEntry{HashAlgID: testSHA1HashAlg, HashValue: testSHA1("roadrunner detector")}, f.Hash)
+	assert.Equal(t, HashEntries{*testSha256(t, "roadrunner detector")}, f.Hashes)
+}
+
+func TestImportAPK_ko(t *testing.T) {
+	_, err := ImportAPK(fstest.MapFS{}, nil)
+	assert.EqualError(t, err, "open lib/apk/db/installed: file does not exist")
+
+	_, err = ImportAPK(testAPKFS(), &APKOptions{SHA1Policy: APKSHA1Registered})
+	assert.EqualError(t, err, "no hash algorithm registered as sha1")
+
+	_, err = ImportAPK(testAPKFS(), &APKOptions{SHA1Policy: 42})
+	assert.EqualError(t, err, "unknown SHA-1 policy 42")
+
+	for _, tv := range []struct {
+		installed   string
+		expectedErr string
+	}{
+		{"Prrdetector", "line 1: bad format: expecting <key>:<value>"},
+		{"P:rrdetector\nZ:" + testAPKQ2("x"), "line 2: checksum with no file"},
+		{"P:rrdetector\nR:rrd\nZ:Q", `line 3: bad checksum "Q"`},
+		{"P:rrdetector\nR:rrd\nZ:X1AAAA", `line 3: unsupported checksum "X1AAAA"`},
+		{"P:rrdetector\nR:rrd\nZ:Q2!!", `line 3: bad checksum "Q2!!": illegal base64 data at input byte 0`},
+		{"P:rrdetector\nR:rrd\nZ:Q2AAAA", `line 3: bad checksum "Q2AAAA": length mismatch for hash algorithm sha-256: want 32 bytes, got 3`},
+		{"\n\nP:rrdetector\nA:x86_64\n", "line 3: missing P or V record"},
+	} {
+		fsys := fstest.MapFS{"srv/apk/installed": {Data: []byte(tv.installed)}}
+
+		_, err := ImportAPK(fsys, &APKOptions{Database: "srv/apk/installed"})
+		assert.EqualError(t, err, tv.expectedErr)
+	}
+
+	_, err = ImportAPK(testAPKFS(), &APKOptions{ImportOptions: ImportOptions{HashAlgIDs: []uint64{Sha3_256}}})
+	assert.EqualError(t, err, "package rrdetector: /etc/rrdetector.conf: no implementation available for hash algorithm sha3-256")
+}
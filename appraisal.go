@@ -0,0 +1,436 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// AppraisalStatus is the outcome of the appraisal of an Evidence against a
+// reference tag
+type AppraisalStatus string
+
+// AppraisalStatus values
+const (
+	// All the files and processes declared in the reference payload are
+	// found in the evidence, with matching size and hashes
+	AppraisalMatched AppraisalStatus = "matched"
+	// All the declared files and processes are found in the evidence, with
+	// no size or hash mismatch, but the size and hashes of some of the files
+	// could not be compared, e.g., because they use different algorithms
+	AppraisalUnverified AppraisalStatus = "unverified"
+	// Some of the declared files and processes are found in the evidence,
+	// with no size or hash mismatch, others are missing
+	AppraisalPartial AppraisalStatus = "partial"
+	// At least one of the declared files is found in the evidence with a
+	// different size or hash
+	AppraisalContradicted AppraisalStatus = "contradicted"
+	// None of the declared files and processes is found in the evidence
+	AppraisalNoMatch AppraisalStatus = "no match"
+)
+
+// ItemStatus is the outcome of the appraisal of a single reference item
+type ItemStatus string
+
+// ItemStatus values
+const (
+	// The item is found in the evidence with matching size and hashes
+	ItemMatched ItemStatus = "matched"
+	// The item is found in the evidence but neither size nor hashes could be
+	// compared, e.g., because they use different algorithms
+	ItemUnverified ItemStatus = "unverified"
+	// The item is found in the evidence with a different size or hash
+	ItemMismatched ItemStatus = "mismatched"
+	// The item is not found in the evidence
+	ItemMissing ItemStatus = "missing"
+)
+
+// AppraisalOptions controls how Appraise matches evidence and reference items
+type AppraisalOptions struct {
+	// If set, the paths of evidence and reference items are expanded and
+	// normalised using the profile before being compared, and compared
+	// ignoring case if the profile is case insensitive.
+	Profile *PathProfile
+}
+
+// FileAppraisal is the appraisal of a file declared in a reference payload
+type FileAppraisal struct {
+	// The full path of the file as declared in the reference tag
+	Path string
+
+	// Whether the file, or one of its parent directories, is a key file
+	Key bool
+
+	Status ItemStatus
+
+	// If the status is not ItemMatched, a description of the reason
+	Reason string
+
+	// The file declared in the reference tag
+	Reference *File
+
+	// The matching file in the evidence, if any. If the evidence holds more
+	// than one file with the same path, the one that determined the status.
+	Evidence *File
+}
+
+// ProcessAppraisal is the appraisal of a process declared in a reference
+// payload. Processes are matched by name.
+type ProcessAppraisal struct {
+	Name string
+
+	// Either ItemMatched or ItemMissing
+	Status ItemStatus
+
+	// The matching processes in the evidence
+	Evidence []*Process
+}
+
+// TagAppraisal is the appraisal of an Evidence against a reference tag
+type TagAppraisal struct {
+	// The reference tag
+	Tag *SoftwareIdentity
+
+	Status AppraisalStatus
+
+	// The appraisal of each file and process declared in the reference
+	// payload, in the order in which they are declared
+	Files     []FileAppraisal
+	Processes []ProcessAppraisal
+
+	// The paths of the key files that are not found in the evidence. A
+	// missing key file indicates that the software component is not
+	// installed.
+	MissingKeyFiles []string
+
+	// The paths of the evidence files found in directories declared by the
+	// reference payload that are not themselves declared
+	Unexpected []string
+}
+
+// Appraisal is the result produced by Appraise
+type Appraisal struct {
+	// One entry per reference tag, in the order in which the reference tags
+	// are supplied
+	Tags []TagAppraisal
+
+	// The paths of the evidence files that are not declared by any reference
+	// tag
+	UnknownFiles []string
+
+	// The evidence processes whose names are not declared by any reference
+	// tag
+	UnknownProcesses []Process
+}
+
+// Appraise matches the files and processes found in the supplied Evidence
+// against the payloads of the supplied reference tags. Files are matched by
+// their full path, resolved as described by ResourceCollection.Walk, and then
+// compared by size and by the hashes computed with algorithms in common.
+// Processes are matched by name.
+func Appraise(ev *Evidence, refs []*SoftwareIdentity, opts *AppraisalOptions) (*Appraisal, error) {
+	if ev == nil {
+		return nil, fmt.Errorf("no evidence to appraise")
+	}
+
+	a := appraiser{claimed: map[string]bool{}, claimedProcs: map[string]bool{}}
+
+	if opts != nil {
+		a.profile = opts.Profile
+	}
+
+	if err := a.indexEvidence(ev); err != nil {
+		return nil, err
+	}
+
+	var res Appraisal
+
+	for i, ref := range refs {
+		if ref == nil {
+			return nil, fmt.Errorf("reference tag at index %d is nil", i)
+		}
+
+		ta, err := a.appraiseTag(ref)
+		if err != nil {
+			return nil, fmt.Errorf("reference tag %q: %w", ref.TagID.String(), err)
+		}
+
+		res.Tags = append(res.Tags, *ta)
+	}
+
+	for _, k := range a.fileKeys {
+		if !a.claimed[k] {
+			res.UnknownFiles = append(res.UnknownFiles, a.files[k].path)
+		}
+	}
+
+	for _, p := range a.procs {
+		if !a.claimedProcs[p.ProcessName] {
+			res.UnknownProcesses = append(res.UnknownProcesses, *p)
+		}
+	}
+
+	return &res, nil
+}
+
+// evidenceFile holds the evidence files found at the same path, e.g., the
+// successive measurements of a file that was modified
+type evidenceFile struct {
+	path  string
+	files []*File
+}
+
+type appraiser struct {
+	profile *PathProfile
+
+	// evidence files indexed by comparison key, keys in evidence order, and
+	// keys declared by at least one reference tag
+	files    map[string]evidenceFile
+	fileKeys []string
+	claimed  map[string]bool
+
+	// evidence processes, indexed by name, and names declared by at least
+	// one reference tag
+	procs        []*Process
+	byName       map[string][]*Process
+	claimedProcs map[string]bool
+}
+
+// key returns the string used to compare the paths of evidence and reference
+// items
+func (a *appraiser) key(r ResolvedItem) (string, error) {
+	return itemKey(a.profile, r)
+}
+
+// itemKey returns the string used to compare the paths of items found in
+// different resource collections, normalised using the optional profile
+func itemKey(pp *PathProfile, r ResolvedItem) (string, error) {
+	if pp == nil {
+		return r.FullPath(), nil
+	}
+
+	p, err := pp.LocalPath(r)
+	if err != nil {
+		return "", err
+	}
+
+	if pp.CaseInsensitive {
+		p = strings.ToLower(p)
+	}
+
+	return p, nil
+}
+
+func (a *appraiser) indexEvidence(ev *Evidence) error {
+	a.files = map[string]evidenceFile{}
+	a.byName = map[string][]*Process{}
+
+	err := ev.Walk(func(r ResolvedItem) error {
+		if r.IsDir() {
+			return nil
+		}
+
+		k, err := a.key(r)
+		if err != nil {
+			return fmt.Errorf("evidence file %s: %w", r.FullPath(), err)
+		}
+
+		ef, ok := a.files[k]
+		if !ok {
+			a.fileKeys = append(a.fileKeys, k)
+			ef.path = r.FullPath()
+		}
+
+		ef.files = append(ef.files, r.File)
+		a.files[k] = ef
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if ev.Processes != nil {
+		for i := range *ev.Processes {
+			p := &(*ev.Processes)[i]
+			a.procs = append(a.procs, p)
+			a.byName[p.ProcessName] = append(a.byName[p.ProcessName], p)
+		}
+	}
+
+	return nil
+}
+
+func (a *appraiser) appraiseTag(ref *SoftwareIdentity) (*TagAppraisal, error) {
+	ta := TagAppraisal{Tag: ref}
+
+	if ref.Payload == nil {
+		ta.Status = AppraisalNoMatch
+		return &ta, nil
+	}
+
+	dirs := map[string]bool{}
+	declared := map[string]bool{}
+
+	err := ref.Payload.Walk(func(r ResolvedItem) error {
+		k, err := a.key(r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.FullPath(), err)
+		}
+
+		if r.IsDir() {
+			dirs[k] = true
+			return nil
+		}
+
+		declared[k] = true
+		a.claimed[k] = true
+
+		fa := FileAppraisal{Path: r.FullPath(), Key: r.Key, Reference: r.File}
+
+		if ef, ok := a.files[k]; ok {
+			fa.compare(ef.files)
+		} else {
+			fa.Status, fa.Reason = ItemMissing, "not found in evidence"
+			if fa.Key {
+				ta.MissingKeyFiles = append(ta.MissingKeyFiles, fa.Path)
+			}
+		}
+
+		ta.Files = append(ta.Files, fa)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if ref.Payload.Processes != nil {
+		for _, p := range *ref.Payload.Processes {
+			pa := ProcessAppraisal{Name: p.ProcessName, Status: ItemMissing}
+
+			if found := a.byName[p.ProcessName]; len(found) != 0 {
+				pa.Status, pa.Evidence = ItemMatched, found
+				a.claimedProcs[p.ProcessName] = true
+			}
+
+			ta.Processes = append(ta.Processes, pa)
+		}
+	}
+
+	for _, k := range a.fileKeys {
+		if !declared[k] && dirs[path.Dir(k)] {
+			ta.Unexpected = append(ta.Unexpected, a.files[k].path)
+		}
+	}
+
+	ta.Status = ta.status()
+
+	return &ta, nil
+}
+
+// compare compares the reference file with the evidence files found at its
+// path. All the evidence files must match: the status is that of the worst
+// comparison.
+func (fa *FileAppraisal) compare(evidence []*File) {
+	for _, ev := range evidence {
+		status, reason := compareFiles(fa.Reference, ev)
+
+		if fa.Evidence == nil || status == ItemMismatched || (status == ItemUnverified && fa.Status == ItemMatched) {
+			fa.Status, fa.Reason, fa.Evidence = status, reason, ev
+		}
+
+		if status == ItemMismatched {
+			return
+		}
+	}
+}
+
+func (ta TagAppraisal) status() AppraisalStatus {
+	var found, unverified, missing int
+
+	for _, fa := range ta.Files {
+		switch fa.Status {
+		case ItemMismatched:
+			return AppraisalContradicted
+		case ItemMissing:
+			missing++
+		case ItemUnverified:
+			found++
+			unverified++
+		default:
+			found++
+		}
+	}
+
+	for _, pa := range ta.Processes {
+		if pa.Status == ItemMissing {
+			missing++
+		} else {
+			found++
+		}
+	}
+
+	switch {
+	case found == 0:
+		return AppraisalNoMatch
+	case missing != 0:
+		return AppraisalPartial
+	case unverified != 0:
+		return AppraisalUnverified
+	default:
+		return AppraisalMatched
+	}
+}
+
+// compareFiles compares the size and the hashes of a reference and an
+// evidence file. Hashes are compared only if computed with the same
+// algorithm. A reference file with hashes is matched only if at least one of
+// them could be compared, its size being matched otherwise.
+func compareFiles(ref, ev *File) (ItemStatus, string) {
+	sizeCompared := false
+
+	if ref.Size != nil && ev.Size != nil {
+		if *ref.Size != *ev.Size {
+			return ItemMismatched, fmt.Sprintf("size mismatch: want %d, got %d", *ref.Size, *ev.Size)
+		}
+		sizeCompared = true
+	}
+
+	refHashes := ref.AllHashes()
+	evHashes := ev.AllHashes()
+	hashCompared := false
+
+	for _, want := range refHashes {
+		if want.HashAlgID == UnknownHashAlg {
+			continue
+		}
+
+		for _, got := range evHashes {
+			if got.HashAlgID != want.HashAlgID {
+				continue
+			}
+
+			if !bytes.Equal(want.HashValue, got.HashValue) {
+				return ItemMismatched, fmt.Sprintf("%s hash mismatch", want.AlgIDToString())
+			}
+
+			hashCompared = true
+		}
+	}
+
+	switch {
+	case hashCompared:
+		return ItemMatched, ""
+	case len(refHashes) != 0:
+		return ItemUnverified, "no hash in common"
+	case sizeCompared:
+		return ItemMatched, ""
+	default:
+		return ItemUnverified, "no size or hash in common"
+	}
+}
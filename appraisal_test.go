@@ -0,0 +1,233 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAppraisalEvidence(t *testing.T) *Evidence {
+	e := NewEvidence("BAD809B1-7032-43D9-8F94-BF128E5D061D")
+
+	require.Nil(t, e.CollectFiles(testFS, []string{
+		"opt/acme/bin/rrdetector",
+		"opt/acme/lib",
+	}, &PayloadOptions{Root: "/"}))
+
+	require.Nil(t, e.AddFile(File{FileSystemItem: FileSystemItem{Root: "/", Location: "tmp", FsName: "rr.log"}}))
+
+	for i, name := range []string{"rrdetector", "sshd", "rrdetector"} {
+		pid := 1000 + i
+		require.Nil(t, e.AddProcess(Process{ProcessName: name, Pid: &pid}))
+	}
+
+	return e
+}
+
+func TestAppraise(t *testing.T) {
+	acme := testTagFromFS(t, testFS, "opt/acme", &PayloadOptions{
+		Root: "/opt/acme",
+		Key:  []string{"bin/*", "etc/*"},
+	})
+	require.Nil(t, acme.Payload.AddProcess(Process{ProcessName: "rrdetector"}))
+
+	size := int64(42)
+
+	coyote, err := NewTag("com.acme.coyote", "Coyote", "1.0")
+	require.Nil(t, err)
+	coyote.Payload = NewPayload()
+	require.Nil(t, coyote.Payload.AddFile(File{
+		FileSystemItem: FileSystemItem{Root: "/", Location: "opt/coyote/bin", FsName: "coyote", Key: &key},
+		Size:           &size,
+	}))
+	require.Nil(t, coyote.Payload.AddProcess(Process{ProcessName: "coyote"}))
+
+	patched, err := NewTag("com.acme.rrd2013-patch", "ACME Roadrunner Detector patch", "4.1.6")
+	require.Nil(t, err)
+	patched.Payload = NewPayload()
+	require.Nil(t, patched.Payload.AddDirectory(Directory{
+		FileSystemItem: FileSystemItem{Root: "/", Location: "opt/acme", FsName: "lib"},
+		PathElements: &PathElements{
+			Files: &Files{
+				{FileSystemItem: FileSystemItem{FsName: "librr.so"}, Hash: testSha256(t, "patched library")},
+			},
+		},
+	}))
+
+	supplemental, err := NewTag("com.acme.rrd2013-supplemental", "ACME Roadrunner Detector", "4.1.5")
+	require.Nil(t, err)
+
+	res, err := Appraise(testAppraisalEvidence(t), []*SoftwareIdentity{acme, coyote, patched, supplemental}, nil)
+	require.Nil(t, err)
+	require.Len(t, res.Tags, 4)
+
+	ta := res.Tags[0]
+	assert.Equal(t, acme, ta.Tag)
+	assert.Equal(t, AppraisalPartial, ta.Status)
+	require.Len(t, ta.Files, 7)
+	assert.Equal(t, "/opt/acme/bin/rrdetector", ta.Files[0].Path)
+	assert.Equal(t, ItemMatched, ta.Files[0].Status)
+	assert.True(t, ta.Files[0].Key)
+	assert.NotNil(t, ta.Files[0].Evidence)
+	assert.Equal(t, ItemMissing, ta.Files[1].Status)
+	assert.Equal(t, []string{"/opt/acme/etc/rrdetector.conf"}, ta.MissingKeyFiles)
+	require.Len(t, ta.Processes, 1)
+	assert.Equal(t, ItemMatched, ta.Processes[0].Status)
+	assert.Len(t, ta.Processes[0].Evidence, 2)
+	assert.Nil(t, ta.Unexpected)
+
+	ta = res.Tags[1]
+	assert.Equal(t, AppraisalNoMatch, ta.Status)
+	assert.Equal(t, []string{"/opt/coyote/bin/coyote"}, ta.MissingKeyFiles)
+	assert.Equal(t, ItemMissing, ta.Processes[0].Status)
+
+	ta = res.Tags[2]
+	assert.Equal(t, AppraisalContradicted, ta.Status)
+	assert.Equal(t, "sha-256 hash mismatch", ta.Files[0].Reason)
+	assert.Equal(t, []string{"/opt/acme/lib/librr.a"}, ta.Unexpected)
+
+	assert.Equal(t, AppraisalNoMatch, res.Tags[3].Status)
+
+	assert.Equal(t, []string{"/tmp/rr.log"}, res.UnknownFiles)
+	require.Len(t, res.UnknownProcesses, 1)
+	assert.Equal(t, "sshd", res.UnknownProcesses[0].ProcessName)
+}
+
+func TestAppraise_matched(t *testing.T) {
+	ref := testTagFromFS(t, testFS, "opt/acme/lib", &PayloadOptions{Root: "/opt/acme/lib"})
+
+	res, err := Appraise(testAppraisalEvidence(t), []*SoftwareIdentity{ref}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, AppraisalMatched, res.Tags[0].Status)
+	assert.Nil(t, res.Tags[0].Unexpected)
+	assert.Equal(t, []string{"/opt/acme/bin/rrdetector", "/tmp/rr.log"}, res.UnknownFiles)
+	assert.Len(t, res.UnknownProcesses, 3)
+}
+
+func TestAppraise_profile(t *testing.T) {
+	size := int64(19)
+
+	e := NewEvidence("BAD809B1-7032-43D9-8F94-BF128E5D061D")
+	require.Nil(t, e.AddFile(File{
+		FileSystemItem: FileSystemItem{Root: `C:\ProgramData`, Location: `ACME\RRDetector`, FsName: "RRDETECTOR.EXE"},
+		Size:           &size,
+	}))
+
+	ref, err := NewTag("com.acme.rrd2013-ce-sp1-v4-1-5-0", "ACME Roadrunner Detector", "4.1.5")
+	require.Nil(t, err)
+	ref.Payload = NewPayload()
+	require.Nil(t, ref.Payload.AddFile(File{
+		FileSystemItem: FileSystemItem{Root: "%programdata%", Location: `acme\rrdetector`, FsName: "rrdetector.exe"},
+		Size:           &size,
+	}))
+
+	res, err := Appraise(e, []*SoftwareIdentity{ref}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, AppraisalNoMatch, res.Tags[0].Status)
+
+	opts := &AppraisalOptions{Profile: WindowsPathProfile(testWindowsVars)}
+
+	res, err = Appraise(e, []*SoftwareIdentity{ref}, opts)
+	require.Nil(t, err)
+	assert.Equal(t, AppraisalMatched, res.Tags[0].Status)
+	assert.Nil(t, res.UnknownFiles)
+
+	ref.Payload.Files = &Files{{FileSystemItem: FileSystemItem{Root: "%temp%", FsName: "rr.log"}}}
+
+	_, err = Appraise(e, []*SoftwareIdentity{ref}, opts)
+	assert.EqualError(t, err, `reference tag "com.acme.rrd2013-ce-sp1-v4-1-5-0": %temp%/rr.log: undefined variable "temp"`)
+
+	require.Nil(t, e.AddFile(File{FileSystemItem: FileSystemItem{Root: "%windir%", FsName: "notepad.exe"}}))
+
+	_, err = Appraise(e, nil, opts)
+	assert.EqualError(t, err, `evidence file %windir%/notepad.exe: undefined variable "windir"`)
+}
+
+func TestAppraise_unverified(t *testing.T) {
+	sha256 := testSha256(t, "roadrunner detector")
+
+	ref, err := NewTag("com.acme.rrd2013-ce-sp1-v4-1-5-0", "ACME Roadrunner Detector", "4.1.5")
+	require.Nil(t, err)
+	ref.Payload = NewPayload()
+	require.Nil(t, ref.Payload.AddFile(File{
+		FileSystemItem: FileSystemItem{Root: "/opt/acme/bin", FsName: "rrdetector"},
+		Hash:           sha256,
+	}))
+
+	// e.g., a SHA-1 IMA measurement
+	e := NewEvidence("BAD809B1-7032-43D9-8F94-BF128E5D061D")
+	require.Nil(t, e.AddFile(File{
+		FileSystemItem: FileSystemItem{Root: "/opt/acme/bin", FsName: "rrdetector"},
+		Hash:           &HashEntry{HashAlgID: UnknownHashAlg, HashValue: make([]byte, 20)},
+	}))
+
+	res, err := Appraise(e, []*SoftwareIdentity{ref}, nil)
+	require.Nil(t, err)
+
+	ta := res.Tags[0]
+	assert.Equal(t, AppraisalUnverified, ta.Status)
+	assert.Equal(t, ItemUnverified, ta.Files[0].Status)
+
+	// missing files take precedence
+	require.Nil(t, ref.Payload.AddFile(File{
+		FileSystemItem: FileSystemItem{Root: "/opt/acme/bin", FsName: "rrctl"},
+		Hash:           sha256,
+	}))
+
+	res, err = Appraise(e, []*SoftwareIdentity{ref}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, AppraisalPartial, res.Tags[0].Status)
+}
+
+func TestAppraise_ko(t *testing.T) {
+	_, err := Appraise(nil, nil, nil)
+	assert.EqualError(t, err, "no evidence to appraise")
+
+	_, err = Appraise(NewEvidence(""), []*SoftwareIdentity{nil}, nil)
+	assert.EqualError(t, err, "reference tag at index 0 is nil")
+}
+
+func TestCompareFiles(t *testing.T) {
+	small, large := int64(1), int64(2)
+
+	sha256 := testSha256(t, "roadrunner detector")
+	sha512, err := ComputeHashEntry(Sha512, strings.NewReader("roadrunner detector"))
+	require.Nil(t, err)
+
+	for _, tv := range []struct {
+		Ref, Ev        File
+		ExpectedStatus ItemStatus
+		ExpectedReason string
+	}{
+		{File{Size: &small}, File{Size: &large}, ItemMismatched, "size mismatch: want 1, got 2"},
+		{File{Size: &small}, File{Size: &small}, ItemMatched, ""},
+		{File{Hash: sha256}, File{Hash: &sha512}, ItemUnverified, "no hash in common"},
+		{File{}, File{Hash: &sha512}, ItemUnverified, "no size or hash in common"},
+		{
+			File{Hash: &HashEntry{HashAlgID: UnknownHashAlg, HashValue: sha256.HashValue}},
+			File{Hash: sha256},
+			ItemUnverified, "no hash in common",
+		},
+		// a replaced file of the same size is not matched on size alone
+		{File{Size: &small, Hash: sha256}, File{Size: &small, Hash: &sha512}, ItemUnverified, "no hash in common"},
+		{
+			File{Size: &small, Hash: &HashEntry{HashAlgID: UnknownHashAlg, HashValue: sha256.HashValue}},
+			File{Size: &small},
+			ItemUnverified, "no hash in common",
+		},
+		{
+			File{Hash: sha256, FileExtension: FileExtension{Hashes: HashEntries{sha512}}},
+			File{Hash: &sha512},
+			ItemMatched, "",
+		},
+	} {
+		status, reason := compareFiles(&tv.Ref, &tv.Ev)
+		assert.Equal(t, tv.ExpectedStatus, status)
+		assert.Equal(t, tv.ExpectedReason, reason)
+	}
+}
@@ -0,0 +1,409 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// Decompressor returns a reader decompressing the content read from r
+type Decompressor func(r io.Reader) (io.Reader, error)
+
+// DebMediaType is the media type of Debian binary packages
+const DebMediaType = "application/vnd.debian.binary-package"
+
+// DebOptions controls how NewCorpusTagFromDeb reads a Debian binary package
+type DebOptions struct {
+	// The algorithms in HashAlgIDs are used to hash the shipped files and
+	// the package itself. If none is supplied, SHA-256 is used.
+	ImportOptions
+
+	// The distributor of the package if the control file has no Origin
+	// field, also used as package URL namespace (lower case). If empty,
+	// "Debian" is used.
+	Vendor string
+
+	// The name of the package file, recorded as artifact of the
+	// installation media link. If empty, the canonical file name
+	// <name>_<version>_<arch>.deb is used, with no epoch in the version.
+	Artifact string
+
+	// The URI of the package file, recorded as href of the installation
+	// media link. If empty, the artifact is used.
+	Href string
+
+	// Decompressors for the control and data members, indexed by file name
+	// extension (e.g., "zst" for data.tar.zst). They complement the
+	// built-in support for uncompressed, gzip, bzip2 and xz members, which
+	// they can override.
+	Decompressors map[string]Decompressor
+}
+
+var debDecompressors = map[string]Decompressor{
+	"": func(r io.Reader) (io.Reader, error) { return r, nil },
+	"gz": func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	},
+	"bz2": func(r io.Reader) (io.Reader, error) {
+		return bzip2.NewReader(r), nil
+	},
+	"xz": func(r io.Reader) (io.Reader, error) {
+		return xz.NewReader(r)
+	},
+}
+
+// NewCorpusTagFromDeb reads a Debian binary package (.deb) from r, without
+// extracting it, and returns a corpus tag describing it. The tag has the same
+// identity, entities, software meta and "requires" links as the tags created
+// by ImportDpkg for an installed package, and:
+//
+//   - a payload listing the regular files shipped in the data member, placed
+//     under the "/" root, with their size and hashes;
+//   - an "installation-media" link to the package file, carrying the hashes
+//     of the package in the Hashes extension.
+//
+// The package is read in a single pass: r does not need to support seeking.
+func NewCorpusTagFromDeb(r io.Reader, opts *DebOptions) (*SoftwareIdentity, error) {
+	var o DebOptions
+
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.Vendor == "" {
+		o.Vendor = "Debian"
+	}
+
+	if len(o.HashAlgIDs) == 0 {
+		o.HashAlgIDs = []uint64{Sha256}
+	}
+
+	mh, err := newMultiHasher(o.HashAlgIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	d := debReader{opts: &o, ar: newArReader(io.TeeReader(r, mh))}
+
+	if err := d.read(); err != nil {
+		return nil, err
+	}
+
+	tag, err := d.pkg.newTag(o.TagCreator)
+	if err != nil {
+		return nil, err
+	}
+
+	tag.Corpus = true
+
+	if err := setPayload(tag, d.entries); err != nil {
+		return nil, err
+	}
+
+	hashes, err := mh.Sum()
+	if err != nil {
+		return nil, err
+	}
+
+	artifact := o.Artifact
+	if artifact == "" {
+		artifact = debFileName(d.control)
+	}
+
+	href := o.Href
+	if href == "" {
+		href = artifact
+	}
+
+	l, err := NewLink(href, *NewRel(RelInstallationMedia))
+	if err != nil {
+		return nil, err
+	}
+
+	l.Artifact = artifact
+	l.MediaType = DebMediaType
+	l.Hashes = hashes
+
+	if err := tag.AddLink(*l); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// debFileName returns the canonical file name of a binary package
+func debFileName(s controlStanza) string {
+	version := s["version"]
+	if i := strings.IndexByte(version, ':'); i >= 0 {
+		version = version[i+1:]
+	}
+
+	return s["package"] + "_" + version + "_" + s["architecture"] + ".deb"
+}
+
+type debReader struct {
+	opts *DebOptions
+	ar   *arReader
+
+	control controlStanza
+	pkg     *installedPackage
+	entries []PathEntry
+}
+
+// read reads the members of the package, which must start with debian-binary,
+// followed by the control and data members. Other members (e.g., signatures)
+// are ignored.
+func (d *debReader) read() error {
+	name, err := d.ar.Next()
+	if err != nil {
+		return err
+	}
+
+	if name != "debian-binary" {
+		return fmt.Errorf("not a Debian package: first member is %q", name)
+	}
+
+	v, err := io.ReadAll(io.LimitReader(d.ar, 16))
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if !bytes.HasPrefix(v, []byte("2.")) {
+		return fmt.Errorf("unsupported package format version %q", strings.TrimSpace(string(v)))
+	}
+
+	var data bool
+
+	for {
+		name, err := d.ar.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch {
+		case strings.HasPrefix(name, "control.tar"):
+			if err := d.member(name, d.readControl); err != nil {
+				return err
+			}
+		case strings.HasPrefix(name, "data.tar"):
+			if d.pkg == nil {
+				return errors.New("data member found before the control member")
+			}
+			if err := d.member(name, d.readData); err != nil {
+				return err
+			}
+			data = true
+		}
+	}
+
+	switch {
+	case d.pkg == nil:
+		return errors.New("no control member")
+	case !data:
+		return errors.New("no data member")
+	}
+
+	return nil
+}
+
+// member decompresses the current member according to the extension of its
+// name and passes it to fn as a tar archive
+func (d *debReader) member(name string, fn func(*tar.Reader) error) error {
+	ext := strings.TrimPrefix(strings.TrimPrefix(name, "control.tar"), "data.tar")
+	ext = strings.TrimPrefix(ext, ".")
+
+	dec, ok := d.opts.Decompressors[ext]
+	if !ok {
+		dec, ok = debDecompressors[ext]
+	}
+
+	if !ok {
+		return fmt.Errorf("%s: unsupported compression %q: no decompressor in DebOptions.Decompressors", name, ext)
+	}
+
+	r, err := dec(d.ar)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	if err := fn(tar.NewReader(r)); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (d *debReader) readControl(tr *tar.Reader) error {
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return errors.New("no control file")
+		} else if err != nil {
+			return err
+		}
+
+		if path.Clean(h.Name) != "control" {
+			continue
+		}
+
+		stanzas, err := parseControl(tr)
+		if err != nil {
+			return fmt.Errorf("control: %w", err)
+		}
+
+		if len(stanzas) != 1 {
+			return fmt.Errorf("control: expecting one stanza, got %d", len(stanzas))
+		}
+
+		d.control = stanzas[0]
+
+		d.pkg, err = newDebPackage(d.control, d.opts.Vendor)
+		if err != nil {
+			return fmt.Errorf("control: %w", err)
+		}
+
+		return nil
+	}
+}
+
+func (d *debReader) readData(tr *tar.Reader) error {
+	// hard links are given the size and hashes of their target
+	files := map[string]File{}
+
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		p := path.Join("/", h.Name)
+
+		var f File
+
+		switch h.Typeflag {
+		case tar.TypeReg:
+			hashes, err := computeHashEntries(d.opts.HashAlgIDs, tr)
+			if err != nil {
+				return fmt.Errorf("%s: %w", p, err)
+			}
+
+			size := h.Size
+			f.Size = &size
+			f.Hash = &hashes[0]
+			if len(hashes) > 1 {
+				f.Hashes = hashes[1:]
+			}
+		case tar.TypeLink:
+			target, ok := files[path.Join("/", h.Linkname)]
+			if !ok {
+				return fmt.Errorf("%s: hard link to unknown file %q", p, h.Linkname)
+			}
+			f = target
+		default:
+			continue
+		}
+
+		files[p] = f
+
+		d.entries = append(d.entries, PathEntry{Path: p, File: f})
+	}
+}
+
+// arReader reads the members of an ar archive in the common format used by
+// Debian packages
+type arReader struct {
+	r io.Reader
+
+	// unread bytes of the current member, and padding byte following it
+	remaining int64
+	pad       int64
+
+	started bool
+}
+
+const (
+	arMagic      = "!<arch>\n"
+	arHeaderSize = 60
+)
+
+func newArReader(r io.Reader) *arReader {
+	return &arReader{r: r}
+}
+
+// Next skips to the next member and returns its name. It returns io.EOF at
+// the end of the archive.
+func (a *arReader) Next() (string, error) {
+	if !a.started {
+		magic := make([]byte, len(arMagic))
+		if _, err := io.ReadFull(a.r, magic); err != nil || string(magic) != arMagic {
+			return "", errors.New("not a Debian package: bad ar magic")
+		}
+		a.started = true
+	}
+
+	if _, err := io.CopyN(io.Discard, a.r, a.remaining+a.pad); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", fmt.Errorf("truncated archive: %w", err)
+	}
+
+	h := make([]byte, arHeaderSize)
+
+	n, err := io.ReadFull(a.r, h)
+	if n == 0 && errors.Is(err, io.EOF) {
+		return "", io.EOF
+	} else if err != nil {
+		return "", fmt.Errorf("truncated member header: %w", err)
+	}
+
+	if string(h[58:60]) != "`\n" {
+		return "", errors.New("bad member header")
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(string(h[48:58])), 10, 64)
+	if err != nil || size < 0 {
+		return "", fmt.Errorf("bad member size %q", strings.TrimSpace(string(h[48:58])))
+	}
+
+	a.remaining, a.pad = size, size%2
+
+	// GNU ar terminates names with a slash
+	return strings.TrimSuffix(strings.TrimSpace(string(h[:16])), "/"), nil
+}
+
+// Read reads from the current member
+func (a *arReader) Read(p []byte) (int, error) {
+	if a.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > a.remaining {
+		p = p[:a.remaining]
+	}
+
+	n, err := a.r.Read(p)
+	a.remaining -= int64(n)
+
+	if errors.Is(err, io.EOF) && a.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
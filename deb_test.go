@@ -0,0 +1,283 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+)
+
+const testDebControl = `Package: rrdetector
+Version: 1:4.1.5-1
+Architecture: amd64
+Maintainer: Wile E. Coyote <wile@acme.example>
+Depends: libc6 (>= 2.28), librr1
+Description: detects roadrunners
+ Beep beep.
+`
+
+type testTarEntry struct {
+	name     string
+	typeflag byte
+	data     string
+	linkname string
+}
+
+func testTar(t *testing.T, entries []testTarEntry) []byte {
+	var b bytes.Buffer
+
+	tw := tar.NewWriter(&b)
+
+	for _, e := range entries {
+		h := tar.Header{Name: e.name, Typeflag: e.typeflag, Mode: 0644, Linkname: e.linkname}
+		if e.typeflag == tar.TypeReg {
+			h.Size = int64(len(e.data))
+		}
+		require.Nil(t, tw.WriteHeader(&h))
+		_, err := tw.Write([]byte(e.data))
+		require.Nil(t, err)
+	}
+
+	require.Nil(t, tw.Close())
+
+	return b.Bytes()
+}
+
+func testGzip(t *testing.T, data []byte) []byte {
+	var b bytes.Buffer
+
+	zw := gzip.NewWriter(&b)
+	_, err := zw.Write(data)
+	require.Nil(t, err)
+	require.Nil(t, zw.Close())
+
+	return b.Bytes()
+}
+
+func testXz(t *testing.T, data []byte) []byte {
+	var b bytes.Buffer
+
+	zw, err := xz.NewWriter(&b)
+	require.Nil(t, err)
+	_, err = zw.Write(data)
+	require.Nil(t, err)
+	require.Nil(t, zw.Close())
+
+	return b.Bytes()
+}
+
+type testArMember struct {
+	name string
+	data []byte
+}
+
+func testAr(members ...testArMember) []byte {
+	var b bytes.Buffer
+
+	b.WriteString(arMagic)
+
+	for _, m := range members {
+		fmt.Fprintf(&b, "%-16s%-12s%-6s%-6s%-8s%-10d`\n", m.name, "0", "0", "0", "100644", len(m.data))
+		b.Write(m.data)
+		if len(m.data)%2 != 0 {
+			b.WriteByte('\n')
+		}
+	}
+
+	return b.Bytes()
+}
+
+func testDebData(t *testing.T) []byte {
+	return testTar(t, []testTarEntry{
+		{name: "./", typeflag: tar.TypeDir},
+		{name: "./usr/bin/", typeflag: tar.TypeDir},
+		{name: "./usr/bin/rrdetector", typeflag: tar.TypeReg, data: "roadrunner detector"},
+		{name: "./usr/bin/rrd", typeflag: tar.TypeSymlink, linkname: "rrdetector"},
+		{name: "./usr/bin/rrdetector-hl", typeflag: tar.TypeLink, linkname: "./usr/bin/rrdetector"},
+		{name: "./usr/share/doc/rrdetector/README", typeflag: tar.TypeReg, data: "beep beep"},
+	})
+}
+
+func testDeb(t *testing.T) []byte {
+	control := testTar(t, []testTarEntry{
+		{name: "./", typeflag: tar.TypeDir},
+		{name: "./md5sums", typeflag: tar.TypeReg, data: "whatever"},
+		{name: "./control", typeflag: tar.TypeReg, data: testDebControl},
+	})
+
+	return testAr(
+		testArMember{"debian-binary", []byte("2.0\n")},
+		testArMember{"control.tar.gz", testGzip(t, control)},
+		testArMember{"data.tar.xz", testXz(t, testDebData(t))},
+		testArMember{"_gpgbuilder", []byte("signature")},
+	)
+}
+
+func TestNewCorpusTagFromDeb(t *testing.T) {
+	deb := testDeb(t)
+
+	tag, err := NewCorpusTagFromDeb(bytes.NewReader(deb), nil)
+	require.Nil(t, err)
+
+	assert.True(t, tag.Corpus)
+	assert.Equal(t, "pkg:deb/debian/rrdetector@1:4.1.5-1?arch=amd64", tag.TagID.String())
+	assert.Equal(t, "1:4.1.5-1", tag.SoftwareVersion)
+	require.Len(t, tag.Entities, 2)
+	assert.Equal(t, "Debian", tag.Entities[0].EntityName)
+	assert.Equal(t, "detects roadrunners", (*tag.SoftwareMetas)[0].Summary)
+
+	require.NotNil(t, tag.Links)
+	links := *tag.Links
+	require.Len(t, links, 3)
+	assert.Equal(t, "pkg:deb/debian/libc6", links[0].Href)
+	assert.Equal(t, "pkg:deb/debian/librr1", links[1].Href)
+
+	media := links[2]
+	assert.Equal(t, "installation media", media.Rel.String())
+	assert.Equal(t, "rrdetector_4.1.5-1_amd64.deb", media.Artifact)
+	assert.Equal(t, "rrdetector_4.1.5-1_amd64.deb", media.Href)
+	assert.Equal(t, DebMediaType, media.MediaType)
+
+	sum := sha256.Sum256(deb)
+	assert.Equal(t, HashEntries{{HashAlgID: Sha256, HashValue: sum[:]}}, media.Hashes)
+
+	files := map[string]*File{}
+	require.Nil(t, tag.Payload.Walk(func(r ResolvedItem) error {
+		if !r.IsDir() {
+			files[r.FullPath()] = r.File
+		}
+		return nil
+	}))
+
+	require.Len(t, files, 3)
+	assert.Equal(t, testSha256(t, "roadrunner detector"), files["/usr/bin/rrdetector"].Hash)
+	assert.Equal(t, int64(19), *files["/usr/bin/rrdetector"].Size)
+	assert.Equal(t, files["/usr/bin/rrdetector"].Hash, files["/usr/bin/rrdetector-hl"].Hash)
+	assert.Equal(t, testSha256(t, "beep beep"), files["/usr/share/doc/rrdetector/README"].Hash)
+}
+
+func TestNewCorpusTagFromDeb_options(t *testing.T) {
+	control := testTar(t, []testTarEntry{
+		{name: "control", typeflag: tar.TypeReg, data: testDebControl + "Origin: ACME\n"},
+	})
+
+	// a fake compression, standing in for zstd
+	rot := func(r io.Reader) (io.Reader, error) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		for i := range data {
+			data[i]--
+		}
+		return bytes.NewReader(data), nil
+	}
+
+	data := testDebData(t)
+	for i := range data {
+		data[i]++
+	}
+
+	deb := testAr(
+		testArMember{"debian-binary/", []byte("2.0\n")},
+		testArMember{"control.tar/", control},
+		testArMember{"data.tar.rot/", data},
+	)
+
+	tag, err := NewCorpusTagFromDeb(bytes.NewReader(deb), &DebOptions{
+		ImportOptions: ImportOptions{HashAlgIDs: []uint64{Sha256, Sha512}},
+		Artifact:      "rrd.deb",
+		Href:          "https://acme.example/pool/rrd.deb",
+		Decompressors: map[string]Decompressor{"rot": rot},
+	})
+	require.Nil(t, err)
+
+	assert.Equal(t, "pkg:deb/acme/rrdetector@1:4.1.5-1?arch=amd64", tag.TagID.String())
+
+	media := (*tag.Links)[2]
+	assert.Equal(t, "rrd.deb", media.Artifact)
+	assert.Equal(t, "https://acme.example/pool/rrd.deb", media.Href)
+	require.Len(t, media.Hashes, 2)
+	assert.Equal(t, Sha512, media.Hashes[1].HashAlgID)
+
+	require.Nil(t, tag.Payload.Walk(func(r ResolvedItem) error {
+		if !r.IsDir() {
+			assert.Equal(t, Sha256, r.File.Hash.HashAlgID)
+			require.Len(t, r.File.Hashes, 1)
+			assert.Equal(t, Sha512, r.File.Hashes[0].HashAlgID)
+		}
+		return nil
+	}))
+
+	// round trip, including the link extension
+	data, err = tag.ToCBOR()
+	require.Nil(t, err)
+
+	var decoded SoftwareIdentity
+	require.Nil(t, decoded.FromCBOR(data))
+	assert.Equal(t, media.Hashes, (*decoded.Links)[2].Hashes)
+
+	data, err = tag.ToXML()
+	require.Nil(t, err)
+
+	decoded = SoftwareIdentity{}
+	require.Nil(t, decoded.FromXML(data))
+	assert.Equal(t, media.Hashes, (*decoded.Links)[2].Hashes)
+}
+
+func TestNewCorpusTagFromDeb_ko(t *testing.T) {
+	control := testTar(t, []testTarEntry{
+		{name: "./control", typeflag: tar.TypeReg, data: testDebControl},
+	})
+	data := testDebData(t)
+
+	binary := testArMember{"debian-binary", []byte("2.0\n")}
+
+	for _, tv := range []struct {
+		deb         []byte
+		expectedErr string
+	}{
+		{[]byte("!<arch>"), "not a Debian package: bad ar magic"},
+		{testAr(testArMember{"control.tar", control}), `not a Debian package: first member is "control.tar"`},
+		{testAr(testArMember{"debian-binary", []byte("3.0\n")}), `unsupported package format version "3.0"`},
+		{testAr(binary, testArMember{"data.tar", data}), "data member found before the control member"},
+		{testAr(binary), "no control member"},
+		{testAr(binary, testArMember{"control.tar", control}), "no data member"},
+		{
+			testAr(binary, testArMember{"control.tar.zst", control}),
+			`control.tar.zst: unsupported compression "zst": no decompressor in DebOptions.Decompressors`,
+		},
+		{testAr(binary, testArMember{"control.tar.xz", control}), "control.tar.xz: xz: invalid header magic bytes"},
+		{testAr(binary, testArMember{"control.tar.gz", control}), "control.tar.gz: gzip: invalid header"},
+		{testAr(binary, testArMember{"control.tar", data}), "control.tar: no control file"},
+		{testAr(binary, testArMember{"control.tar", testTar(t, []testTarEntry{
+			{name: "control", typeflag: tar.TypeReg, data: "Package: rrdetector\n"},
+		})}), "control.tar: control: missing Package or Version field"},
+		{testAr(binary, testArMember{"control.tar", control}, testArMember{"data.tar", testTar(t, []testTarEntry{
+			{name: "./usr/bin/rrd", typeflag: tar.TypeLink, linkname: "./usr/bin/rrdetector"},
+		})}), `data.tar: /usr/bin/rrd: hard link to unknown file "./usr/bin/rrdetector"`},
+		{testAr(binary)[:len(testAr(binary))-2], "debian-binary: unexpected EOF"},
+		{testAr(binary, testArMember{"control.tar", control})[:100], "truncated member header: unexpected EOF"},
+		{testAr(binary, testArMember{"_gpgbuilder", make([]byte, 100)})[:150], "truncated archive: unexpected EOF"},
+		{append(testAr(binary), []byte("control.tar     0           0     0     100644  10        ~\n")...), "bad member header"},
+		{append(testAr(binary), []byte("control.tar     0           0     0     100644  -1        `\n")...), `bad member size "-1"`},
+	} {
+		_, err := NewCorpusTagFromDeb(bytes.NewReader(tv.deb), nil)
+		assert.EqualError(t, err, tv.expectedErr)
+	}
+
+	_, err := NewCorpusTagFromDeb(bytes.NewReader(testDeb(t)), &DebOptions{
+		ImportOptions: ImportOptions{HashAlgIDs: []uint64{Sha3_256}},
+	})
+	assert.EqualError(t, err, "no implementation available for hash algorithm sha3-256")
+}
@@ -3,6 +3,8 @@
 
 package swid
 
+import "fmt"
+
 // Directory models CoSWID directory-entry
 type Directory struct {
 	DirectoryExtension
@@ -15,3 +17,26 @@ type PathElements struct {
 	Directories *Directories `cbor:"16,keyasint,omitempty" json:"directory,omitempty" xml:"Directory,omitempty"`
 	Files       *Files       `cbor:"17,keyasint,omitempty" json:"file,omitempty" xml:"File,omitempty"`
 }
+
+func (p *PathElements) inferHashAlgIDs(a *algInferrer) {
+	if p == nil {
+		return
+	}
+
+	if p.Files != nil {
+		for i := range *p.Files {
+			f := &(*p.Files)[i]
+			where := fmt.Sprintf("file %q", f.FsName)
+			if f.Hash != nil {
+				a.infer(where, f.Hash)
+			}
+			a.inferAll(where, f.Hashes)
+		}
+	}
+
+	if p.Directories != nil {
+		for i := range *p.Directories {
+			(*p.Directories)[i].PathElements.inferHashAlgIDs(a)
+		}
+	}
+}
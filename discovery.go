@@ -0,0 +1,187 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// DiscoveryOptions controls how Discover evaluates the tags of a corpus
+type DiscoveryOptions struct {
+	// How the paths declared in the tags are mapped onto the file system
+	Verify VerifyOptions
+
+	// The identifier of the endpoint, recorded in the generated Evidence
+	DeviceID string
+
+	// The minimum confidence at which a tag is reported as installed. If
+	// nil, DefaultMinConfidence is used. Zero reports every tag with at least
+	// one verified file, and no missing or modified key file.
+	MinConfidence *float64
+}
+
+// DefaultMinConfidence is the minimum confidence at which a tag is reported as
+// installed, unless otherwise specified in the DiscoveryOptions
+const DefaultMinConfidence = 0.5
+
+func (o DiscoveryOptions) minConfidence() float64 {
+	if o.MinConfidence == nil {
+		return DefaultMinConfidence
+	}
+
+	return *o.MinConfidence
+}
+
+// Weights of an evaluated file in the confidence score
+const (
+	confidenceHash     = 1.0
+	confidenceSize     = 0.5
+	confidencePresence = 0.25
+)
+
+// DiscoveredTag reports the evaluation of a tag of the corpus
+type DiscoveredTag struct {
+	Tag *SoftwareIdentity
+
+	// Whether the software described by the tag is deemed installed: at
+	// least one evaluated file is verified, the confidence is at least the
+	// minimum, and no key file is missing or modified
+	Installed bool
+
+	// A score between 0 and 1. Each evaluated file found with matching
+	// hashes counts 1, with matching size only (including unverified files)
+	// 0.5, and found with no declared size or usable hash 0.25. Missing or modified files count 0.
+	Confidence float64
+
+	// Whether the evaluation is based on the key files only. Tags with no
+	// key files are evaluated using all their files.
+	KeyFilesOnly bool
+
+	// The outcome of the verification of the evaluated files
+	Verification *PayloadVerification
+}
+
+// Discovery is the result produced by Discover
+type Discovery struct {
+	// One entry per primary tag of the corpus, in corpus order
+	Tags []DiscoveredTag
+
+	// The files observed while evaluating the tags, with their resolved root
+	// and location, observed size and computed hashes
+	Evidence *Evidence
+}
+
+// Installed returns the tags that are deemed installed
+func (d Discovery) Installed() []*SoftwareIdentity {
+	var tags []*SoftwareIdentity
+
+	for _, dt := range d.Tags {
+		if dt.Installed {
+			tags = append(tags, dt.Tag)
+		}
+	}
+
+	return tags
+}
+
+// Discover decides which of the supplied tags describe software installed on
+// the file system fsys. As described in the CoSWID specification, the files
+// flagged as key files (or whose directories are) are used to detect the
+// software: they are checked for existence, size and hashes. Tags with no key
+// files are evaluated using all the files in their payload. Tags that are not
+// primary tags (i.e., corpus, patch and supplemental tags) and tags without a
+// payload are ignored.
+func Discover(fsys fs.FS, corpus []*SoftwareIdentity, opts *DiscoveryOptions) (*Discovery, error) {
+	var o DiscoveryOptions
+
+	if opts != nil {
+		o = *opts
+	}
+
+	d := Discovery{Evidence: NewEvidence(o.DeviceID)}
+	observed := map[string]bool{}
+
+	for _, tag := range corpus {
+		if tag == nil || tag.Corpus || tag.Patch || tag.Supplemental || tag.Payload == nil {
+			continue
+		}
+
+		dt, err := discoverTag(fsys, tag, &o)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, l := range [][]VerifiedFile{
+			dt.Verification.Verified, dt.Verification.Modified, dt.Verification.Unverified,
+		} {
+			for _, vf := range l {
+				if vf.Observed != nil && !observed[vf.Path] {
+					observed[vf.Path] = true
+					if err := d.Evidence.AddFile(*vf.Observed); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+
+		d.Tags = append(d.Tags, *dt)
+	}
+
+	return &d, nil
+}
+
+var errStopWalk = errors.New("stop walk")
+
+func hasKeyFiles(p *Payload) bool {
+	found := false
+
+	_ = p.Walk(func(r ResolvedItem) error {
+		if r.Key && !r.IsDir() {
+			found = true
+			return errStopWalk
+		}
+		return nil
+	})
+
+	return found
+}
+
+func discoverTag(fsys fs.FS, tag *SoftwareIdentity, opts *DiscoveryOptions) (*DiscoveredTag, error) {
+	dt := DiscoveredTag{Tag: tag, KeyFilesOnly: hasKeyFiles(tag.Payload)}
+
+	v := newPayloadVerifier(fsys, &opts.Verify)
+	v.keyOnly = dt.KeyFilesOnly
+
+	if err := tag.Payload.Walk(v.visit); err != nil {
+		return nil, err
+	}
+
+	dt.Verification = &v.report
+
+	var score float64
+
+	for _, l := range [][]VerifiedFile{v.report.Verified, v.report.Unverified} {
+		for _, vf := range l {
+			switch {
+			case vf.HashesChecked != 0:
+				score += confidenceHash
+			case vf.File.Size != nil:
+				score += confidenceSize
+			default:
+				score += confidencePresence
+			}
+		}
+	}
+
+	n := len(v.report.Verified) + len(v.report.Unverified) + len(v.report.Missing) + len(v.report.Modified)
+	if n != 0 {
+		dt.Confidence = score / float64(n)
+	}
+
+	dt.Installed = len(v.report.Verified) != 0 && dt.Confidence >= opts.minConfidence() &&
+		len(v.report.CriticalFailures()) == 0
+
+	return &dt, nil
+}
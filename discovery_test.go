@@ -0,0 +1,169 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testDiscoveryRoots = VerifyOptions{
+	Roots: map[string]string{
+		"/":                   ".",
+		"/opt/acme/share/doc": "opt/acme/share/doc",
+	},
+}
+
+func TestDiscover(t *testing.T) {
+	rrd := testTagFromFS(t, testFS, ".", &PayloadOptions{
+		Root: "/",
+		Key:  []string{"opt/acme/bin/*", "*.so"},
+	})
+
+	// no key files: all files are evaluated
+	docs := testTagFromFS(t, testFS, "opt/acme/share/doc", &PayloadOptions{Root: "/opt/acme/share/doc"})
+	(*docs.Payload.Files)[0].Hash = testSha256(t, "Apache-2.0")
+
+	size := int64(19)
+
+	coyote, err := NewTag("com.acme.coyote", "Coyote", "1.0")
+	require.Nil(t, err)
+	coyote.Payload = NewPayload()
+	require.Nil(t, coyote.Payload.AddDirectory(Directory{
+		FileSystemItem: FileSystemItem{Root: "/", Location: "opt", FsName: "acme", Key: &key},
+		PathElements: &PathElements{
+			Files: &Files{
+				{FileSystemItem: FileSystemItem{Location: "bin", FsName: "rrdetector"}, Size: &size},
+				{FileSystemItem: FileSystemItem{Location: "bin", FsName: "coyote"}},
+			},
+		},
+	}))
+
+	sizeOnly, err := NewTag("com.acme.rrd-lite", "ACME Roadrunner Detector Lite", "1.0")
+	require.Nil(t, err)
+	sizeOnly.Payload = NewPayload()
+	require.Nil(t, sizeOnly.Payload.AddFile(File{
+		FileSystemItem: FileSystemItem{Root: "/", Location: "opt/acme/bin", FsName: "rrdetector", Key: &key},
+		Size:           &size,
+	}))
+	require.Nil(t, sizeOnly.Payload.AddFile(File{
+		FileSystemItem: FileSystemItem{Root: "/", Location: "opt/acme/etc", FsName: "rrdetector.conf", Key: &key},
+	}))
+
+	patch := testTagFromFS(t, testFS, ".", &PayloadOptions{Root: "/"})
+	patch.Patch = true
+
+	noPayload, err := NewTag("com.acme.empty", "Empty", "1.0")
+	require.Nil(t, err)
+
+	d, err := Discover(testFS, []*SoftwareIdentity{rrd, docs, coyote, sizeOnly, patch, noPayload, nil}, &DiscoveryOptions{
+		Verify:   testDiscoveryRoots,
+		DeviceID: "BAD809B1-7032-43D9-8F94-BF128E5D061D",
+	})
+	require.Nil(t, err)
+	require.Len(t, d.Tags, 4)
+
+	dt := d.Tags[0]
+	assert.True(t, dt.Installed)
+	assert.True(t, dt.KeyFilesOnly)
+	assert.Equal(t, 1.0, dt.Confidence)
+	assert.Len(t, dt.Verification.Verified, 2)
+	assert.Nil(t, dt.Verification.Unexpected)
+
+	dt = d.Tags[1]
+	assert.False(t, dt.KeyFilesOnly)
+	assert.Equal(t, 0.5, dt.Confidence)
+	assert.True(t, dt.Installed)
+	assert.Len(t, dt.Verification.Modified, 1)
+
+	dt = d.Tags[2]
+	assert.False(t, dt.Installed)
+	assert.Equal(t, 0.25, dt.Confidence)
+	assert.Len(t, dt.Verification.Missing, 1)
+
+	dt = d.Tags[3]
+	assert.False(t, dt.Installed)
+	assert.Equal(t, (confidenceSize+confidencePresence)/2, dt.Confidence)
+
+	assert.Equal(t, []*SoftwareIdentity{rrd, docs}, d.Installed())
+
+	// each observed file is recorded once
+	ev := d.Evidence
+	assert.Equal(t, "BAD809B1-7032-43D9-8F94-BF128E5D061D", ev.DeviceID)
+	require.NotNil(t, ev.Files)
+
+	var paths []string
+	_ = ev.Walk(func(r ResolvedItem) error {
+		paths = append(paths, r.FullPath())
+		return nil
+	})
+	assert.Equal(t, []string{
+		"/opt/acme/bin/rrdetector",
+		"/opt/acme/lib/librr.so",
+		"/opt/acme/share/doc/README",
+		"/opt/acme/share/doc/LICENSE.md",
+		"/opt/acme/etc/rrdetector.conf",
+	}, paths)
+
+	f := (*ev.Files)[0]
+	assert.Equal(t, "/", f.Root)
+	assert.Equal(t, "opt/acme/bin", f.Location)
+	assert.Equal(t, size, *f.Size)
+	assert.Equal(t, testSha256(t, "roadrunner detector"), f.Hash)
+
+	// the observed LICENSE.md differs from the declared one
+	assert.Equal(t, testSha256(t, "MIT"), (*ev.Files)[3].Hash)
+
+	// the observed evidence appraises against the reference tags
+	res, err := Appraise(ev, []*SoftwareIdentity{rrd}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, AppraisalPartial, res.Tags[0].Status)
+	assert.Nil(t, res.Tags[0].MissingKeyFiles)
+}
+
+func TestDiscover_threshold(t *testing.T) {
+	docs := testTagFromFS(t, testFS, "opt/acme/share/doc", &PayloadOptions{Root: "/opt/acme/share/doc"})
+	(*docs.Payload.Files)[0].Hash = testSha256(t, "Apache-2.0")
+
+	high, zero := 0.9, 0.0
+
+	d, err := Discover(testFS, []*SoftwareIdentity{docs}, &DiscoveryOptions{
+		Verify:        testDiscoveryRoots,
+		MinConfidence: &high,
+	})
+	require.Nil(t, err)
+	assert.False(t, d.Tags[0].Installed)
+	assert.Nil(t, d.Installed())
+
+	d, err = Discover(testFS, []*SoftwareIdentity{docs}, &DiscoveryOptions{
+		Verify:        testDiscoveryRoots,
+		MinConfidence: &zero,
+	})
+	require.Nil(t, err)
+	assert.True(t, d.Tags[0].Installed)
+
+	// a tag whose files are all missing is not reported, even with no
+	// threshold
+	missing := VerifyOptions{Roots: map[string]string{"/opt/acme/share/doc": "var"}}
+
+	d, err = Discover(testFS, []*SoftwareIdentity{docs}, &DiscoveryOptions{
+		Verify:        missing,
+		MinConfidence: &zero,
+	})
+	require.Nil(t, err)
+	assert.False(t, d.Tags[0].Installed)
+
+	d, err = Discover(testFS, []*SoftwareIdentity{docs}, &DiscoveryOptions{Verify: missing})
+	require.Nil(t, err)
+	assert.Equal(t, 0.0, d.Tags[0].Confidence)
+	assert.Nil(t, d.Evidence.Files)
+
+	docs.Payload.Files = &Files{{FileSystemItem: FileSystemItem{Root: "/", Location: "../..", FsName: "x"}}}
+
+	d, err = Discover(testFS, []*SoftwareIdentity{docs}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, `path "../../x" is outside the file system`, d.Tags[0].Verification.Missing[0].Reason)
+}
@@ -0,0 +1,497 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/mail"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WheelMediaType is the media type of wheels, which are zip archives with no
+// registered media type of their own
+const WheelMediaType = "application/zip"
+
+// DistInfoOptions controls how ImportDistInfo reads the installed Python
+// distributions
+type DistInfoOptions struct {
+	ImportOptions
+
+	// The distributor of the distributions. If empty, "PyPI" is used.
+	Vendor string
+}
+
+// WheelOptions controls how NewCorpusTagFromWheel reads a Python wheel
+type WheelOptions struct {
+	// The algorithms in HashAlgIDs are used to hash the shipped files, in
+	// addition to the digests recorded in RECORD, and the wheel itself. If
+	// none is supplied, the wheel is hashed with SHA-256.
+	ImportOptions
+
+	// The distributor of the distribution. If empty, "PyPI" is used.
+	Vendor string
+
+	// The directory the wheel is installed into (e.g.,
+	// "/usr/lib/python3.9/site-packages"), under which the shipped files are
+	// placed in the payload. If empty, the files are placed under no root,
+	// with paths relative to the installation directory.
+	SitePackages string
+
+	// The name of the wheel file, recorded as artifact of the installation
+	// media link. If empty, the canonical file name
+	// <name>-<version>(-<build>)?-<python>-<abi>-<platform>.whl is
+	// rebuilt from the WHEEL file.
+	Artifact string
+
+	// The URI of the wheel file, recorded as href of the installation media
+	// link. If empty, the artifact is used.
+	Href string
+}
+
+// ImportDistInfo reads the Python distributions installed in the dir
+// directory (e.g., "usr/lib/python3.9/site-packages") of the supplied file
+// system, whose root is the root of the host, and returns one primary tag per
+// distribution, in directory order. Only distributions installed with a
+// .dist-info directory (e.g., by pip) are read: legacy .egg-info directories
+// are ignored. Each tag has:
+//
+//   - a package URL as tag ID, e.g., pkg:pypi/requests@2.26.0, with the name
+//     normalized as in PEP 503;
+//   - the distributor (tag creator unless one is supplied) and the
+//     maintainer, or the author, as entities;
+//   - the summary and the description as software meta;
+//   - a "requires" link for each distribution listed in the Requires-Dist
+//     fields, referencing the package URL with no version. Distributions
+//     only required by an extra are referenced with optional use;
+//   - a payload with the installed regular files listed in RECORD, with the
+//     size and the digest it records, if computed with a registered
+//     algorithm.
+func ImportDistInfo(fsys fs.FS, dir string, opts *DistInfoOptions) ([]*SoftwareIdentity, error) {
+	var o DistInfoOptions
+
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.Vendor == "" {
+		o.Vendor = "PyPI"
+	}
+
+	dents, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []*SoftwareIdentity
+
+	for _, d := range dents {
+		if !d.IsDir() || !strings.HasSuffix(d.Name(), ".dist-info") {
+			continue
+		}
+
+		p, err := newDistInfoPackage(fsys, path.Join(dir, d.Name()), "/"+dir, o.Vendor)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", d.Name(), err)
+		}
+
+		tag, err := p.toTag(fsys, &o.ImportOptions)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", d.Name(), err)
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// NewCorpusTagFromWheel reads a Python wheel (.whl) of the given size from r,
+// without extracting it, and returns a corpus tag describing it. The tag has
+// the same identity, entities, software meta and "requires" links as the tags
+// created by ImportDistInfo for an installed distribution, and:
+//
+//   - a payload listing the regular files of the wheel listed in RECORD, with
+//     their size and the digest it records, if computed with a registered
+//     algorithm;
+//   - an "installation-media" link to the wheel file, carrying the hashes of
+//     the wheel in the Hashes extension.
+func NewCorpusTagFromWheel(r io.ReaderAt, size int64, opts *WheelOptions) (*SoftwareIdentity, error) {
+	var o WheelOptions
+
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.Vendor == "" {
+		o.Vendor = "PyPI"
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	distInfo, err := wheelDistInfo(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := newDistInfoPackage(zr, distInfo, "", o.Vendor)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", distInfo, err)
+	}
+
+	tag, err := p.newTag(o.TagCreator)
+	if err != nil {
+		return nil, err
+	}
+
+	tag.Corpus = true
+
+	entries, err := p.pathEntries(zr, o.HashAlgIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.SitePackages != "" {
+		for i := range entries {
+			entries[i].Path = path.Join(o.SitePackages, entries[i].Path)
+		}
+	}
+
+	if err := setPayload(tag, entries); err != nil {
+		return nil, err
+	}
+
+	algIDs := o.HashAlgIDs
+	if len(algIDs) == 0 {
+		algIDs = []uint64{Sha256}
+	}
+
+	hashes, err := computeHashEntries(algIDs, io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	artifact := o.Artifact
+	if artifact == "" {
+		artifact, err = wheelFileName(zr, distInfo)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	href := o.Href
+	if href == "" {
+		href = artifact
+	}
+
+	l, err := NewLink(href, *NewRel(RelInstallationMedia))
+	if err != nil {
+		return nil, err
+	}
+
+	l.Artifact = artifact
+	l.MediaType = WheelMediaType
+	l.Hashes = hashes
+
+	if err := tag.AddLink(*l); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// wheelDistInfo returns the name of the .dist-info directory at the top of the
+// wheel
+func wheelDistInfo(fsys fs.FS) (string, error) {
+	dents, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return "", err
+	}
+
+	var found []string
+
+	for _, d := range dents {
+		if d.IsDir() && strings.HasSuffix(d.Name(), ".dist-info") {
+			found = append(found, d.Name())
+		}
+	}
+
+	if len(found) != 1 {
+		return "", fmt.Errorf("not a wheel: expecting one .dist-info directory, got %d", len(found))
+	}
+
+	return found[0], nil
+}
+
+// wheelFileName rebuilds the file name of a wheel from the name of its
+// .dist-info directory and from the tags listed in its WHEEL file
+func wheelFileName(fsys fs.FS, distInfo string) (string, error) {
+	f, err := fsys.Open(path.Join(distInfo, "WHEEL"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	msg, err := mail.ReadMessage(bufio.NewReader(io.MultiReader(f, strings.NewReader("\n"))))
+	if err != nil {
+		return "", fmt.Errorf("WHEEL: %w", err)
+	}
+
+	// compressed tag set, e.g., "cp39-cp39-manylinux_2_17_x86_64" and
+	// "cp39-cp39-manylinux2014_x86_64" give
+	// "cp39-cp39-manylinux_2_17_x86_64.manylinux2014_x86_64"
+	var (
+		components [3][]string
+		seen       [3]map[string]bool
+	)
+
+	for _, t := range msg.Header["Tag"] {
+		parts := strings.Split(strings.TrimSpace(t), "-")
+		if len(parts) != 3 {
+			return "", fmt.Errorf("WHEEL: bad tag %q", t)
+		}
+
+		for i, c := range parts {
+			if seen[i] == nil {
+				seen[i] = map[string]bool{}
+			}
+
+			if !seen[i][c] {
+				seen[i][c] = true
+				components[i] = append(components[i], c)
+			}
+		}
+	}
+
+	if components[0] == nil {
+		return "", errors.New("WHEEL: no tag")
+	}
+
+	name := []string{strings.TrimSuffix(distInfo, ".dist-info")}
+
+	if build := msg.Header.Get("Build"); build != "" {
+		name = append(name, build)
+	}
+
+	for _, c := range components {
+		name = append(name, strings.Join(c, "."))
+	}
+
+	return strings.Join(name, "-") + ".whl", nil
+}
+
+// newDistInfoPackage reads the METADATA and RECORD files of the distInfo
+// directory. The paths listed in RECORD, relative to the directory holding
+// distInfo, are placed under root.
+func newDistInfoPackage(fsys fs.FS, distInfo, root, vendor string) (*installedPackage, error) {
+	f, err := fsys.Open(path.Join(distInfo, "METADATA"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p, err := parseDistMetadata(f, vendor)
+	if err != nil {
+		return nil, fmt.Errorf("METADATA: %w", err)
+	}
+
+	p.files, err = readDistRecord(fsys, path.Join(distInfo, "RECORD"), root)
+	if err != nil {
+		return nil, fmt.Errorf("RECORD: %w", err)
+	}
+
+	return p, nil
+}
+
+// parseDistMetadata parses the core metadata of a distribution, which uses
+// the format of email headers, with the description in the body or in the
+// Description field
+func parseDistMetadata(r io.Reader, vendor string) (*installedPackage, error) {
+	// a message with no body may not end with the blank line separating the
+	// headers from the body
+	msg, err := mail.ReadMessage(bufio.NewReader(io.MultiReader(r, strings.NewReader("\n"))))
+	if err != nil {
+		return nil, err
+	}
+
+	h := msg.Header
+
+	name, version := h.Get("Name"), h.Get("Version")
+	if name == "" || version == "" {
+		return nil, errors.New("missing Name or Version field")
+	}
+
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	description := strings.TrimSpace(string(body))
+	if description == "" {
+		description = strings.TrimSpace(h.Get("Description"))
+	}
+
+	p := installedPackage{
+		purl: packageURL{
+			Type:    "pypi",
+			Name:    normalizePyPIName(name),
+			Version: version,
+		},
+		name:        name,
+		version:     version,
+		summary:     h.Get("Summary"),
+		description: description,
+		distributor: vendor,
+		homepage:    h.Get("Home-Page"),
+	}
+
+	for _, k := range []string{"Maintainer", "Author", "Maintainer-Email", "Author-Email"} {
+		if v := entityName(h.Get(k)); v != "" {
+			p.maintainer = v
+			break
+		}
+	}
+
+	if p.homepage == "" {
+		for _, u := range h["Project-Url"] {
+			if label, v, ok := strings.Cut(u, ","); ok && strings.EqualFold(strings.TrimSpace(label), "homepage") {
+				p.homepage = strings.TrimSpace(v)
+				break
+			}
+		}
+	}
+
+	for _, req := range h["Requires-Dist"] {
+		d, ok := parseRequiresDist(req)
+		if ok {
+			p.deps = append(p.deps, d)
+		}
+	}
+
+	return &p, nil
+}
+
+var pypiNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+// normalizePyPIName normalizes a distribution name as in PEP 503
+func normalizePyPIName(name string) string {
+	return strings.ToLower(pypiNameSeparators.ReplaceAllString(name, "-"))
+}
+
+// parseRequiresDist parses a requirement, e.g., "PySocks (!=1.5.7,>=1.5.6) ;
+// extra == 'socks'", into a reference to the required distribution. Version
+// constraints are dropped, and requirements only applying to an extra are
+// given optional use.
+func parseRequiresDist(req string) (dependency, bool) {
+	spec, marker, _ := strings.Cut(req, ";")
+
+	name := strings.TrimSpace(spec)
+	if i := strings.IndexAny(name, " ([<>=!~@"); i >= 0 {
+		name = name[:i]
+	}
+
+	if name == "" {
+		return dependency{}, false
+	}
+
+	use := UseRequired
+	if strings.Contains(marker, "extra") {
+		use = UseOptional
+	}
+
+	href := packageURL{Type: "pypi", Name: normalizePyPIName(name)}.String()
+
+	return dependency{href: href, use: use}, true
+}
+
+// readDistRecord reads the RECORD file of a distribution, a CSV file listing
+// the installed files with their digest and size
+func readDistRecord(fsys fs.FS, name, root string) ([]installedFile, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = 3
+
+	var files []installedFile
+
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		p := rec[0]
+		if !path.IsAbs(p) {
+			p = path.Join(root, p)
+		}
+
+		file := installedFile{path: p}
+
+		if rec[1] != "" {
+			h, ok, err := parseRecordHash(rec[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			if ok {
+				file.digests = HashEntries{h}
+			}
+		}
+
+		if rec[2] != "" {
+			size, err := strconv.ParseInt(rec[2], 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("line %d: bad size %q", line, rec[2])
+			}
+			file.size = &size
+		}
+
+		files = append(files, file)
+	}
+}
+
+// parseRecordHash decodes a RECORD hash, e.g., "sha256=<urlsafe base64
+// digest>". Digests computed with algorithms missing from the registry are
+// ignored.
+func parseRecordHash(v string) (HashEntry, bool, error) {
+	alg, digest, ok := strings.Cut(v, "=")
+	if !ok {
+		return HashEntry{}, false, fmt.Errorf("bad hash %q", v)
+	}
+
+	a, ok := lookupDigestAlg(alg)
+	if !ok {
+		return HashEntry{}, false, nil
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(digest, "="))
+	if err != nil {
+		return HashEntry{}, false, fmt.Errorf("bad hash %q: %w", v, err)
+	}
+
+	var h HashEntry
+
+	if err := h.Set(a.ID, value); err != nil {
+		return HashEntry{}, false, fmt.Errorf("bad hash %q: %w", v, err)
+	}
+
+	return h, true, nil
+}
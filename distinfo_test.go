@@ -0,0 +1,311 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecordHash(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return "sha256=" + base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+const testDistMetadata = `Metadata-Version: 2.1
+Name: RR_Detector
+Version: 4.1.5
+Summary: detects roadrunners
+Home-page: https://acme.example/rrd
+Author: Wile E. Coyote
+Author-email: wile@acme.example
+Requires-Dist: anvil (>=3.1)
+Requires-Dist: rocket-skates[turbo]>=2; python_version >= "3.6"
+Requires-Dist: PySocks!=1.5.7,>=1.5.6; extra == 'socks'
+Requires-Dist: Anvil
+
+The ACME Roadrunner Detector spots roadrunners
+from a distance.
+`
+
+var testDistRecord = `rr_detector/__init__.py,` + testRecordHash("import rrd") + `,10
+rr_detector/__pycache__/__init__.cpython-39.pyc,,
+../../../bin/rrd,` + testRecordHash("#!/usr/bin/python3") + `,18
+rr_detector-4.1.5.dist-info/METADATA,` + testRecordHash(testDistMetadata) + `,
+rr_detector-4.1.5.dist-info/RECORD,,
+`
+
+func testSitePackagesFS() fstest.MapFS {
+	return fstest.MapFS{
+		"usr/lib/python3.9/site-packages/rr_detector-4.1.5.dist-info/METADATA": {Data: []byte(testDistMetadata)},
+		"usr/lib/python3.9/site-packages/rr_detector-4.1.5.dist-info/RECORD":   {Data: []byte(testDistRecord)},
+		"usr/lib/python3.9/site-packages/rr_detector/__init__.py":              {Data: []byte("import rrd")},
+		"usr/lib/python3.9/site-packages/anvil-3.1.dist-info/METADATA": {Data: []byte(
+			"Metadata-Version: 2.1\nName: anvil\nVersion: 3.1\nMaintainer: ACME <anvils@acme.example>\n" +
+				"Description: heavy\nProject-URL: Documentation, https://acme.example/anvil/doc\n" +
+				"Project-URL: Homepage, https://acme.example/anvil"),
+		},
+		"usr/lib/python3.9/site-packages/anvil-3.1.dist-info/RECORD":   {Data: []byte("anvil.py,,\n")},
+		"usr/lib/python3.9/site-packages/anvil.py":                     {Data: []byte("DROP = True")},
+		"usr/lib/python3.9/site-packages/legacy-1.0.egg-info/PKG-INFO": {Data: []byte("Name: legacy")},
+		"usr/lib/python3.9/site-packages/README.dist-info":             {Data: []byte("not a directory")},
+	}
+}
+
+func TestImportDistInfo(t *testing.T) {
+	tags, err := ImportDistInfo(testSitePackagesFS(), "usr/lib/python3.9/site-packages", nil)
+	require.Nil(t, err)
+	require.Len(t, tags, 2)
+
+	anvil := tags[0]
+	assert.Equal(t, "pkg:pypi/anvil@3.1", anvil.TagID.String())
+	require.Len(t, anvil.Entities, 2)
+	assert.Equal(t, "PyPI", anvil.Entities[0].EntityName)
+	assert.Equal(t, "ACME", anvil.Entities[1].EntityName)
+	assert.Equal(t, "heavy", (*anvil.SoftwareMetas)[0].Description)
+	require.NotNil(t, anvil.Links)
+	assert.Equal(t, "https://acme.example/anvil", (*anvil.Links)[0].Href)
+	assert.Contains(t, testPayloadFiles(t, anvil), "/usr/lib/python3.9/site-packages/anvil.py")
+
+	rrd := tags[1]
+	assert.Equal(t, "pkg:pypi/rr-detector@4.1.5", rrd.TagID.String())
+	assert.Equal(t, "RR_Detector", rrd.SoftwareName)
+	assert.Equal(t, "4.1.5", rrd.SoftwareVersion)
+
+	require.Len(t, rrd.Entities, 2)
+	assert.Equal(t, "tagCreator distributor", rrd.Entities[0].Roles.String())
+	assert.Equal(t, "Wile E. Coyote", rrd.Entities[1].EntityName)
+	assert.Equal(t, "maintainer", rrd.Entities[1].Roles.String())
+
+	meta := (*rrd.SoftwareMetas)[0]
+	assert.Equal(t, "detects roadrunners", meta.Summary)
+	assert.Equal(t, "The ACME Roadrunner Detector spots roadrunners\nfrom a distance.", meta.Description)
+
+	var links []string
+	for _, l := range *rrd.Links {
+		use := ""
+		if l.Use != nil {
+			use = l.Use.String()
+		}
+		links = append(links, l.Rel.String()+" "+l.Href+" "+use)
+	}
+
+	assert.Equal(t, []string{
+		"see also https://acme.example/rrd ",
+		"requires pkg:pypi/anvil required",
+		"requires pkg:pypi/rocket-skates required",
+		"requires pkg:pypi/pysocks optional",
+	}, links)
+
+	files := testPayloadFiles(t, rrd)
+	require.Len(t, files, 4)
+
+	// recorded digest and size, present in the file system
+	f := files["/usr/lib/python3.9/site-packages/rr_detector/__init__.py"]
+	assert.Equal(t, testSha256(t, "import rrd"), f.Hash)
+	assert.Equal(t, int64(10), *f.Size)
+
+	// recorded digest, missing from the file system
+	f = files["/usr/bin/rrd"]
+	assert.Equal(t, testSha256(t, "#!/usr/bin/python3"), f.Hash)
+	assert.Equal(t, int64(18), *f.Size)
+
+	// no recorded digest and size: size from the file system
+	f = files["/usr/lib/python3.9/site-packages/rr_detector-4.1.5.dist-info/RECORD"]
+	assert.Nil(t, f.Hash)
+	assert.Equal(t, int64(len(testDistRecord)), *f.Size)
+
+	assert.Contains(t, files, "/usr/lib/python3.9/site-packages/rr_detector-4.1.5.dist-info/METADATA")
+}
+
+func TestImportDistInfo_ko(t *testing.T) {
+	_, err := ImportDistInfo(fstest.MapFS{}, "site-packages", nil)
+	assert.EqualError(t, err, "open site-packages: file does not exist")
+
+	for _, tv := range []struct {
+		metadata    string
+		record      string
+		expectedErr string
+	}{
+		{"", "", "rrd-1.0.dist-info: open site-packages/rrd-1.0.dist-info/METADATA: file does not exist"},
+		{"Name: rrd", "", "rrd-1.0.dist-info: METADATA: missing Name or Version field"},
+		{"Name: rrd\nVersion: 1.0", "", "rrd-1.0.dist-info: RECORD: open site-packages/rrd-1.0.dist-info/RECORD: file does not exist"},
+		{"Name: rrd\nVersion: 1.0", "rrd.py,sha256=abc\n", "rrd-1.0.dist-info: RECORD: record on line 1: wrong number of fields"},
+		{"Name: rrd\nVersion: 1.0", "rrd.py,,\nrrd.py,sha256,\n", `rrd-1.0.dist-info: RECORD: line 2: bad hash "sha256"`},
+		{"Name: rrd\nVersion: 1.0", "rrd.py,sha256=!,\n", `rrd-1.0.dist-info: RECORD: line 1: bad hash "sha256=!": illegal base64 data at input byte 0`},
+		{"Name: rrd\nVersion: 1.0", "rrd.py,sha256=AAAA,\n", `rrd-1.0.dist-info: RECORD: line 1: bad hash "sha256=AAAA": length mismatch for hash algorithm sha-256: want 32 bytes, got 3`},
+		{"Name: rrd\nVersion: 1.0", "rrd.py,,big\n", `rrd-1.0.dist-info: RECORD: line 1: bad size "big"`},
+	} {
+		fsys := fstest.MapFS{"site-packages/rrd-1.0.dist-info": {Mode: fs.ModeDir | 0755}}
+		if tv.metadata != "" {
+			fsys["site-packages/rrd-1.0.dist-info/METADATA"] = &fstest.MapFile{Data: []byte(tv.metadata)}
+		}
+		if tv.record != "" {
+			fsys["site-packages/rrd-1.0.dist-info/RECORD"] = &fstest.MapFile{Data: []byte(tv.record)}
+		}
+
+		_, err := ImportDistInfo(fsys, "site-packages", nil)
+		assert.EqualError(t, err, tv.expectedErr)
+	}
+
+	_, err = ImportDistInfo(testSitePackagesFS(), "usr/lib/python3.9/site-packages",
+		&DistInfoOptions{ImportOptions: ImportOptions{HashAlgIDs: []uint64{Sha3_256}}})
+	assert.EqualError(t, err, "anvil-3.1.dist-info: /usr/lib/python3.9/site-packages/anvil.py: no implementation available for hash algorithm sha3-256")
+}
+
+func TestParseRecordHash_unregistered(t *testing.T) {
+	_, ok, err := parseRecordHash("md5=AAAA")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	h, ok, err := parseRecordHash("sha512=" + base64.URLEncoding.EncodeToString(make([]byte, 64)))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Sha512, h.HashAlgID)
+}
+
+type testZipEntry struct {
+	name string
+	data string
+}
+
+func testZip(t *testing.T, entries ...testZipEntry) []byte {
+	var buf bytes.Buffer
+
+	w := zip.NewWriter(&buf)
+
+	for _, e := range entries {
+		f, err := w.Create(e.name)
+		require.Nil(t, err)
+		_, err = f.Write([]byte(e.data))
+		require.Nil(t, err)
+	}
+
+	require.Nil(t, w.Close())
+
+	return buf.Bytes()
+}
+
+var testWheelRecord = `rr_detector/__init__.py,` + testRecordHash("import rrd") + `,10
+rr_detector-4.1.5.data/scripts/rrd,` + testRecordHash("#!python") + `,8
+rr_detector-4.1.5.dist-info/METADATA,` + testRecordHash(testDistMetadata) + `,
+rr_detector-4.1.5.dist-info/WHEEL,,
+rr_detector-4.1.5.dist-info/RECORD,,
+`
+
+func testWheel(t *testing.T, wheel string) []byte {
+	return testZip(t,
+		testZipEntry{"rr_detector/__init__.py", "import rrd"},
+		testZipEntry{"rr_detector-4.1.5.data/scripts/rrd", "#!python"},
+		testZipEntry{"rr_detector-4.1.5.dist-info/METADATA", testDistMetadata},
+		testZipEntry{"rr_detector-4.1.5.dist-info/WHEEL", wheel},
+		testZipEntry{"rr_detector-4.1.5.dist-info/RECORD", testWheelRecord},
+	)
+}
+
+const testWheelFile = `Wheel-Version: 1.0
+Generator: bdist_wheel (0.37.0)
+Root-Is-Purelib: false
+Build: 2
+Tag: cp39-cp39-manylinux_2_17_x86_64
+Tag: cp39-cp39-manylinux2014_x86_64
+`
+
+func TestNewCorpusTagFromWheel(t *testing.T) {
+	whl := testWheel(t, testWheelFile)
+
+	tag, err := NewCorpusTagFromWheel(bytes.NewReader(whl), int64(len(whl)), nil)
+	require.Nil(t, err)
+
+	assert.True(t, tag.Corpus)
+	assert.Equal(t, "pkg:pypi/rr-detector@4.1.5", tag.TagID.String())
+
+	links := *tag.Links
+	l := links[len(links)-1]
+	assert.Equal(t, "installation media", l.Rel.String())
+	assert.Equal(t, "rr_detector-4.1.5-2-cp39-cp39-manylinux_2_17_x86_64.manylinux2014_x86_64.whl", l.Href)
+	assert.Equal(t, l.Href, l.Artifact)
+	assert.Equal(t, WheelMediaType, l.MediaType)
+
+	sum := sha256.Sum256(whl)
+	assert.Equal(t, HashEntries{{HashAlgID: Sha256, HashValue: sum[:]}}, l.Hashes)
+
+	files := testPayloadFiles(t, tag)
+	require.Len(t, files, 5)
+
+	f := files["rr_detector/__init__.py"]
+	assert.Equal(t, testSha256(t, "import rrd"), f.Hash)
+	assert.Nil(t, f.Hashes)
+	assert.Equal(t, int64(10), *f.Size)
+
+	f = files["rr_detector-4.1.5.dist-info/WHEEL"]
+	assert.Nil(t, f.Hash)
+	assert.Equal(t, int64(len(testWheelFile)), *f.Size)
+}
+
+func TestNewCorpusTagFromWheel_options(t *testing.T) {
+	whl := testWheel(t, testWheelFile)
+
+	tag, err := NewCorpusTagFromWheel(bytes.NewReader(whl), int64(len(whl)), &WheelOptions{
+		ImportOptions: ImportOptions{HashAlgIDs: []uint64{Sha384}},
+		Vendor:        "ACME",
+		SitePackages:  "/usr/lib/python3.9/site-packages",
+		Artifact:      "rrd.whl",
+		Href:          "https://acme.example/rrd.whl",
+	})
+	require.Nil(t, err)
+
+	assert.Equal(t, "ACME", tag.Entities[0].EntityName)
+
+	links := *tag.Links
+	l := links[len(links)-1]
+	assert.Equal(t, "https://acme.example/rrd.whl", l.Href)
+	assert.Equal(t, "rrd.whl", l.Artifact)
+	require.Len(t, l.Hashes, 1)
+	assert.Equal(t, Sha384, l.Hashes[0].HashAlgID)
+
+	files := testPayloadFiles(t, tag)
+
+	f := files["/usr/lib/python3.9/site-packages/rr_detector/__init__.py"]
+	require.NotNil(t, f)
+	assert.Equal(t, testSha256(t, "import rrd"), f.Hash)
+	require.Len(t, f.Hashes, 1)
+	assert.Equal(t, Sha384, f.Hashes[0].HashAlgID)
+
+	assert.Contains(t, files, "/usr/lib/python3.9/site-packages/rr_detector-4.1.5.data/scripts/rrd")
+}
+
+func TestNewCorpusTagFromWheel_ko(t *testing.T) {
+	for _, tv := range []struct {
+		whl         []byte
+		expectedErr string
+	}{
+		{[]byte("PK"), "zip: not a valid zip file"},
+		{testZip(t, testZipEntry{"rrd.py", ""}), "not a wheel: expecting one .dist-info directory, got 0"},
+		{testZip(t, testZipEntry{"rrd-1.0.dist-info/RECORD", ""}), "rrd-1.0.dist-info: open rrd-1.0.dist-info/METADATA: file does not exist"},
+		{testZip(t,
+			testZipEntry{"rrd-1.0.dist-info/METADATA", "Name: rrd\nVersion: 1.0"},
+			testZipEntry{"rrd-1.0.dist-info/RECORD", ""},
+		), "open rrd-1.0.dist-info/WHEEL: file does not exist"},
+		{testWheel(t, "Wheel-Version: 1.0"), "WHEEL: no tag"},
+		{testWheel(t, "Tag: py3-none"), `WHEEL: bad tag "py3-none"`},
+	} {
+		_, err := NewCorpusTagFromWheel(bytes.NewReader(tv.whl), int64(len(tv.whl)), nil)
+		assert.EqualError(t, err, tv.expectedErr)
+	}
+
+	opts := &WheelOptions{ImportOptions: ImportOptions{HashAlgIDs: []uint64{Sha3_256}}}
+	whl := testWheel(t, testWheelFile)
+
+	_, err := NewCorpusTagFromWheel(bytes.NewReader(whl), int64(len(whl)), opts)
+	assert.EqualError(t, err, "rr_detector/__init__.py: no implementation available for hash algorithm sha3-256")
+}
@@ -0,0 +1,384 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// DefaultDpkgAdminDir is the location of the dpkg database, relative to the
+// root of the file system
+const DefaultDpkgAdminDir = "var/lib/dpkg"
+
+// DpkgOptions controls how ImportDpkg reads the dpkg database
+type DpkgOptions struct {
+	ImportOptions
+
+	// The location of the dpkg database in the file system. If empty,
+	// DefaultDpkgAdminDir is used.
+	AdminDir string
+
+	// The distributor of the packages with no Origin field, also used as
+	// package URL namespace (lower case). If empty, "Debian" is used.
+	Vendor string
+}
+
+// ImportDpkg reads the dpkg database found in the supplied file system, whose
+// root is the root of a Debian host (e.g., os.DirFS("/") or a mounted image),
+// and returns one primary tag per installed package, in the order in which
+// packages appear in the status file. Each tag has:
+//
+//   - a package URL as tag ID, e.g., pkg:deb/debian/curl@7.74.0-1.3?arch=amd64;
+//   - the distributor (tag creator unless one is supplied) and the maintainer
+//     as entities;
+//   - the short and extended description, and the source package name, as
+//     software meta;
+//   - a "requires" link for each package listed in Depends and Pre-Depends
+//     (required use, optional for alternatives) and in Recommends
+//     (recommended use), referencing the package URL with no version;
+//   - a payload with the installed regular files listed in info/<pkg>.list.
+//
+// The MD5 digests found in the md5sums files and in the Conffiles field are
+// recorded only if an algorithm named "md5" is registered (see
+// RegisterHashAlgorithm). Files can be hashed from the file system using
+// ImportOptions.HashAlgIDs.
+func ImportDpkg(fsys fs.FS, opts *DpkgOptions) ([]*SoftwareIdentity, error) {
+	var o DpkgOptions
+
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.AdminDir == "" {
+		o.AdminDir = DefaultDpkgAdminDir
+	}
+
+	if o.Vendor == "" {
+		o.Vendor = "Debian"
+	}
+
+	f, err := fsys.Open(path.Join(o.AdminDir, "status"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stanzas, err := parseControl(f)
+	if err != nil {
+		return nil, fmt.Errorf("status: %w", err)
+	}
+
+	var tags []*SoftwareIdentity
+
+	for _, s := range stanzas {
+		if !s.installed() {
+			continue
+		}
+
+		p, err := o.newDpkgPackage(fsys, s)
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", s["package"], err)
+		}
+
+		tag, err := p.toTag(fsys, &o.ImportOptions)
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", s["package"], err)
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// controlStanza holds the fields of a stanza of a Debian control file, indexed
+// by lower case name. The value of multi-line fields holds the first line and
+// the continuation lines, with their leading space, separated by newlines.
+type controlStanza map[string]string
+
+func (s controlStanza) installed() bool {
+	status := strings.Fields(s["status"])
+
+	return len(status) == 3 && status[2] == "installed"
+}
+
+// parseControl parses a Debian control file made of stanzas separated by
+// blank lines (Debian Policy, Section 5.1)
+func parseControl(r io.Reader) ([]controlStanza, error) {
+	var (
+		stanzas []controlStanza
+		cur     controlStanza
+		last    string
+	)
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			cur, last = nil, ""
+		case line[0] == ' ' || line[0] == '\t':
+			if last == "" {
+				return nil, fmt.Errorf("line %d: continuation line without a field", n)
+			}
+			cur[last] += "\n" + line
+		case line[0] == '#':
+			continue
+		default:
+			i := strings.IndexByte(line, ':')
+			if i <= 0 {
+				return nil, fmt.Errorf("line %d: bad format: expecting <field>: <value>", n)
+			}
+
+			if cur == nil {
+				cur = controlStanza{}
+				stanzas = append(stanzas, cur)
+			}
+
+			last = strings.ToLower(line[:i])
+			cur[last] = strings.TrimSpace(line[i+1:])
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return stanzas, nil
+}
+
+func (o DpkgOptions) newDpkgPackage(fsys fs.FS, s controlStanza) (*installedPackage, error) {
+	p, err := newDebPackage(s, o.Vendor)
+	if err != nil {
+		return nil, err
+	}
+
+	name, arch := s["package"], s["architecture"]
+
+	digests, err := readMD5Sums(fsys, o.infoFile(fsys, name, arch, "md5sums"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range strings.Split(s["conffiles"], "\n") {
+		f := strings.Fields(c)
+		if len(f) >= 2 && (len(f) == 2 || f[2] != "obsolete") {
+			if h, ok := registeredDigest("md5", f[1]); ok {
+				digests[path.Clean(f[0])] = h
+			}
+		}
+	}
+
+	paths, err := readLines(fsys, o.infoFile(fsys, name, arch, "list"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range paths {
+		if !path.IsAbs(l) || l == "/." || l == "/" {
+			continue
+		}
+
+		f := installedFile{path: path.Clean(l)}
+
+		if h, ok := digests[f.path]; ok {
+			f.digests = HashEntries{h}
+		}
+
+		p.files = append(p.files, f)
+	}
+
+	return p, nil
+}
+
+// newDebPackage returns the package described by the fields of a stanza of
+// the dpkg status file or of a binary package control file, with no files.
+// Packages with no Origin field are attributed to the supplied vendor.
+func newDebPackage(s controlStanza, vendor string) (*installedPackage, error) {
+	name, version, arch := s["package"], s["version"], s["architecture"]
+
+	if name == "" || version == "" {
+		return nil, errors.New("missing Package or Version field")
+	}
+
+	if s["origin"] != "" {
+		vendor = s["origin"]
+	}
+
+	p := installedPackage{
+		purl: packageURL{
+			Type:       "deb",
+			Namespace:  strings.ToLower(vendor),
+			Name:       name,
+			Version:    version,
+			Qualifiers: map[string]string{"arch": arch},
+		},
+		name:        name,
+		version:     version,
+		distributor: vendor,
+		maintainer:  entityName(s["maintainer"]),
+		homepage:    s["homepage"],
+	}
+
+	p.summary, p.description = splitDescription(s["description"])
+
+	// the Source field may carry the source version, e.g., "glibc (2.31-13)"
+	if f := strings.Fields(s["source"]); len(f) != 0 {
+		p.product = f[0]
+	}
+
+	for _, dep := range []struct {
+		field string
+		use   int64
+	}{
+		{"pre-depends", UseRequired},
+		{"depends", UseRequired},
+		{"recommends", UseRecommended},
+	} {
+		p.deps = append(p.deps, parseDebDepends(p.purl, s[dep.field], dep.use)...)
+	}
+
+	return &p, nil
+}
+
+// infoFile returns the path of the info file of a package with the supplied
+// extension. Packages that can be installed for several architectures
+// (Multi-Arch: same) have the architecture in the name of their info files:
+// if that one does not exist, the plain name is used.
+func (o DpkgOptions) infoFile(fsys fs.FS, name, arch, ext string) string {
+	if arch != "" {
+		p := path.Join(o.AdminDir, "info", name+":"+arch+"."+ext)
+		if _, err := fs.Stat(fsys, p); err == nil {
+			return p
+		}
+	}
+
+	return path.Join(o.AdminDir, "info", name+"."+ext)
+}
+
+// readLines returns the non-empty lines of the file, or nothing if it does not
+// exist
+func readLines(fsys fs.FS, name string) ([]string, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+
+	for _, l := range strings.Split(string(data), "\n") {
+		if l = strings.TrimRight(l, "\r"); l != "" {
+			lines = append(lines, l)
+		}
+	}
+
+	return lines, nil
+}
+
+// readMD5Sums reads an md5sums file, made of "<digest>  <path>" lines with
+// paths relative to the root, and returns the digests indexed by absolute
+// path. Nothing is returned unless the md5 algorithm is registered.
+func readMD5Sums(fsys fs.FS, name string) (map[string]HashEntry, error) {
+	digests := map[string]HashEntry{}
+
+	if _, ok := LookupHashAlgorithmByName("md5"); !ok {
+		return digests, nil
+	}
+
+	lines, err := readLines(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range lines {
+		f := strings.SplitN(l, " ", 2)
+		if len(f) != 2 {
+			continue
+		}
+
+		if h, ok := registeredDigest("md5", f[0]); ok {
+			digests[path.Join("/", strings.TrimLeft(f[1], " "))] = h
+		}
+	}
+
+	return digests, nil
+}
+
+// splitDescription returns the synopsis and the extended description of a
+// Description field. In the extended description, lines made of a single
+// full stop stand for blank lines.
+func splitDescription(v string) (string, string) {
+	lines := strings.Split(v, "\n")
+
+	var ext []string
+
+	for _, l := range lines[1:] {
+		l = strings.TrimPrefix(l, " ")
+		if l == "." {
+			l = ""
+		}
+		ext = append(ext, l)
+	}
+
+	return strings.TrimSpace(lines[0]), strings.Join(ext, "\n")
+}
+
+// entityName returns the name found in a "Name <email>" field
+func entityName(v string) string {
+	if i := strings.IndexByte(v, '<'); i >= 0 {
+		v = v[:i]
+	}
+
+	return strings.TrimSpace(v)
+}
+
+// parseDebDepends parses a dependency field, e.g., "libc6 (>= 2.28), libssl1.1
+// | libssl3, python3:any", into references to packages of the same type and
+// namespace as from. Version constraints and architecture qualifiers are
+// dropped. The members of a group of alternatives are referenced with optional
+// use.
+func parseDebDepends(from packageURL, v string, use int64) []dependency {
+	var deps []dependency
+
+	for _, group := range strings.Split(v, ",") {
+		alts := strings.Split(group, "|")
+
+		for _, alt := range alts {
+			f := strings.FieldsFunc(alt, func(r rune) bool {
+				return r == ' ' || r == '\t' || r == '\n' || r == '('
+			})
+			if len(f) == 0 {
+				continue
+			}
+
+			name := f[0]
+			if i := strings.IndexByte(name, ':'); i >= 0 {
+				name = name[:i]
+			}
+
+			u := use
+			if len(alts) > 1 {
+				u = UseOptional
+			}
+
+			ref := from.versionless()
+			ref.Name = name
+
+			deps = append(deps, dependency{href: ref.String(), use: u})
+		}
+	}
+
+	return deps
+}
@@ -0,0 +1,235 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// a private use ID for MD5, which is not in the IANA registry
+const testMD5HashAlg uint64 = 0x10001
+
+// testRegisterMD5 registers MD5 for the duration of the test
+func testRegisterMD5(t *testing.T) {
+	require.Nil(t, RegisterHashAlgorithm(HashAlgorithm{
+		ID:       testMD5HashAlg,
+		Name:     "md5",
+		ValueLen: md5.Size,
+		New:      md5.New,
+	}))
+
+	t.Cleanup(func() {
+		hashAlgs.mu.Lock()
+		defer hashAlgs.mu.Unlock()
+
+		delete(hashAlgs.byID, testMD5HashAlg)
+		delete(hashAlgs.byName, "md5")
+	})
+}
+
+func testMD5(data string) string {
+	sum := md5.Sum([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+const testDpkgStatus = `Package: rrdetector
+Status: install ok installed
+Priority: optional
+Section: utils
+Installed-Size: 42
+Maintainer: Wile E. Coyote <wile@acme.example>
+Architecture: amd64
+Source: rrdetector-src (4.1.5-1)
+Version: 1:4.1.5-1
+Depends: libc6 (>= 2.28), librr1 (= 1:4.1.5-1), libssl1.1 | libssl3, python3:any
+Pre-Depends: dpkg (>= 1.19)
+Recommends: anvil, libc6
+Conffiles:
+ /etc/rrdetector.conf ` + "2ce9e5dc6e8a9ba0c1a8a8d0dbbd3d6f" + `
+ /etc/rrdetector.old 00000000000000000000000000000000 obsolete
+Description: detects roadrunners
+ The ACME Roadrunner Detector spots roadrunners
+ from a distance.
+ .
+ Beep beep.
+Homepage: https://acme.example/rrd
+
+Package: anvil
+Status: deinstall ok config-files
+Architecture: all
+Version: 3.1
+
+Package: librr1
+Status: install ok installed
+Multi-Arch: same
+Architecture: amd64
+Version: 1:4.1.5-1
+Origin: ACME
+`
+
+func testDpkgFS() fstest.MapFS {
+	return fstest.MapFS{
+		"var/lib/dpkg/status": {Data: []byte(testDpkgStatus)},
+		"var/lib/dpkg/info/rrdetector.list": {Data: []byte(
+			"/.\n/usr\n/usr/bin\n/usr/bin/rrdetector\n/usr/share/doc/rrdetector/README\n/etc/rrdetector.conf\n/usr/bin/rrd\n",
+		)},
+		"var/lib/dpkg/info/rrdetector.md5sums": {Data: []byte(
+			testMD5("roadrunner detector") + "  usr/bin/rrdetector\n" +
+				testMD5("beep beep") + "  usr/share/doc/rrdetector/README\n",
+		)},
+		"var/lib/dpkg/info/librr1:amd64.list": {Data: []byte("/usr/lib/librr.so.1\n")},
+		"usr/bin/rrdetector":                  {Data: []byte("roadrunner detector")},
+		"usr/bin/rrd":                         {Data: []byte("roadrunner detector")},
+		"usr/lib/librr.so.1":                  {Data: []byte("roadrunner library")},
+		"etc/rrdetector.conf":                 {Data: []byte("sensitivity=high")},
+	}
+}
+
+func TestImportDpkg(t *testing.T) {
+	tags, err := ImportDpkg(testDpkgFS(), nil)
+	require.Nil(t, err)
+	require.Len(t, tags, 2)
+
+	rrd := tags[0]
+	assert.Equal(t, "pkg:deb/debian/rrdetector@1:4.1.5-1?arch=amd64", rrd.TagID.String())
+	assert.Equal(t, "rrdetector", rrd.SoftwareName)
+	assert.Equal(t, "1:4.1.5-1", rrd.SoftwareVersion)
+
+	require.Len(t, rrd.Entities, 2)
+	assert.Equal(t, "Debian", rrd.Entities[0].EntityName)
+	assert.Equal(t, "tagCreator distributor", rrd.Entities[0].Roles.String())
+	assert.Equal(t, "Wile E. Coyote", rrd.Entities[1].EntityName)
+	assert.Equal(t, "maintainer", rrd.Entities[1].Roles.String())
+
+	require.NotNil(t, rrd.SoftwareMetas)
+	meta := (*rrd.SoftwareMetas)[0]
+	assert.Equal(t, "detects roadrunners", meta.Summary)
+	assert.Equal(t, "The ACME Roadrunner Detector spots roadrunners\nfrom a distance.\n\nBeep beep.", meta.Description)
+	assert.Equal(t, "rrdetector-src", meta.Product)
+
+	require.NotNil(t, rrd.Links)
+
+	var links []string
+	for _, l := range *rrd.Links {
+		use := ""
+		if l.Use != nil {
+			use = l.Use.String()
+		}
+		links = append(links, l.Rel.String()+" "+l.Href+" "+use)
+	}
+
+	assert.Equal(t, []string{
+		"see also https://acme.example/rrd ",
+		"requires pkg:deb/debian/dpkg required",
+		"requires pkg:deb/debian/libc6 required",
+		"requires pkg:deb/debian/librr1 required",
+		"requires pkg:deb/debian/libssl1.1 optional",
+		"requires pkg:deb/debian/libssl3 optional",
+		"requires pkg:deb/debian/python3 required",
+		"requires pkg:deb/debian/anvil recommended",
+	}, links)
+
+	// without md5, files missing from the file system are skipped
+	var paths []string
+	require.Nil(t, rrd.Payload.Walk(func(r ResolvedItem) error {
+		if !r.IsDir() {
+			paths = append(paths, r.FullPath())
+			assert.Nil(t, r.File.Hash)
+			assert.NotNil(t, r.File.Size)
+		}
+		return nil
+	}))
+	assert.Equal(t, []string{"/etc/rrdetector.conf", "/usr/bin/rrd", "/usr/bin/rrdetector"}, paths)
+
+	librr := tags[1]
+	assert.Equal(t, "pkg:deb/acme/librr1@1:4.1.5-1?arch=amd64", librr.TagID.String())
+	assert.Equal(t, "ACME", librr.Entities[0].EntityName)
+	assert.Nil(t, librr.SoftwareMetas)
+	assert.Nil(t, librr.Links)
+	require.NotNil(t, librr.Payload)
+
+	paths = nil
+	require.Nil(t, librr.Payload.Walk(func(r ResolvedItem) error {
+		paths = append(paths, r.FullPath())
+		return nil
+	}))
+	assert.Equal(t, []string{"/usr/lib", "/usr/lib/librr.so.1"}, paths)
+}
+
+func TestImportDpkg_digests(t *testing.T) {
+	testRegisterMD5(t)
+
+	creator, err := NewEntity("ACME Inventory", RoleTagCreator)
+	require.Nil(t, err)
+
+	fsys := testDpkgFS()
+	delete(fsys, "usr/bin/rrdetector")
+
+	tags, err := ImportDpkg(fsys, &DpkgOptions{
+		ImportOptions: ImportOptions{HashAlgIDs: []uint64{Sha256}, TagCreator: creator},
+	})
+	require.Nil(t, err)
+
+	rrd := tags[0]
+	require.Len(t, rrd.Entities, 3)
+	assert.Equal(t, "ACME Inventory", rrd.Entities[0].EntityName)
+	assert.Equal(t, "distributor", rrd.Entities[1].Roles.String())
+
+	files := map[string]*File{}
+	require.Nil(t, rrd.Payload.Walk(func(r ResolvedItem) error {
+		if !r.IsDir() {
+			files[r.FullPath()] = r.File
+		}
+		return nil
+	}))
+	require.Len(t, files, 4)
+
+	// recorded by the package database, missing from the file system
+	f := files["/usr/bin/rrdetector"]
+	assert.Equal(t, testMD5HashAlg, f.Hash.HashAlgID)
+	assert.Equal(t, testMD5("roadrunner detector"), hex.EncodeToString(f.Hash.HashValue))
+	assert.Nil(t, f.Size)
+	assert.Nil(t, f.Hashes)
+
+	f = files["/usr/share/doc/rrdetector/README"]
+	assert.Equal(t, testMD5("beep beep"), hex.EncodeToString(f.Hash.HashValue))
+
+	// conffile: digest from the status file, hash from the file system
+	f = files["/etc/rrdetector.conf"]
+	assert.Equal(t, "2ce9e5dc6e8a9ba0c1a8a8d0dbbd3d6f", hex.EncodeToString(f.Hash.HashValue))
+	assert.Equal(t, HashEntries{*testSha256(t, "sensitivity=high")}, f.Hashes)
+	assert.Equal(t, int64(16), *f.Size)
+
+	f = files["/usr/bin/rrd"]
+	assert.Equal(t, testSha256(t, "roadrunner detector"), f.Hash)
+	assert.Nil(t, f.Hashes)
+}
+
+func TestImportDpkg_ko(t *testing.T) {
+	_, err := ImportDpkg(fstest.MapFS{}, nil)
+	assert.EqualError(t, err, "open var/lib/dpkg/status: file does not exist")
+
+	for _, tv := range []struct {
+		status      string
+		expectedErr string
+	}{
+		{" orphan", "status: line 1: continuation line without a field"},
+		{"Package rrdetector", "status: line 1: bad format: expecting <field>: <value>"},
+		{"Package: rrdetector\nStatus: install ok installed", "package rrdetector: missing Package or Version field"},
+	} {
+		fsys := fstest.MapFS{"srv/dpkg/status": {Data: []byte(tv.status)}}
+
+		_, err := ImportDpkg(fsys, &DpkgOptions{AdminDir: "srv/dpkg"})
+		assert.EqualError(t, err, tv.expectedErr)
+	}
+
+	_, err = ImportDpkg(testDpkgFS(), &DpkgOptions{ImportOptions: ImportOptions{HashAlgIDs: []uint64{Sha3_256}}})
+	assert.EqualError(t, err, "package rrdetector: /usr/bin/rrdetector: no implementation available for hash algorithm sha3-256")
+}
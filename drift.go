@@ -0,0 +1,313 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+)
+
+// DriftOptions controls how DiffEvidence compares two Evidence snapshots
+type DriftOptions struct {
+	// If not empty, changed files and processes are attributed to the tags
+	// whose payloads declare them. Files not declared by any tag are
+	// attributed to the tags declaring their closest parent directory.
+	Owners []*SoftwareIdentity
+
+	// If set, paths are expanded and normalised using the profile before
+	// being compared, as done by Appraise.
+	Profile *PathProfile
+}
+
+// FileChange describes a file that differs between two Evidence snapshots
+type FileChange struct {
+	// The full path of the file, as found in the most recent snapshot
+	// holding it
+	Path string
+
+	// The file in the earlier and later snapshots. Before is nil for added
+	// files, and After is nil for removed files.
+	Before *File
+	After  *File
+
+	// For re-hashed files, a description of the change
+	Reason string
+
+	// The tags owning the file, if owners are supplied
+	Owners []*SoftwareIdentity
+}
+
+// ProcessChange describes a process that was started or stopped between two
+// Evidence snapshots
+type ProcessChange struct {
+	Process Process
+
+	// The tags declaring the process name, if owners are supplied
+	Owners []*SoftwareIdentity
+}
+
+// Drift is the report produced by DiffEvidence
+type Drift struct {
+	DeviceID string
+
+	// The dates of the compared snapshots
+	From time.Time
+	To   time.Time
+
+	// Files found in the later snapshot only
+	Added []FileChange
+
+	// Files found in the earlier snapshot only
+	Removed []FileChange
+
+	// Files found in both snapshots with different size or hashes
+	Rehashed []FileChange
+
+	// Processes found in the later snapshot only
+	Started []ProcessChange
+
+	// Processes found in the earlier snapshot only
+	Stopped []ProcessChange
+}
+
+// IsEmpty returns true if no drift was detected
+func (d Drift) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Rehashed) == 0 &&
+		len(d.Started) == 0 && len(d.Stopped) == 0
+}
+
+// DiffEvidence compares two Evidence snapshots collected from the same device,
+// before and after, and reports the files that were added, removed or
+// re-hashed, and the processes that were started or stopped. Files are
+// matched by their full path, and compared by size and by the hashes computed
+// with algorithms in common. If a snapshot holds more than one file with the
+// same path (e.g., repeated measurements), the last one is used. Processes are
+// matched by name and PID.
+func DiffEvidence(before, after *Evidence, opts *DriftOptions) (*Drift, error) {
+	if before == nil || after == nil {
+		return nil, errors.New("two evidence snapshots are needed")
+	}
+
+	if before.DeviceID != after.DeviceID {
+		return nil, fmt.Errorf("device ID mismatch: %q vs %q", before.DeviceID, after.DeviceID)
+	}
+
+	if before.Date.After(after.Date) {
+		return nil, errors.New("the earlier snapshot is dated after the later one")
+	}
+
+	var o DriftOptions
+
+	if opts != nil {
+		o = *opts
+	}
+
+	owners, err := newOwnerIndex(o.Owners, o.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := snapshotFiles(before, o.Profile)
+	if err != nil {
+		return nil, fmt.Errorf("earlier snapshot: %w", err)
+	}
+
+	a, err := snapshotFiles(after, o.Profile)
+	if err != nil {
+		return nil, fmt.Errorf("later snapshot: %w", err)
+	}
+
+	d := Drift{DeviceID: after.DeviceID, From: before.Date, To: after.Date}
+
+	for _, k := range a.keys {
+		af := a.files[k]
+
+		bf, ok := b.files[k]
+		if !ok {
+			d.Added = append(d.Added, FileChange{Path: af.path, After: af.file, Owners: owners.fileOwners(k)})
+			continue
+		}
+
+		if status, reason := compareFiles(bf.file, af.file); status == ItemMismatched {
+			d.Rehashed = append(d.Rehashed, FileChange{
+				Path:   af.path,
+				Before: bf.file,
+				After:  af.file,
+				Reason: reason,
+				Owners: owners.fileOwners(k),
+			})
+		}
+	}
+
+	for _, k := range b.keys {
+		if _, ok := a.files[k]; !ok {
+			bf := b.files[k]
+			d.Removed = append(d.Removed, FileChange{Path: bf.path, Before: bf.file, Owners: owners.fileOwners(k)})
+		}
+	}
+
+	d.Started = diffProcesses(after, before, owners)
+	d.Stopped = diffProcesses(before, after, owners)
+
+	return &d, nil
+}
+
+type snapshotFile struct {
+	path string
+	file *File
+}
+
+type snapshot struct {
+	files map[string]snapshotFile
+	keys  []string
+}
+
+func snapshotFiles(e *Evidence, pp *PathProfile) (*snapshot, error) {
+	s := snapshot{files: map[string]snapshotFile{}}
+
+	err := e.Walk(func(r ResolvedItem) error {
+		if r.IsDir() {
+			return nil
+		}
+
+		k, err := itemKey(pp, r)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.FullPath(), err)
+		}
+
+		if _, ok := s.files[k]; !ok {
+			s.keys = append(s.keys, k)
+		}
+
+		s.files[k] = snapshotFile{path: r.FullPath(), file: r.File}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+type processKey struct {
+	name string
+	pid  int
+}
+
+// diffProcesses returns the processes of x that are not in y
+func diffProcesses(x, y *Evidence, owners *ownerIndex) []ProcessChange {
+	key := func(p Process) processKey {
+		k := processKey{name: p.ProcessName, pid: -1}
+		if p.Pid != nil {
+			k.pid = *p.Pid
+		}
+		return k
+	}
+
+	inY := map[processKey]int{}
+
+	if y.Processes != nil {
+		for _, p := range *y.Processes {
+			inY[key(p)]++
+		}
+	}
+
+	var changes []ProcessChange
+
+	if x.Processes != nil {
+		for _, p := range *x.Processes {
+			k := key(p)
+			if inY[k] > 0 {
+				inY[k]--
+				continue
+			}
+			changes = append(changes, ProcessChange{Process: p, Owners: owners.processOwners(p.ProcessName)})
+		}
+	}
+
+	return changes
+}
+
+// ownerIndex maps file, directory and process names to the tags declaring them
+type ownerIndex struct {
+	files map[string][]*SoftwareIdentity
+	dirs  map[string][]*SoftwareIdentity
+	procs map[string][]*SoftwareIdentity
+}
+
+func newOwnerIndex(tags []*SoftwareIdentity, pp *PathProfile) (*ownerIndex, error) {
+	idx := ownerIndex{
+		files: map[string][]*SoftwareIdentity{},
+		dirs:  map[string][]*SoftwareIdentity{},
+		procs: map[string][]*SoftwareIdentity{},
+	}
+
+	for i, tag := range tags {
+		if tag == nil {
+			return nil, fmt.Errorf("owner tag at index %d is nil", i)
+		}
+
+		if tag.Payload == nil {
+			continue
+		}
+
+		err := tag.Payload.Walk(func(r ResolvedItem) error {
+			k, err := itemKey(pp, r)
+			if err != nil {
+				return fmt.Errorf("owner tag %q: %s: %w", tag.TagID.String(), r.FullPath(), err)
+			}
+
+			m := idx.files
+			if r.IsDir() {
+				m = idx.dirs
+			}
+
+			m[k] = appendOwner(m[k], tag)
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if tag.Payload.Processes != nil {
+			for _, p := range *tag.Payload.Processes {
+				idx.procs[p.ProcessName] = appendOwner(idx.procs[p.ProcessName], tag)
+			}
+		}
+	}
+
+	return &idx, nil
+}
+
+func appendOwner(owners []*SoftwareIdentity, tag *SoftwareIdentity) []*SoftwareIdentity {
+	for _, o := range owners {
+		if o == tag {
+			return owners
+		}
+	}
+	return append(owners, tag)
+}
+
+func (idx *ownerIndex) fileOwners(k string) []*SoftwareIdentity {
+	if owners, ok := idx.files[k]; ok {
+		return owners
+	}
+
+	for d := path.Dir(k); ; d = path.Dir(d) {
+		if owners, ok := idx.dirs[d]; ok {
+			return owners
+		}
+		if d == "/" || d == "." {
+			return nil
+		}
+	}
+}
+
+func (idx *ownerIndex) processOwners(name string) []*SoftwareIdentity {
+	return idx.procs[name]
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSnapshot(t *testing.T, fsys fstest.MapFS, date time.Time, procs ...string) *Evidence {
+	e := NewEvidence("BAD809B1-7032-43D9-8F94-BF128E5D061D")
+	e.Date = date
+
+	require.Nil(t, e.CollectFiles(fsys, []string{"opt"}, &PayloadOptions{Root: "/"}))
+
+	for i, name := range procs {
+		pid := 1000 + i
+		require.Nil(t, e.AddProcess(Process{ProcessName: name, Pid: &pid}))
+	}
+
+	return e
+}
+
+func TestDiffEvidence(t *testing.T) {
+	day1 := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+
+	before := testSnapshot(t, testFS, day1, "rrdetector", "sshd")
+
+	fsys := cloneMapFS(testFS)
+	delete(fsys, "opt/acme/share/doc/README")
+	fsys["opt/acme/lib/librr.so"].Data = []byte("coyote library")
+	fsys["opt/acme/etc/rrdetector.conf"].Data = []byte("sensitivity=low!")
+	fsys["opt/acme/lib/libcoyote.so"] = &fstest.MapFile{Data: []byte("coyote")}
+	fsys["opt/coyote/bin/coyote"] = &fstest.MapFile{Data: []byte("coyote")}
+
+	after := testSnapshot(t, fsys, day2, "rrdetector", "coyote")
+
+	owner := testTagFromFS(t, testFS, "opt/acme", &PayloadOptions{Root: "/opt/acme"})
+	require.Nil(t, owner.Payload.AddProcess(Process{ProcessName: "rrdetector"}))
+	require.Nil(t, owner.Payload.AddProcess(Process{ProcessName: "sshd"}))
+
+	d, err := DiffEvidence(before, after, &DriftOptions{Owners: []*SoftwareIdentity{owner, owner}})
+	require.Nil(t, err)
+
+	assert.False(t, d.IsEmpty())
+	assert.Equal(t, "BAD809B1-7032-43D9-8F94-BF128E5D061D", d.DeviceID)
+	assert.Equal(t, day1, d.From)
+	assert.Equal(t, day2, d.To)
+
+	require.Len(t, d.Added, 2)
+	assert.Equal(t, "/opt/acme/lib/libcoyote.so", d.Added[0].Path)
+	assert.Nil(t, d.Added[0].Before)
+	assert.NotNil(t, d.Added[0].After)
+	// attributed to the owner of the lib directory
+	assert.Equal(t, []*SoftwareIdentity{owner}, d.Added[0].Owners)
+	assert.Equal(t, "/opt/coyote/bin/coyote", d.Added[1].Path)
+	assert.Nil(t, d.Added[1].Owners)
+
+	require.Len(t, d.Removed, 1)
+	assert.Equal(t, "/opt/acme/share/doc/README", d.Removed[0].Path)
+	assert.Nil(t, d.Removed[0].After)
+	assert.Equal(t, []*SoftwareIdentity{owner}, d.Removed[0].Owners)
+
+	require.Len(t, d.Rehashed, 2)
+	assert.Equal(t, "/opt/acme/etc/rrdetector.conf", d.Rehashed[0].Path)
+	assert.Equal(t, "sha-256 hash mismatch", d.Rehashed[0].Reason)
+	assert.Equal(t, []*SoftwareIdentity{owner}, d.Rehashed[0].Owners)
+	assert.Equal(t, "/opt/acme/lib/librr.so", d.Rehashed[1].Path)
+	assert.Equal(t, "size mismatch: want 18, got 14", d.Rehashed[1].Reason)
+
+	require.Len(t, d.Started, 1)
+	assert.Equal(t, "coyote", d.Started[0].Process.ProcessName)
+	assert.Nil(t, d.Started[0].Owners)
+
+	require.Len(t, d.Stopped, 1)
+	assert.Equal(t, "sshd", d.Stopped[0].Process.ProcessName)
+	assert.Equal(t, []*SoftwareIdentity{owner}, d.Stopped[0].Owners)
+
+	// no drift
+	d, err = DiffEvidence(before, testSnapshot(t, testFS, day2, "rrdetector", "sshd"), nil)
+	require.Nil(t, err)
+	assert.True(t, d.IsEmpty())
+}
+
+func TestDiffEvidence_processes(t *testing.T) {
+	before := NewEvidence("")
+	after := NewEvidence("")
+	after.Date = before.Date
+
+	pid := 42
+	require.Nil(t, before.AddProcess(Process{ProcessName: "rrdetector"}))
+	require.Nil(t, before.AddProcess(Process{ProcessName: "rrdetector", Pid: &pid}))
+	// same name, no PID: one instance more
+	require.Nil(t, after.AddProcess(Process{ProcessName: "rrdetector"}))
+	require.Nil(t, after.AddProcess(Process{ProcessName: "rrdetector"}))
+	require.Nil(t, after.AddProcess(Process{ProcessName: "rrdetector", Pid: &pid}))
+
+	d, err := DiffEvidence(before, after, nil)
+	require.Nil(t, err)
+	require.Len(t, d.Started, 1)
+	assert.Nil(t, d.Started[0].Process.Pid)
+	assert.Nil(t, d.Stopped)
+}
+
+func TestDiffEvidence_profile(t *testing.T) {
+	before := NewEvidence("")
+	after := NewEvidence("")
+	after.Date = before.Date
+
+	require.Nil(t, before.AddFile(File{FileSystemItem: FileSystemItem{Root: "%programdata%", Location: `acme\rrdetector`, FsName: "rr.exe"}}))
+	require.Nil(t, after.AddFile(File{FileSystemItem: FileSystemItem{Root: `C:\ProgramData`, Location: "ACME/RRDetector", FsName: "RR.EXE"}}))
+
+	d, err := DiffEvidence(before, after, nil)
+	require.Nil(t, err)
+	assert.Len(t, d.Added, 1)
+	assert.Len(t, d.Removed, 1)
+
+	d, err = DiffEvidence(before, after, &DriftOptions{Profile: WindowsPathProfile(testWindowsVars)})
+	require.Nil(t, err)
+	assert.True(t, d.IsEmpty())
+}
+
+func TestDiffEvidence_ko(t *testing.T) {
+	e := NewEvidence("a")
+
+	_, err := DiffEvidence(e, nil, nil)
+	assert.EqualError(t, err, "two evidence snapshots are needed")
+
+	_, err = DiffEvidence(e, NewEvidence("b"), nil)
+	assert.EqualError(t, err, `device ID mismatch: "a" vs "b"`)
+
+	earlier := NewEvidence("a")
+	earlier.Date = e.Date.Add(-time.Hour)
+
+	_, err = DiffEvidence(e, earlier, nil)
+	assert.EqualError(t, err, "the earlier snapshot is dated after the later one")
+
+	_, err = DiffEvidence(earlier, e, &DriftOptions{Owners: []*SoftwareIdentity{nil}})
+	assert.EqualError(t, err, "owner tag at index 0 is nil")
+
+	pp := WindowsPathProfile(testWindowsVars)
+
+	owner, err := NewTag("com.acme.rrd", "ACME Roadrunner Detector", "4.1.5")
+	require.Nil(t, err)
+	owner.Payload = NewPayload()
+	require.Nil(t, owner.Payload.AddFile(File{FileSystemItem: FileSystemItem{Root: "%temp%", FsName: "rr.log"}}))
+
+	_, err = DiffEvidence(earlier, e, &DriftOptions{Owners: []*SoftwareIdentity{owner}, Profile: pp})
+	assert.EqualError(t, err, `owner tag "com.acme.rrd": %temp%/rr.log: undefined variable "temp"`)
+
+	bad := NewEvidence("a")
+	bad.Date = e.Date
+	require.Nil(t, bad.AddFile(File{FileSystemItem: FileSystemItem{Root: "%temp%", FsName: "rr.log"}}))
+
+	_, err = DiffEvidence(bad, e, &DriftOptions{Profile: pp})
+	assert.EqualError(t, err, `earlier snapshot: %temp%/rr.log: undefined variable "temp"`)
+
+	_, err = DiffEvidence(earlier, bad, &DriftOptions{Profile: pp})
+	assert.EqualError(t, err, `later snapshot: %temp%/rr.log: undefined variable "temp"`)
+}
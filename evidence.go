@@ -53,3 +53,15 @@ func (e *Evidence) AddProcess(p Process) error {
 
 	return nil
 }
+
+// AddResource adds the supplied Resource to the embedded ResourceCollection of
+// the Evidence receiver
+func (e *Evidence) AddResource(r Resource) error {
+	if e.Resources == nil {
+		e.Resources = new(Resources)
+	}
+
+	*e.Resources = append(*e.Resources, r)
+
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CollectProcesses adds to the Evidence receiver the processes found in
+// procfs, which is expected to be a Linux proc file system (e.g.,
+// os.DirFS("/proc")). Each numeric directory is a process whose name is read
+// from its "comm" file. Since the kernel truncates that name to 15 bytes, the
+// base name of the first argument of the "cmdline" file is used instead when
+// it extends the truncated name. Processes that exit, or that cannot be
+// inspected, while the collection is in progress are skipped: only a failure
+// to read the procfs directory aborts the collection. Processes are added in
+// ascending PID order.
+func (e *Evidence) CollectProcesses(procfs fs.FS) error {
+	entries, err := fs.ReadDir(procfs, ".")
+	if err != nil {
+		return err
+	}
+
+	var pids []int
+
+	for _, de := range entries {
+		if !de.IsDir() {
+			continue
+		}
+
+		pid, err := strconv.Atoi(de.Name())
+		if err != nil || pid <= 0 {
+			continue
+		}
+
+		pids = append(pids, pid)
+	}
+
+	sort.Ints(pids)
+
+	for _, pid := range pids {
+		// the process may have exited since the directory was read, which
+		// surfaces as any of ENOENT, ESRCH or an empty read
+		comm, err := fs.ReadFile(procfs, path.Join(strconv.Itoa(pid), "comm"))
+		if err != nil {
+			continue
+		}
+
+		name := strings.TrimSuffix(string(comm), "\n")
+		if name == "" {
+			continue
+		}
+
+		if len(name) == maxCommLen {
+			name = untruncatedProcessName(procfs, pid, name)
+		}
+
+		pid := pid
+
+		if err := e.AddProcess(Process{ProcessName: name, Pid: &pid}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// maxCommLen is the length of the process names truncated by the kernel
+const maxCommLen = 15
+
+// untruncatedProcessName returns the base name of the first argument of the
+// command line of the process, if it starts with its truncated comm name
+func untruncatedProcessName(procfs fs.FS, pid int, comm string) string {
+	cmdline, err := fs.ReadFile(procfs, path.Join(strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return comm
+	}
+
+	argv0, _, _ := strings.Cut(string(cmdline), "\x00")
+
+	if name := path.Base(argv0); strings.HasPrefix(name, comm) {
+		return name
+	}
+
+	return comm
+}
+
+// CollectFiles adds to the Evidence receiver the supplied paths of the file
+// system fsys (e.g., "usr/bin/rrdetector" in os.DirFS("/")). A file path is
+// added as a File, with size and hashes, and with its parent directories as
+// location. A directory path is added as a Directory, together with the
+// nested directories and files found under it, as done by NewPayloadFromFS.
+//
+// The options are those used by NewPayloadFromFS. The patterns are matched
+// against paths relative to each collected directory, or, for file paths,
+// against the path as supplied. If set, Root is the root of the collected
+// items.
+func (e *Evidence) CollectFiles(fsys fs.FS, paths []string, opts *PayloadOptions) error {
+	w := newFSWalker(fsys, opts)
+
+	// nested items carry no root
+	dirOpts := w.opts
+	dirOpts.Root = ""
+
+	var pe PathElements
+
+	for _, p := range paths {
+		if !fs.ValidPath(p) || p == "." {
+			return fmt.Errorf("invalid path %q", p)
+		}
+
+		info, err := fs.Stat(fsys, p)
+		if err != nil {
+			return err
+		}
+
+		loc, name := path.Split(p)
+
+		fsi := FileSystemItem{
+			Location: strings.TrimSuffix(loc, "/"),
+			FsName:   name,
+		}
+
+		switch {
+		case info.IsDir():
+			sub, err := pathElementsFromFS(fsys, p, &dirOpts)
+			if err != nil {
+				return err
+			}
+
+			pe.addDirectory(Directory{FileSystemItem: fsi, PathElements: sub})
+		case info.Mode().IsRegular():
+			f, err := w.newFile(info, p)
+			if err != nil {
+				return err
+			}
+
+			if f == nil {
+				continue
+			}
+
+			if err := hashFile(fsys, p, w.opts.HashAlgIDs, f); err != nil {
+				return err
+			}
+
+			f.Location = fsi.Location
+			pe.addFile(*f)
+		default:
+			return fmt.Errorf("%s: not a regular file or directory", p)
+		}
+	}
+
+	if w.opts.Root != "" {
+		setRoot(&pe, w.opts.Root)
+	}
+
+	if pe.Directories != nil {
+		for _, d := range *pe.Directories {
+			e.PathElements.addDirectory(d)
+		}
+	}
+
+	if pe.Files != nil {
+		for _, f := range *pe.Files {
+			if err := e.AddFile(f); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
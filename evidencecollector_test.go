@@ -0,0 +1,154 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testProcFS = fstest.MapFS{
+	"1/comm":       {Data: []byte("systemd\n")},
+	"1/cmdline":    {Data: []byte("/sbin/init\x00")},
+	"1021/comm":    {Data: []byte("rrdetector\n")},
+	"987/comm":     {Data: []byte("sshd\n")},
+	"1500/comm":    {Data: []byte("rrdetector-upda\n")},
+	"1500/cmdline": {Data: []byte("/usr/libexec/rrdetector-updater\x00--daemon\x00")},
+	"1600/comm":    {Data: []byte("rrdetector-moni\n")},
+	"1600/cmdline": {Data: []byte("rrd: monitoring\x00")},
+	"1700/comm":    {Data: []byte("rrdetector-reco\n")},
+	"4242/cmdline": {Data: []byte("")}, // exited
+	"self":         {Data: []byte("1021"), Mode: fs.ModeSymlink},
+	"sys/kernel":   {Mode: fs.ModeDir},
+	"uptime":       {Data: []byte("350735.47 234388.90\n")},
+}
+
+func TestEvidence_CollectProcesses(t *testing.T) {
+	e := NewEvidence("BAD809B1-7032-43D9-8F94-BF128E5D061D")
+
+	require.Nil(t, e.CollectProcesses(testProcFS))
+	require.NotNil(t, e.Processes)
+
+	type proc struct {
+		Name string
+		Pid  int
+	}
+
+	var actual []proc
+	for _, p := range *e.Processes {
+		actual = append(actual, proc{p.ProcessName, *p.Pid})
+	}
+
+	// truncated names are completed from the command line, if it matches
+	assert.Equal(t, []proc{
+		{"systemd", 1},
+		{"sshd", 987},
+		{"rrdetector", 1021},
+		{"rrdetector-updater", 1500},
+		{"rrdetector-moni", 1600},
+		{"rrdetector-reco", 1700},
+	}, actual)
+
+	// processes that cannot be read are skipped
+	e = NewEvidence("")
+	require.Nil(t, e.CollectProcesses(fstest.MapFS{
+		"1/comm":   {Mode: fs.ModeDir},
+		"2/comm":   {Data: []byte("init\n")},
+		"3/status": {Data: []byte("Name:\tzombie\n")},
+	}))
+	require.Len(t, *e.Processes, 1)
+	assert.Equal(t, "init", (*e.Processes)[0].ProcessName)
+
+	// only a procfs that cannot be read aborts the collection
+	err := e.CollectProcesses(fstest.MapFS{".": {Data: []byte("not a directory")}})
+	assert.NotNil(t, err)
+
+	err = NewEvidence("").CollectProcesses(fstest.MapFS{"1": {Data: []byte("")}})
+	assert.Nil(t, err)
+}
+
+func TestEvidence_CollectFiles(t *testing.T) {
+	e := NewEvidence("BAD809B1-7032-43D9-8F94-BF128E5D061D")
+
+	err := e.CollectFiles(testFS, []string{
+		"opt/acme/bin/rrdetector",
+		"opt/acme/lib",
+		"opt/acme/etc/rrdetector.conf",
+	}, &PayloadOptions{
+		Root:    "/",
+		Exclude: []string{"*.a"},
+		Key:     []string{"*.so", "opt/acme/bin/rrdetector"},
+	})
+	require.Nil(t, err)
+
+	require.NotNil(t, e.Directories)
+	require.Len(t, *e.Directories, 1)
+
+	lib := (*e.Directories)[0]
+	assert.Equal(t, FileSystemItem{Root: "/", Location: "opt/acme", FsName: "lib"}, lib.FileSystemItem)
+	require.Len(t, *lib.Files, 1)
+	assert.Equal(t, "librr.so", (*lib.Files)[0].FsName)
+	assert.Equal(t, "", (*lib.Files)[0].Root)
+	assert.True(t, *(*lib.Files)[0].Key)
+
+	require.NotNil(t, e.Files)
+	require.Len(t, *e.Files, 2)
+
+	bin := (*e.Files)[0]
+	assert.Equal(t, "/", bin.Root)
+	assert.Equal(t, "opt/acme/bin", bin.Location)
+	assert.Equal(t, "rrdetector", bin.FsName)
+	assert.Equal(t, int64(len("roadrunner detector")), *bin.Size)
+	assert.Equal(t, testSha256(t, "roadrunner detector"), bin.Hash)
+	assert.True(t, *bin.Key)
+
+	assert.Nil(t, (*e.Files)[1].Key)
+
+	// the collected evidence can be verified against the same file system
+	tag, err := NewTag("com.acme.rrd2013-ce-sp1-v4-1-5-0", "ACME Roadrunner Detector", "4.1.5")
+	require.Nil(t, err)
+	tag.Payload = NewPayload()
+	tag.Payload.ResourceCollection = e.ResourceCollection
+
+	v, err := VerifyPayload(tag, testFS, nil)
+	require.Nil(t, err)
+	assert.Len(t, v.Verified, 3)
+	assert.Equal(t, []string{"opt/acme/lib/librr.a"}, v.Unexpected)
+}
+
+func TestEvidence_CollectFiles_ko(t *testing.T) {
+	e := NewEvidence("BAD809B1-7032-43D9-8F94-BF128E5D061D")
+
+	for _, tv := range []struct {
+		Paths       []string
+		ExpectedErr string
+	}{
+		{[]string{"/opt/acme"}, `invalid path "/opt/acme"`},
+		{[]string{"."}, `invalid path "."`},
+		{[]string{"opt/coyote"}, "open opt/coyote: file does not exist"},
+	} {
+		err := e.CollectFiles(testFS, tv.Paths, nil)
+		assert.EqualError(t, err, tv.ExpectedErr)
+	}
+
+	fifo := fstest.MapFS{"run/rrdetector.fifo": {Mode: fs.ModeNamedPipe}}
+
+	err := e.CollectFiles(fifo, []string{"run/rrdetector.fifo"}, nil)
+	assert.EqualError(t, err, "run/rrdetector.fifo: not a regular file or directory")
+
+	err = e.CollectFiles(testFS, []string{"opt/acme/lib"}, &PayloadOptions{Exclude: []string{"["}})
+	assert.EqualError(t, err, `bad pattern "[": syntax error in pattern`)
+
+	err = e.CollectFiles(testFS, []string{"opt/acme/bin/rrdetector"}, &PayloadOptions{HashAlgIDs: []uint64{Sha3_256}})
+	assert.EqualError(t, err, "hashing opt/acme/bin/rrdetector: no implementation available for hash algorithm sha3-256")
+
+	// files not matching the include patterns are skipped
+	err = e.CollectFiles(testFS, []string{"opt/acme/bin/rrdetector"}, &PayloadOptions{Include: []string{"*.so"}})
+	assert.Nil(t, err)
+	assert.Nil(t, e.Files)
+}
@@ -3,6 +3,8 @@
 
 package swid
 
+import "encoding/xml"
+
 // File models CoSWID file-entry
 type File struct {
 	GlobalAttributes
@@ -23,3 +25,102 @@ type File struct {
 	// match, the the file has not been modified in any fashion.
 	Hash *HashEntry `cbor:"7,keyasint,omitempty" json:"hash,omitempty" xml:"hash,attr,omitempty"`
 }
+
+// AddHash adds the supplied HashEntry to the File receiver. The first hash is
+// stored in Hash, any further one in the Hashes extension.
+func (f *File) AddHash(h HashEntry) error {
+	if err := ValidHashEntry(h.HashAlgID, h.HashValue); err != nil {
+		return err
+	}
+
+	if f.Hash == nil {
+		f.Hash = &h
+		return nil
+	}
+
+	f.Hashes = append(f.Hashes, h)
+
+	return nil
+}
+
+// AllHashes returns all the hash entries associated with the File receiver,
+// i.e., Hash followed by the contents of the Hashes extension
+func (f File) AllHashes() HashEntries {
+	var hashes HashEntries
+
+	if f.Hash != nil {
+		hashes = append(hashes, *f.Hash)
+	}
+
+	return append(hashes, f.Hashes...)
+}
+
+// MarshalXML provides the custom XML marshaler for the File type. It adds the
+// ISO SWID namespace-qualified hash attributes for the entries in Hashes, and
+// lists those using algorithms with no XML namespace, or an unknown algorithm,
+// in a "hashes" attribute.
+func (f File) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type file File // avoid recursion
+
+	attrs, err := f.Hashes.toXMLAttrs(f.Hash)
+	if err != nil {
+		return err
+	}
+
+	start.Attr = append(start.Attr, attrs...)
+
+	return e.EncodeElement(file(f), start)
+}
+
+// UnmarshalXML provides the custom XML unmarshaler for the File type. ISO SWID
+// namespace-qualified hash attributes, and the "hashes" attribute, are decoded
+// into Hashes. If there is no plain hash attribute, the first of those is
+// decoded into Hash instead, so that the file keeps a CoSWID hash-entry.
+func (f *File) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type file File // avoid recursion
+
+	var (
+		hashes HashEntries
+		attrs  []xml.Attr
+	)
+
+	for _, a := range start.Attr {
+		switch {
+		case a.Name.Local == "hash" && a.Name.Space != "":
+			h, err := hashEntryFromXMLNamespacedAttr(a)
+			if err != nil {
+				return err
+			}
+
+			hashes = append(hashes, h)
+		case a.Name.Local == "hashes" && a.Name.Space == "":
+			var others HashEntries
+
+			if err := others.UnmarshalXMLAttr(a); err != nil {
+				return err
+			}
+
+			hashes = append(hashes, others...)
+		default:
+			attrs = append(attrs, a)
+		}
+	}
+
+	start.Attr = attrs
+
+	if err := d.DecodeElement((*file)(f), &start); err != nil {
+		return err
+	}
+
+	if f.Hash == nil && len(hashes) > 0 {
+		f.Hash = &hashes[0]
+		hashes = hashes[1:]
+	}
+
+	f.Hashes = nil
+	if len(hashes) > 0 {
+		f.Hashes = hashes
+	}
+
+	return nil
+}
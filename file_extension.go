@@ -3,7 +3,13 @@
 
 package swid
 
-// FileExtension is a placeholder for $$file-extension
+// FileExtension models $$file-extension
 type FileExtension struct {
-	// no file-extensions defined
+	// Additional hash values of the file, typically computed using
+	// different algorithms. In SWID XML they are serialized as ISO SWID
+	// namespace-qualified hash attributes (e.g., SHA256:hash="..."), with
+	// the hash value hex-encoded, or as a space separated list in a "hashes"
+	// attribute for algorithms with no XML namespace. In CoSWID they use
+	// private index -1.
+	Hashes HashEntries `cbor:"-1,keyasint,omitempty" json:"hashes,omitempty" xml:"-"`
 }
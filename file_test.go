@@ -4,7 +4,12 @@
 package swid
 
 import (
+	"encoding/json"
+	"encoding/xml"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -92,3 +97,235 @@ func TestFile_RoundtripMinset(t *testing.T) {
 
 	roundTripper(t, tv, expectedCBOR)
 }
+
+var testNISTStyleXML = []byte(`<SoftwareIdentity xmlns="http://standards.iso.org/iso/19770/-2/2015/schema.xsd" xmlns:SHA256="http://www.w3.org/2001/04/xmlenc#sha256" xmlns:SHA512="http://www.w3.org/2001/04/xmlenc#sha512" tagId="com.acme.rrd2013-ce-sp1-v4-1-5-0" name="ACME Roadrunner Detector 2013 Coyote Edition SP1" version="4.1.5"><Entity name="The ACME Corporation" regid="acme.com" role="tagCreator softwareCreator"></Entity><Payload><Directory name="rrdetector" root="%programdata%"><File name="rrdetector.exe" size="532712" SHA256:hash="a314fc2dc663ae7a6b6bc6787594057396e6b3f569cd50fd5ddb4d1bbafd2b6a" SHA512:hash="D7A8FBB307D7809469CA9ABCB0082E4F8D5651E46D3CDB762D02D0BF37C9E592D7A8FBB307D7809469CA9ABCB0082E4F8D5651E46D3CDB762D02D0BF37C9E592"></File></Directory></Payload></SoftwareIdentity>`)
+
+func TestFile_NamespacedHashes_FromXML(t *testing.T) {
+	var tag SoftwareIdentity
+
+	require.Nil(t, tag.FromXML(testNISTStyleXML))
+
+	// with no plain hash attribute, the first one is the CoSWID hash-entry
+	f := (*(*tag.Payload.Directories)[0].Files)[0]
+	require.NotNil(t, f.Hash)
+	assert.Equal(t, Sha256, f.Hash.HashAlgID)
+	assert.Equal(t,
+		MustHexDecode(t, "a314fc2dc663ae7a6b6bc6787594057396e6b3f569cd50fd5ddb4d1bbafd2b6a"),
+		f.Hash.HashValue,
+	)
+	require.Len(t, f.Hashes, 1)
+	assert.Equal(t, Sha512, f.Hashes[0].HashAlgID)
+	assert.Len(t, f.Hashes[0].HashValue, 64)
+
+	// XML -> CBOR -> XML is lossless
+	data, err := tag.ToCBOR()
+	require.Nil(t, err)
+
+	var fromCBOR SoftwareIdentity
+	require.Nil(t, fromCBOR.FromCBOR(data))
+	assert.Equal(t, f, (*(*fromCBOR.Payload.Directories)[0].Files)[0])
+
+	data, err = fromCBOR.ToXML()
+	require.Nil(t, err)
+
+	var fromXML SoftwareIdentity
+	require.Nil(t, fromXML.FromXML(data))
+	assert.Equal(t, f, (*(*fromXML.Payload.Directories)[0].Files)[0])
+}
+
+func TestFile_NamespacedHashes_ToXML(t *testing.T) {
+	tv := File{
+		FileSystemItem: FileSystemItem{FsName: "firmware.bin"},
+		Hash: &HashEntry{
+			HashAlgID: Sha256_32,
+			HashValue: []byte{0xde, 0xad, 0xbe, 0xef},
+		},
+		FileExtension: FileExtension{
+			Hashes: HashEntries{
+				{
+					HashAlgID: Sha256,
+					HashValue: MustHexDecode(t, "a314fc2dc663ae7a6b6bc6787594057396e6b3f569cd50fd5ddb4d1bbafd2b6a"),
+				},
+			},
+		},
+	}
+
+	expected := `<File xmlns:SHA256="http://www.w3.org/2001/04/xmlenc#sha256" SHA256:hash="a314fc2dc663ae7a6b6bc6787594057396e6b3f569cd50fd5ddb4d1bbafd2b6a" name="firmware.bin" hash="sha-256-32;3q2+7w=="></File>`
+
+	data, err := xml.Marshal(tv)
+	require.Nil(t, err)
+	assert.Equal(t, expected, string(data))
+
+	var actual File
+	require.Nil(t, xml.Unmarshal(data, &actual))
+	assert.Equal(t, tv, actual)
+}
+
+func TestFile_NamespacedHashes_ko(t *testing.T) {
+	for _, tv := range []struct {
+		In          string
+		ExpectedErr string
+	}{
+		{
+			In:          `<File xmlns:SHA1="http://www.w3.org/2000/09/xmldsig#sha1" name="a" SHA1:hash="00"></File>`,
+			ExpectedErr: "unknown hash algorithm namespace http://www.w3.org/2000/09/xmldsig#sha1",
+		},
+		{
+			In:          `<File xmlns:SHA256="http://www.w3.org/2001/04/xmlenc#sha256" name="a" SHA256:hash="zz"></File>`,
+			ExpectedErr: "decoding sha-256 hash: encoding/hex: invalid byte: U+007A 'z'",
+		},
+		{
+			In:          `<File xmlns:SHA256="http://www.w3.org/2001/04/xmlenc#sha256" name="a" SHA256:hash="00"></File>`,
+			ExpectedErr: "length mismatch for hash algorithm sha-256: want 32 bytes, got 1",
+		},
+	} {
+		var f File
+		assert.EqualError(t, xml.Unmarshal([]byte(tv.In), &f), tv.ExpectedErr)
+	}
+
+	for _, tv := range []struct {
+		In          HashEntries
+		ExpectedErr string
+	}{
+		{
+			In:          HashEntries{{HashAlgID: 1024, HashValue: []byte{0xde, 0xad, 0xbe, 0xef}}},
+			ExpectedErr: "unknown hash algorithm ID 1024",
+		},
+		{
+			In: HashEntries{
+				{HashAlgID: Sha256, HashValue: make([]byte, 32)},
+				{HashAlgID: Sha256, HashValue: make([]byte, 32)},
+			},
+			ExpectedErr: "duplicate hash for algorithm sha-256",
+		},
+		{
+			In:          HashEntries{{HashAlgID: Sha256}},
+			ExpectedErr: "empty hash value",
+		},
+	} {
+		f := File{
+			FileSystemItem: FileSystemItem{FsName: "a"},
+			FileExtension:  FileExtension{Hashes: tv.In},
+		}
+		_, err := xml.Marshal(f)
+		assert.EqualError(t, err, tv.ExpectedErr)
+	}
+
+	// Hash and Hashes must not repeat an algorithm either
+	f := File{
+		FileSystemItem: FileSystemItem{FsName: "a"},
+		Hash:           &HashEntry{HashAlgID: Sha256, HashValue: make([]byte, 32)},
+		FileExtension: FileExtension{
+			Hashes: HashEntries{{HashAlgID: Sha256, HashValue: make([]byte, 32)}},
+		},
+	}
+	_, err := xml.Marshal(f)
+	assert.EqualError(t, err, "duplicate hash for algorithm sha-256")
+}
+
+func TestFile_UnknownHashes_RoundtripXML(t *testing.T) {
+	tv := File{
+		FileSystemItem: FileSystemItem{FsName: "firmware.bin"},
+		Hash:           &HashEntry{HashAlgID: UnknownHashAlg, HashValue: []byte{0x01, 0x02}},
+		FileExtension: FileExtension{
+			Hashes: HashEntries{
+				{HashAlgID: UnknownHashAlg, HashValue: []byte{0x03, 0x04}},
+				{HashAlgID: Sha256, HashValue: MustHexDecode(t, "a314fc2dc663ae7a6b6bc6787594057396e6b3f569cd50fd5ddb4d1bbafd2b6a")},
+			},
+		},
+	}
+
+	expected := `<File xmlns:SHA256="http://www.w3.org/2001/04/xmlenc#sha256" SHA256:hash="a314fc2dc663ae7a6b6bc6787594057396e6b3f569cd50fd5ddb4d1bbafd2b6a" hashes="unknown;AwQ=" name="firmware.bin" hash="unknown;AQI="></File>`
+
+	data, err := xml.Marshal(tv)
+	require.Nil(t, err)
+	assert.Equal(t, expected, string(data))
+
+	var actual File
+	require.Nil(t, xml.Unmarshal(data, &actual))
+	assert.Equal(t, tv.Hash, actual.Hash)
+	assert.ElementsMatch(t, tv.Hashes, actual.Hashes)
+}
+
+func TestFile_NamespacedHashes_RoundtripCBOR(t *testing.T) {
+	tv := File{
+		FileSystemItem: FileSystemItem{FsName: "a"},
+		FileExtension: FileExtension{
+			Hashes: HashEntries{
+				{HashAlgID: Sha256_32, HashValue: []byte{0xde, 0xad, 0xbe, 0xef}},
+			},
+		},
+	}
+	/*
+		a2                  # map(2)
+		   20               # negative(0)
+		   81               # array(1)
+		      82            # array(2)
+		         06         # unsigned(6)
+		         44         # bytes(4)
+		            deadbeef
+		   18 18            # unsigned(24)
+		   61               # text(1)
+		      61            # "a"
+	*/
+	expectedCBOR := []byte{
+		0xa2, 0x20, 0x81, 0x82, 0x06, 0x44, 0xde, 0xad, 0xbe, 0xef, 0x18,
+		0x18, 0x61, 0x61,
+	}
+
+	roundTripper(t, tv, expectedCBOR)
+
+	data, err := json.Marshal(tv)
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"hashes":["sha-256-32;3q2+7w=="],"fs-name":"a"}`, string(data))
+}
+
+func TestFile_AddHash(t *testing.T) {
+	var f File
+
+	h1 := HashEntry{HashAlgID: Sha256_32, HashValue: []byte{0xde, 0xad, 0xbe, 0xef}}
+	h2 := HashEntry{HashAlgID: Sha256_64, HashValue: []byte{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad, 0xbe, 0xef}}
+
+	assert.Nil(t, f.AddHash(h1))
+	assert.Nil(t, f.AddHash(h2))
+	assert.EqualError(t, f.AddHash(HashEntry{HashAlgID: Sha256}), "length mismatch for hash algorithm sha-256: want 32 bytes, got 0")
+
+	assert.Equal(t, h1, *f.Hash)
+	assert.Equal(t, HashEntries{h2}, f.Hashes)
+	assert.Equal(t, HashEntries{h1, h2}, f.AllHashes())
+}
+
+func TestFile_HashesWithoutXMLNamespace(t *testing.T) {
+	var f File
+
+	f.FsName = "firmware.bin"
+
+	h1 := HashEntry{HashAlgID: Sha256, HashValue: MustHexDecode(t, "a314fc2dc663ae7a6b6bc6787594057396e6b3f569cd50fd5ddb4d1bbafd2b6a")}
+	h2 := HashEntry{HashAlgID: Sha256_32, HashValue: []byte{0xde, 0xad, 0xbe, 0xef}}
+	h3 := HashEntry{HashAlgID: Sha256_64, HashValue: []byte{0xde, 0xad, 0xbe, 0xef, 0xde, 0xad, 0xbe, 0xef}}
+
+	require.Nil(t, f.AddHash(h1))
+	require.Nil(t, f.AddHash(h2))
+	require.Nil(t, f.AddHash(h3))
+
+	expected := `<File hashes="sha-256-32;3q2+7w== sha-256-64;3q2+796tvu8=" name="firmware.bin" hash="sha-256;oxT8LcZjrnpra8Z4dZQFc5bms/VpzVD9XdtNG7r9K2o="></File>`
+
+	data, err := xml.Marshal(f)
+	require.Nil(t, err)
+	assert.Equal(t, expected, string(data))
+
+	var actual File
+	require.Nil(t, xml.Unmarshal(data, &actual))
+	assert.Equal(t, f, actual)
+
+	// the first of the hashes is promoted if there is no plain hash
+	actual = File{}
+	require.Nil(t, xml.Unmarshal([]byte(`<File name="a" hashes="sha-256-32;3q2+7w=="></File>`), &actual))
+	assert.Equal(t, &h2, actual.Hash)
+	assert.Nil(t, actual.Hashes)
+
+	assert.EqualError(t,
+		xml.Unmarshal([]byte(`<File name="a" hashes="sha-256-32"></File>`), &actual),
+		"bad format: expecting <hash-alg-string>;<hash-value>",
+	)
+}
@@ -0,0 +1,202 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// FileIndexOptions controls how a FileIndex matches paths
+type FileIndexOptions struct {
+	// If set, paths are expanded and normalised using the profile before
+	// being indexed and looked up, as done by Appraise.
+	Profile *PathProfile
+}
+
+// FileOwner is a Directory or File entry declared in the payload of a tag
+type FileOwner struct {
+	// The tag declaring the item
+	Tag *SoftwareIdentity
+
+	// The item, with its resolved root and path
+	Item ResolvedItem
+}
+
+// FileConflict reports a path claimed by files of different tags that
+// disagree on size or digest
+type FileConflict struct {
+	// The full path, as declared by the first tag claiming it
+	Path string
+
+	// The conflicting files, in the order in which their tags were added
+	Owners []FileOwner
+
+	// A description of the first disagreement found
+	Reason string
+}
+
+// FileIndex is a reverse index over a corpus of tags, mapping resolved paths
+// and file digests back to the tags and the payload entries declaring them.
+// Only payloads are indexed.
+type FileIndex struct {
+	profile *PathProfile
+
+	byPath map[string][]FileOwner
+	paths  []string
+
+	byHash map[string][]FileOwner
+}
+
+// NewFileIndex returns an empty FileIndex. The options may be nil.
+func NewFileIndex(opts *FileIndexOptions) *FileIndex {
+	idx := FileIndex{
+		byPath: map[string][]FileOwner{},
+		byHash: map[string][]FileOwner{},
+	}
+
+	if opts != nil {
+		idx.profile = opts.Profile
+	}
+
+	return &idx
+}
+
+// Add indexes the directories and files declared in the payload of the
+// supplied tag. Tags without a payload are accepted and ignored.
+func (idx *FileIndex) Add(tag *SoftwareIdentity) error {
+	if tag == nil {
+		return errors.New("nil tag")
+	}
+
+	if tag.Payload == nil {
+		return nil
+	}
+
+	type entry struct {
+		k string
+		o FileOwner
+	}
+
+	var entries []entry
+
+	// index the tag only if all of its paths can be resolved
+	err := tag.Payload.Walk(func(r ResolvedItem) error {
+		k, err := itemKey(idx.profile, r)
+		if err != nil {
+			return fmt.Errorf("tag %q: %s: %w", tag.TagID.String(), r.FullPath(), err)
+		}
+
+		entries = append(entries, entry{k, FileOwner{Tag: tag, Item: r}})
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if _, ok := idx.byPath[e.k]; !ok {
+			idx.paths = append(idx.paths, e.k)
+		}
+		idx.byPath[e.k] = append(idx.byPath[e.k], e.o)
+
+		if e.o.Item.File == nil {
+			continue
+		}
+
+		seen := map[string]bool{}
+
+		for _, h := range e.o.Item.File.AllHashes() {
+			hk := hashKey(h)
+			if seen[hk] {
+				continue
+			}
+			seen[hk] = true
+			idx.byHash[hk] = append(idx.byHash[hk], e.o)
+		}
+	}
+
+	return nil
+}
+
+// hashKey returns the index key of the supplied hash entry. The algorithm of
+// unknown entries (e.g., imported from ISO SWID) is inferred from the length
+// of their value, so that they match the entries with an explicit algorithm.
+func hashKey(h HashEntry) string {
+	if h.HashAlgID == UnknownHashAlg {
+		// if inference fails, the entry keeps the unknown algorithm
+		_ = h.InferAlgID()
+	}
+
+	return strconv.FormatUint(h.HashAlgID, 10) + ";" + hex.EncodeToString(h.HashValue)
+}
+
+// LookupPath returns the directories and files declared at the supplied path,
+// in the order in which their tags were added. The path is matched against the
+// full path (root included) of the indexed items.
+func (idx *FileIndex) LookupPath(p string) ([]FileOwner, error) {
+	k, err := itemKey(idx.profile, ResolvedItem{Path: p})
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.byPath[k], nil
+}
+
+// LookupHash returns the files whose hashes include the supplied hash entry,
+// in the order in which their tags were added. Both the Hash of a file and the
+// entries of its Hashes extension are indexed, so that a file can be looked up
+// by any of the algorithms used to describe it. The algorithm of entries with
+// an unknown algorithm, whether indexed or looked up, is inferred from the
+// length of their value.
+func (idx *FileIndex) LookupHash(h HashEntry) []FileOwner {
+	return idx.byHash[hashKey(h)]
+}
+
+// Conflicts returns the paths claimed by files of two or more tags that
+// disagree on size or on the digests computed with the same algorithm, in the
+// order in which the paths were first indexed
+func (idx *FileIndex) Conflicts() []FileConflict {
+	var conflicts []FileConflict
+
+	for _, k := range idx.paths {
+		owners := idx.byPath[k]
+
+		var (
+			files  []FileOwner
+			reason string
+		)
+
+		for _, o := range owners {
+			if o.Item.File != nil {
+				files = append(files, o)
+			}
+		}
+
+		for i := 0; i < len(files) && reason == ""; i++ {
+			for j := i + 1; j < len(files); j++ {
+				if files[i].Tag == files[j].Tag {
+					continue
+				}
+				if status, r := compareFiles(files[i].Item.File, files[j].Item.File); status == ItemMismatched {
+					reason = r
+					break
+				}
+			}
+		}
+
+		if reason != "" {
+			conflicts = append(conflicts, FileConflict{
+				Path:   files[0].Item.FullPath(),
+				Owners: files,
+				Reason: reason,
+			})
+		}
+	}
+
+	return conflicts
+}
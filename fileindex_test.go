@@ -0,0 +1,162 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"crypto/sha512"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileIndex_LookupPath(t *testing.T) {
+	tag := testTagFromFS(t, testFS, "opt/acme", &PayloadOptions{Root: "/opt/acme"})
+
+	idx := NewFileIndex(nil)
+	require.Nil(t, idx.Add(tag))
+
+	owners, err := idx.LookupPath("/opt/acme/lib/librr.so")
+	require.Nil(t, err)
+	require.Len(t, owners, 1)
+	assert.Equal(t, tag, owners[0].Tag)
+	require.NotNil(t, owners[0].Item.File)
+	assert.Equal(t, "librr.so", owners[0].Item.File.FsName)
+	assert.Equal(t, "/opt/acme", owners[0].Item.Root)
+
+	owners, err = idx.LookupPath("/opt/acme/lib")
+	require.Nil(t, err)
+	require.Len(t, owners, 1)
+	assert.True(t, owners[0].Item.IsDir())
+
+	owners, err = idx.LookupPath("/opt/acme/lib/libcoyote.so")
+	require.Nil(t, err)
+	assert.Empty(t, owners)
+}
+
+func TestFileIndex_LookupHash(t *testing.T) {
+	tag := testTagFromFS(t, testFS, "opt/acme", &PayloadOptions{Root: "/opt/acme"})
+
+	other, err := NewTag("com.acme.rrd-lib", "ACME Roadrunner Library", "4.1.5")
+	require.Nil(t, err)
+
+	sum := sha512.Sum512([]byte("roadrunner library"))
+	f := File{
+		FileSystemItem: FileSystemItem{Root: "/usr", Location: "lib", FsName: "librr.so"},
+	}
+	f.Hashes = HashEntries{{HashAlgID: Sha512, HashValue: sum[:]}}
+
+	other.Payload = NewPayload()
+	require.Nil(t, other.Payload.AddFile(f))
+
+	idx := NewFileIndex(nil)
+	require.Nil(t, idx.Add(tag))
+	require.Nil(t, idx.Add(other))
+	require.Nil(t, idx.Add(&SoftwareIdentity{}))
+
+	owners := idx.LookupHash(*testSha256(t, "roadrunner library"))
+	require.Len(t, owners, 1)
+	assert.Equal(t, tag, owners[0].Tag)
+	assert.Equal(t, "/opt/acme/lib/librr.so", owners[0].Item.FullPath())
+
+	owners = idx.LookupHash(HashEntry{HashAlgID: Sha512, HashValue: sum[:]})
+	require.Len(t, owners, 1)
+	assert.Equal(t, other, owners[0].Tag)
+	assert.Equal(t, "/usr/lib/librr.so", owners[0].Item.FullPath())
+
+	assert.Empty(t, idx.LookupHash(*testSha256(t, "coyote")))
+	assert.Empty(t, idx.Conflicts())
+}
+
+func TestFileIndex_LookupHash_unknownAlg(t *testing.T) {
+	sha256 := testSha256(t, "roadrunner library")
+
+	tag, err := NewTag("com.acme.rrd-legacy", "ACME Roadrunner Detector", "4.1.5")
+	require.Nil(t, err)
+
+	// as imported from ISO SWID
+	tag.Payload = NewPayload()
+	require.Nil(t, tag.Payload.AddFile(File{
+		FileSystemItem: FileSystemItem{Root: "/usr", Location: "lib", FsName: "librr.so"},
+		Hash:           &HashEntry{HashAlgID: UnknownHashAlg, HashValue: sha256.HashValue},
+		FileExtension: FileExtension{
+			Hashes: HashEntries{
+				*sha256,
+				{HashAlgID: UnknownHashAlg, HashValue: []byte{0xde, 0xad}},
+			},
+		},
+	}))
+
+	idx := NewFileIndex(nil)
+	require.Nil(t, idx.Add(tag))
+
+	// indexed once under the inferred algorithm
+	owners := idx.LookupHash(*sha256)
+	require.Len(t, owners, 1)
+	assert.Equal(t, "/usr/lib/librr.so", owners[0].Item.FullPath())
+
+	owners = idx.LookupHash(HashEntry{HashAlgID: UnknownHashAlg, HashValue: sha256.HashValue})
+	assert.Len(t, owners, 1)
+
+	// values matching no algorithm are found by value
+	owners = idx.LookupHash(HashEntry{HashAlgID: UnknownHashAlg, HashValue: []byte{0xde, 0xad}})
+	assert.Len(t, owners, 1)
+}
+
+func TestFileIndex_Conflicts(t *testing.T) {
+	tag := testTagFromFS(t, testFS, "opt/acme", &PayloadOptions{Root: "/opt/acme"})
+
+	fsys := cloneMapFS(testFS)
+	fsys["opt/acme/lib/librr.so"].Data = []byte("coyote library!!!!")
+
+	impostor := testTagFromFS(t, fsys, "opt/acme", &PayloadOptions{Root: "/opt/acme"})
+	impostor.TagID = *NewTagID("com.coyote.rrd")
+
+	idx := NewFileIndex(nil)
+	require.Nil(t, idx.Add(tag))
+	require.Nil(t, idx.Add(impostor))
+
+	conflicts := idx.Conflicts()
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "/opt/acme/lib/librr.so", conflicts[0].Path)
+	assert.Equal(t, "sha-256 hash mismatch", conflicts[0].Reason)
+	require.Len(t, conflicts[0].Owners, 2)
+	assert.Equal(t, tag, conflicts[0].Owners[0].Tag)
+	assert.Equal(t, impostor, conflicts[0].Owners[1].Tag)
+
+	owners := idx.LookupHash(*testSha256(t, "roadrunner library"))
+	require.Len(t, owners, 1)
+	assert.Equal(t, tag, owners[0].Tag)
+}
+
+func TestFileIndex_Profile(t *testing.T) {
+	tag, err := NewTag("com.acme.rrd-win", "ACME Roadrunner Detector", "4.1.5")
+	require.Nil(t, err)
+
+	tag.Payload = NewPayload()
+	require.Nil(t, tag.Payload.AddFile(File{
+		FileSystemItem: FileSystemItem{Root: `%ProgramFiles%\ACME`, Location: "bin", FsName: "RRD.exe"},
+		Hash:           testSha256(t, "roadrunner detector"),
+	}))
+
+	idx := NewFileIndex(&FileIndexOptions{Profile: WindowsPathProfile(testWindowsVars)})
+	require.Nil(t, idx.Add(tag))
+
+	owners, err := idx.LookupPath(`c:\program files\acme\BIN\rrd.exe`)
+	require.Nil(t, err)
+	require.Len(t, owners, 1)
+	assert.Equal(t, "RRD.exe", owners[0].Item.File.FsName)
+
+	_, err = idx.LookupPath(`%WINDIR%\rrd.exe`)
+	assert.EqualError(t, err, `undefined variable "WINDIR"`)
+
+	bad, err := NewTag("com.acme.bad", "ACME Bad", "1.0")
+	require.Nil(t, err)
+
+	bad.Payload = NewPayload()
+	require.Nil(t, bad.Payload.AddFile(File{FileSystemItem: FileSystemItem{Root: "%TEMP%", FsName: "x"}}))
+
+	assert.EqualError(t, idx.Add(bad), `tag "com.acme.bad": %TEMP%/x: undefined variable "TEMP"`)
+	assert.EqualError(t, idx.Add(nil), "nil tag")
+}
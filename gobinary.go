@@ -0,0 +1,191 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"debug/buildinfo"
+	"errors"
+	"io"
+	"path"
+	"runtime/debug"
+	"strings"
+)
+
+// GoBinaryOptions controls how NewTagsFromGoBinary describes a Go executable
+type GoBinaryOptions struct {
+	// The algorithms in HashAlgIDs are used to hash the executable. If none
+	// is supplied, SHA-256 is used.
+	ImportOptions
+
+	// The distributor of the executable, recorded as tag creator unless one
+	// is supplied. One of Vendor and TagCreator is required.
+	Vendor string
+
+	// The path of the executable in the payload, e.g., "/usr/bin/rrd". If
+	// empty, the last element of the path of the main package is used, with
+	// no root.
+	Path string
+
+	// The version of the main module, used if the build info records none
+	// or "(devel)", as for builds in a working copy without version control
+	// stamping. Required in that case.
+	Version string
+}
+
+// goDevelVersion is the version recorded for main modules built in a working
+// copy
+const goDevelVersion = "(devel)"
+
+// NewTagsFromGoBinary reads the build info embedded in a Go executable of the
+// given size and returns a primary tag describing it, followed by one tag per
+// dependency module. The primary tag has:
+//
+//   - a package URL as tag ID, with the main module path and version, and the
+//     path of the main package within the module as subpath, e.g.,
+//     pkg:golang/github.com/acme/rrd@v1.2.0#cmd/rrd;
+//   - the distributor (tag creator unless one is supplied) as entity;
+//   - the main module path as product, the VCS revision and the module
+//     checksum (SourceChecksum) as software meta;
+//   - a "component" link for each dependency module compiled in the
+//     executable, referencing the package URL of the module version, e.g.,
+//     pkg:golang/github.com/fxamacker/cbor/v2@v2.3.0. Replaced modules are
+//     referenced through their replacement, unless it is a local directory.
+//     Unlike the "requires" links of the package importers, which reference
+//     packages installed separately, the modules are statically linked, and
+//     are thus components of the executable, as the archives bundled in a
+//     JAR;
+//   - a payload with the executable, with its size and hashes.
+//
+// The dependency tags, whose IDs are the referenced package URLs, only have
+// the tag creator as entity and the module checksum as software meta.
+func NewTagsFromGoBinary(r io.ReaderAt, size int64, opts *GoBinaryOptions) ([]*SoftwareIdentity, error) {
+	var o GoBinaryOptions
+
+	if opts != nil {
+		o = *opts
+	}
+
+	if len(o.HashAlgIDs) == 0 {
+		o.HashAlgIDs = []uint64{Sha256}
+	}
+
+	bi, err := buildinfo.Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes, err := computeHashEntries(o.HashAlgIDs, io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	var exe File
+
+	exe.Size = &size
+	exe.Hash = &hashes[0]
+	if len(hashes) > 1 {
+		exe.Hashes = hashes[1:]
+	}
+
+	return newGoBinaryTags(bi, exe, &o)
+}
+
+func newGoBinaryTags(bi *debug.BuildInfo, exe File, o *GoBinaryOptions) ([]*SoftwareIdentity, error) {
+	version := bi.Main.Version
+	if version == "" || version == goDevelVersion {
+		version = o.Version
+	}
+
+	if bi.Main.Path == "" {
+		return nil, errors.New("no main module in the build info")
+	}
+
+	if version == "" {
+		return nil, errors.New("no version for the main module: a development build requires a Version")
+	}
+
+	p := installedPackage{
+		purl:           goModuleURL(bi.Main.Path, version),
+		name:           bi.Path,
+		version:        version,
+		distributor:    o.Vendor,
+		sourceChecksum: bi.Main.Sum,
+	}
+
+	if sub := strings.TrimPrefix(bi.Path, bi.Main.Path+"/"); sub != bi.Path {
+		p.purl.Subpath = sub
+		p.product = bi.Main.Path
+	}
+
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" {
+			p.revision = s.Value
+		}
+	}
+
+	tag, err := p.newTag(o.TagCreator)
+	if err != nil {
+		return nil, err
+	}
+
+	exePath := o.Path
+	if exePath == "" {
+		exePath = path.Base(bi.Path)
+	}
+
+	if err := setPayload(tag, []PathEntry{{Path: exePath, File: exe}}); err != nil {
+		return nil, err
+	}
+
+	creator := o.TagCreator
+	if creator == nil {
+		creator, err = NewEntity(o.Vendor, RoleTagCreator)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tags := []*SoftwareIdentity{tag}
+
+	for _, d := range bi.Deps {
+		m := *d
+		if d.Replace != nil && d.Replace.Version != "" {
+			m = *d.Replace
+		}
+
+		dep := installedPackage{
+			purl:           goModuleURL(m.Path, m.Version),
+			name:           m.Path,
+			version:        m.Version,
+			sourceChecksum: m.Sum,
+		}
+
+		// statically linked: a component rather than a requirement
+		if err := addLink(tag, dep.purl.String(), RelComponent, UseRequired); err != nil {
+			return nil, err
+		}
+
+		t, err := dep.newTag(creator)
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, t)
+	}
+
+	return tags, nil
+}
+
+// goModuleURL returns the package URL of a module version, with the last
+// element of the module path as name
+func goModuleURL(modPath, version string) packageURL {
+	ns, name := path.Split(modPath)
+
+	return packageURL{
+		Type:      "golang",
+		Namespace: strings.TrimSuffix(ns, "/"),
+		Name:      name,
+		Version:   version,
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTagsFromGoBinary(t *testing.T) {
+	// the test executable embeds the build info of this module
+	exe, err := os.Executable()
+	require.Nil(t, err)
+
+	data, err := os.ReadFile(exe)
+	require.Nil(t, err)
+
+	tags, err := NewTagsFromGoBinary(bytes.NewReader(data), int64(len(data)), &GoBinaryOptions{
+		Vendor:  "Veraison",
+		Path:    "/usr/bin/swid.test",
+		Version: "v1.0.0",
+	})
+	require.Nil(t, err)
+
+	tag := tags[0]
+	assert.Equal(t, "pkg:golang/github.com/veraison/swid@v1.0.0", tag.TagID.String())
+	assert.Equal(t, "github.com/veraison/swid.test", tag.SoftwareName)
+	assert.Equal(t, "tagCreator distributor", tag.Entities[0].Roles.String())
+
+	require.Nil(t, tag.Payload.Walk(func(r ResolvedItem) error {
+		if !r.IsDir() {
+			assert.Equal(t, "/usr/bin/swid.test", r.FullPath())
+			assert.Equal(t, int64(len(data)), *r.File.Size)
+
+			sum := sha256.Sum256(data)
+			assert.Equal(t, sum[:], r.File.Hash.HashValue)
+		}
+		return nil
+	}))
+
+	// the checksum of each dependency is the one in go.sum
+	var cbor *SoftwareIdentity
+	for _, dep := range tags[1:] {
+		if dep.SoftwareName == "github.com/fxamacker/cbor/v2" {
+			cbor = dep
+		}
+	}
+	require.NotNil(t, cbor)
+
+	assert.Equal(t, "pkg:golang/github.com/fxamacker/cbor/v2@v2.3.0", cbor.TagID.String())
+	assert.Equal(t, "h1:aM45YGMctNakddNNAezPxDUpv38j44Abh+hifNuqXik=", (*cbor.SoftwareMetas)[0].SourceChecksum)
+	assert.Equal(t, "tagCreator", cbor.Entities[0].Roles.String())
+
+	var links []string
+	for _, l := range *tag.Links {
+		links = append(links, l.Rel.String()+" "+l.Href+" "+l.Use.String())
+	}
+	assert.Contains(t, links, "component pkg:golang/github.com/fxamacker/cbor/v2@v2.3.0 required")
+	assert.Len(t, links, len(tags)-1)
+}
+
+func testGoBuildInfo() *debug.BuildInfo {
+	return &debug.BuildInfo{
+		Path: "github.com/acme/rrd/cmd/rrd",
+		Main: debug.Module{Path: "github.com/acme/rrd", Version: "v1.2.0", Sum: "h1:main="},
+		Deps: []*debug.Module{
+			{Path: "github.com/acme/anvil", Version: "v0.3.1", Sum: "h1:anvil="},
+			{
+				Path: "github.com/acme/skates", Version: "v1.0.0",
+				Replace: &debug.Module{Path: "github.com/wile/skates", Version: "v1.0.1", Sum: "h1:skates="},
+			},
+			{
+				Path: "gopkg.in/rocket.v2", Version: "v2.0.0",
+				Replace: &debug.Module{Path: "../rocket"},
+			},
+		},
+		Settings: []debug.BuildSetting{
+			{Key: "-compiler", Value: "gc"},
+			{Key: "vcs.revision", Value: "9f266ea9e77c"},
+		},
+	}
+}
+
+func TestNewGoBinaryTags(t *testing.T) {
+	creator, err := NewEntity("ACME Build", RoleTagCreator)
+	require.Nil(t, err)
+
+	size := int64(1234)
+
+	tags, err := newGoBinaryTags(testGoBuildInfo(), File{Size: &size}, &GoBinaryOptions{
+		ImportOptions: ImportOptions{TagCreator: creator},
+		Vendor:        "ACME",
+	})
+	require.Nil(t, err)
+	require.Len(t, tags, 4)
+
+	tag := tags[0]
+	assert.Equal(t, "pkg:golang/github.com/acme/rrd@v1.2.0#cmd/rrd", tag.TagID.String())
+	assert.Equal(t, "github.com/acme/rrd/cmd/rrd", tag.SoftwareName)
+	assert.Equal(t, "v1.2.0", tag.SoftwareVersion)
+
+	require.Len(t, tag.Entities, 2)
+	assert.Equal(t, "ACME Build", tag.Entities[0].EntityName)
+	assert.Equal(t, "distributor", tag.Entities[1].Roles.String())
+
+	meta := (*tag.SoftwareMetas)[0]
+	assert.Equal(t, "github.com/acme/rrd", meta.Product)
+	assert.Equal(t, "9f266ea9e77c", meta.Revision)
+	assert.Equal(t, "h1:main=", meta.SourceChecksum)
+
+	var hrefs []string
+	for _, l := range *tag.Links {
+		assert.Equal(t, "component", l.Rel.String())
+		hrefs = append(hrefs, l.Href)
+	}
+	assert.Equal(t, []string{
+		"pkg:golang/github.com/acme/anvil@v0.3.1",
+		"pkg:golang/github.com/wile/skates@v1.0.1",
+		"pkg:golang/gopkg.in/rocket.v2@v2.0.0",
+	}, hrefs)
+
+	var paths []string
+	require.Nil(t, tag.Payload.Walk(func(r ResolvedItem) error {
+		paths = append(paths, r.FullPath())
+		return nil
+	}))
+	assert.Equal(t, []string{"rrd"}, paths)
+
+	for i, dep := range tags[1:] {
+		assert.Equal(t, hrefs[i], dep.TagID.String())
+		require.Len(t, dep.Entities, 1)
+		assert.Equal(t, "ACME Build", dep.Entities[0].EntityName)
+	}
+
+	skates := tags[2]
+	assert.Equal(t, "github.com/wile/skates", skates.SoftwareName)
+	assert.Equal(t, "h1:skates=", (*skates.SoftwareMetas)[0].SourceChecksum)
+
+	// local replacement: no checksum
+	assert.Nil(t, tags[3].SoftwareMetas)
+
+	// round trip, including the software meta extension
+	data, err := skates.ToCBOR()
+	require.Nil(t, err)
+
+	var decoded SoftwareIdentity
+	require.Nil(t, decoded.FromCBOR(data))
+	assert.Equal(t, "h1:skates=", (*decoded.SoftwareMetas)[0].SourceChecksum)
+
+	data, err = skates.ToJSON()
+	require.Nil(t, err)
+	assert.Contains(t, string(data), `"source-checksum":"h1:skates="`)
+}
+
+func TestNewGoBinaryTags_ko(t *testing.T) {
+	_, err := NewTagsFromGoBinary(strings.NewReader("MZ"), 2, nil)
+	assert.EqualError(t, err, "unrecognized file format")
+
+	bi := testGoBuildInfo()
+
+	_, err = newGoBinaryTags(bi, File{}, &GoBinaryOptions{})
+	assert.EqualError(t, err, "no tag creator: the package has no distributor")
+
+	bi.Main = debug.Module{Path: "github.com/acme/rrd", Version: "(devel)"}
+
+	_, err = newGoBinaryTags(bi, File{}, &GoBinaryOptions{Vendor: "ACME"})
+	assert.EqualError(t, err, "no version for the main module: a development build requires a Version")
+
+	tags, err := newGoBinaryTags(bi, File{}, &GoBinaryOptions{Vendor: "ACME", Version: "v1.0.0"})
+	require.Nil(t, err)
+	assert.Equal(t, "pkg:golang/github.com/acme/rrd@v1.0.0#cmd/rrd", tags[0].TagID.String())
+
+	bi.Main = debug.Module{}
+
+	_, err = newGoBinaryTags(bi, File{}, &GoBinaryOptions{Vendor: "ACME", Version: "v1.0.0"})
+	assert.EqualError(t, err, "no main module in the build info")
+}
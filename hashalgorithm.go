@@ -0,0 +1,308 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// HashAlgorithm describes a hash algorithm that can be used in a HashEntry
+type HashAlgorithm struct {
+	// The hash-alg-id. It should refer to an entry in the IANA "Named
+	// Information Hash Algorithm Registry", unless the algorithm is used for
+	// private or experimental purposes.
+	ID uint64
+
+	// The algorithm name used in the textual representation of hash entries
+	// (e.g., "sha-256"). Names are case insensitive.
+	Name string
+
+	// The length of the hash value in bytes.
+	ValueLen int
+
+	// An optional constructor used when computing hash values over content.
+	// If the hash produced by New is longer than ValueLen, its output is
+	// truncated to the leftmost ValueLen bytes (RFC 6920, Section 2).
+	New func() hash.Hash
+
+	// The optional XML namespace identifying the algorithm (see RFC 6931).
+	// ISO SWID tags use it to qualify the hash attributes of File elements,
+	// e.g., SHA256:hash="...", where the SHA256 prefix is bound to
+	// http://www.w3.org/2001/04/xmlenc#sha256.
+	XMLNamespace string
+}
+
+type hashAlgRegistry struct {
+	mu      sync.RWMutex
+	byID    map[uint64]HashAlgorithm
+	byName  map[string]uint64
+	byXMLNS map[string]uint64
+}
+
+var hashAlgs = hashAlgRegistry{
+	byID:    map[uint64]HashAlgorithm{},
+	byName:  map[string]uint64{},
+	byXMLNS: map[string]uint64{},
+}
+
+func init() {
+	for _, a := range []HashAlgorithm{
+		{ID: Sha256, Name: "sha-256", ValueLen: 32, New: sha256.New, XMLNamespace: "http://www.w3.org/2001/04/xmlenc#sha256"},
+		{ID: Sha256_128, Name: "sha-256-128", ValueLen: 16, New: sha256.New},
+		{ID: Sha256_120, Name: "sha-256-120", ValueLen: 15, New: sha256.New},
+		{ID: Sha256_96, Name: "sha-256-96", ValueLen: 12, New: sha256.New},
+		{ID: Sha256_64, Name: "sha-256-64", ValueLen: 8, New: sha256.New},
+		{ID: Sha256_32, Name: "sha-256-32", ValueLen: 4, New: sha256.New},
+		{ID: Sha384, Name: "sha-384", ValueLen: 48, New: sha512.New384, XMLNamespace: "http://www.w3.org/2001/04/xmldsig-more#sha384"},
+		{ID: Sha512, Name: "sha-512", ValueLen: 64, New: sha512.New, XMLNamespace: "http://www.w3.org/2001/04/xmlenc#sha512"},
+		// SHA-3 is not in the standard library: users can supply an
+		// implementation by re-registering these entries with New set
+		{ID: Sha3_224, Name: "sha3-224", ValueLen: 28, XMLNamespace: "http://www.w3.org/2007/05/xmldsig-more#sha3-224"},
+		{ID: Sha3_256, Name: "sha3-256", ValueLen: 32, XMLNamespace: "http://www.w3.org/2007/05/xmldsig-more#sha3-256"},
+		{ID: Sha3_384, Name: "sha3-384", ValueLen: 48, XMLNamespace: "http://www.w3.org/2007/05/xmldsig-more#sha3-384"},
+		{ID: Sha3_512, Name: "sha3-512", ValueLen: 64, XMLNamespace: "http://www.w3.org/2007/05/xmldsig-more#sha3-512"},
+	} {
+		if err := RegisterHashAlgorithm(a); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterHashAlgorithm adds the supplied algorithm to the set of hash
+// algorithms known to the package. Once registered, the algorithm can be
+// used when parsing, validating and computing hash entries. This can be used
+// to add algorithms registered with IANA after this package was built, or
+// private use and experimental algorithms.
+//
+// The ID, name and XML namespace must not clash with those of other
+// algorithms, and cannot be those of the unknown algorithm. Re-registering an
+// algorithm with the same ID, name and value length is allowed, and replaces
+// its constructor and XML namespace.
+func RegisterHashAlgorithm(a HashAlgorithm) error {
+	name := strings.ToLower(strings.TrimSpace(a.Name))
+
+	if a.ID == UnknownHashAlg || name == algUnknownName {
+		return errors.New("the unknown hash algorithm cannot be registered")
+	}
+
+	if name == "" || strings.ContainsAny(name, ";: \t") {
+		return fmt.Errorf("invalid hash algorithm name %q", a.Name)
+	}
+
+	if a.ValueLen <= 0 {
+		return fmt.Errorf("invalid value length %d for hash algorithm %s", a.ValueLen, name)
+	}
+
+	hashAlgs.mu.Lock()
+	defer hashAlgs.mu.Unlock()
+
+	if cur, ok := hashAlgs.byID[a.ID]; ok {
+		if cur.Name != name || cur.ValueLen != a.ValueLen {
+			return fmt.Errorf("hash algorithm %d already registered as %s", a.ID, cur.Name)
+		}
+	} else if id, ok := hashAlgs.byName[name]; ok {
+		return fmt.Errorf("hash algorithm %s already registered with ID %d", name, id)
+	}
+
+	if a.XMLNamespace != "" {
+		if id, ok := hashAlgs.byXMLNS[a.XMLNamespace]; ok && id != a.ID {
+			return fmt.Errorf("XML namespace %s already registered with ID %d", a.XMLNamespace, id)
+		}
+	}
+
+	if cur, ok := hashAlgs.byID[a.ID]; ok && cur.XMLNamespace != "" {
+		delete(hashAlgs.byXMLNS, cur.XMLNamespace)
+	}
+
+	a.Name = name
+
+	hashAlgs.byID[a.ID] = a
+	hashAlgs.byName[name] = a.ID
+
+	if a.XMLNamespace != "" {
+		hashAlgs.byXMLNS[a.XMLNamespace] = a.ID
+	}
+
+	return nil
+}
+
+// LookupHashAlgorithm returns the registered hash algorithm with the supplied
+// ID, if any
+func LookupHashAlgorithm(id uint64) (HashAlgorithm, bool) {
+	hashAlgs.mu.RLock()
+	defer hashAlgs.mu.RUnlock()
+
+	a, ok := hashAlgs.byID[id]
+
+	return a, ok
+}
+
+// LookupHashAlgorithmByName returns the registered hash algorithm with the
+// supplied (case insensitive) name, if any
+func LookupHashAlgorithmByName(name string) (HashAlgorithm, bool) {
+	hashAlgs.mu.RLock()
+	defer hashAlgs.mu.RUnlock()
+
+	id, ok := hashAlgs.byName[strings.ToLower(name)]
+	if !ok {
+		return HashAlgorithm{}, false
+	}
+
+	return hashAlgs.byID[id], true
+}
+
+// LookupHashAlgorithmByXMLNamespace returns the registered hash algorithm
+// identified by the supplied XML namespace, if any
+func LookupHashAlgorithmByXMLNamespace(ns string) (HashAlgorithm, bool) {
+	hashAlgs.mu.RLock()
+	defer hashAlgs.mu.RUnlock()
+
+	id, ok := hashAlgs.byXMLNS[ns]
+	if !ok {
+		return HashAlgorithm{}, false
+	}
+
+	return hashAlgs.byID[id], true
+}
+
+// HashAlgorithms returns all the registered hash algorithms sorted by ID
+func HashAlgorithms() []HashAlgorithm {
+	hashAlgs.mu.RLock()
+	defer hashAlgs.mu.RUnlock()
+
+	algs := make([]HashAlgorithm, 0, len(hashAlgs.byID))
+	for _, a := range hashAlgs.byID {
+		algs = append(algs, a)
+	}
+
+	sort.Slice(algs, func(i, j int) bool { return algs[i].ID < algs[j].ID })
+
+	return algs
+}
+
+// ComputeHashEntry hashes the content read from r using the algorithm
+// identified by algID and returns the resulting HashEntry. The algorithm must
+// be registered with a constructor.
+func ComputeHashEntry(algID uint64, r io.Reader) (HashEntry, error) {
+	hashes, err := computeHashEntries([]uint64{algID}, r)
+	if err != nil {
+		return HashEntry{}, err
+	}
+
+	return hashes[0], nil
+}
+
+// computeHashEntries hashes the content read from r in a single pass using all
+// the supplied algorithms
+func computeHashEntries(algIDs []uint64, r io.Reader) (HashEntries, error) {
+	mh, err := newMultiHasher(algIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(mh, r); err != nil {
+		return nil, err
+	}
+
+	return mh.Sum()
+}
+
+// multiHasher is a writer hashing the written content with several algorithms
+type multiHasher struct {
+	algs []HashAlgorithm
+	hs   []hash.Hash
+	w    io.Writer
+}
+
+func newMultiHasher(algIDs []uint64) (*multiHasher, error) {
+	if len(algIDs) == 0 {
+		return nil, errors.New("no hash algorithm specified")
+	}
+
+	mh := multiHasher{
+		algs: make([]HashAlgorithm, len(algIDs)),
+		hs:   make([]hash.Hash, len(algIDs)),
+	}
+
+	ws := make([]io.Writer, len(algIDs))
+
+	for i, algID := range algIDs {
+		a, ok := LookupHashAlgorithm(algID)
+		if !ok {
+			return nil, fmt.Errorf("unknown hash algorithm %d", algID)
+		}
+
+		if a.New == nil {
+			return nil, fmt.Errorf("no implementation available for hash algorithm %s", a.Name)
+		}
+
+		mh.algs[i], mh.hs[i] = a, a.New()
+		ws[i] = mh.hs[i]
+	}
+
+	mh.w = io.MultiWriter(ws...)
+
+	return &mh, nil
+}
+
+func (mh *multiHasher) Write(p []byte) (int, error) {
+	return mh.w.Write(p)
+}
+
+// Sum returns the hash entries of the content written so far, in the order in
+// which the algorithms were supplied
+func (mh *multiHasher) Sum() (HashEntries, error) {
+	hashes := make(HashEntries, len(mh.algs))
+
+	for i, a := range mh.algs {
+		sum := mh.hs[i].Sum(nil)
+		if len(sum) < a.ValueLen {
+			return nil, fmt.Errorf(
+				"hash algorithm %s implementation produced %d bytes, want %d",
+				a.Name, len(sum), a.ValueLen,
+			)
+		}
+
+		hashes[i] = HashEntry{
+			HashAlgID: a.ID,
+			HashValue: sum[:a.ValueLen],
+		}
+	}
+
+	return hashes, nil
+}
+
+const algUnknownName = "unknown"
+
+// algName returns the name of the supplied algorithm, including the unknown
+// algorithm
+func algName(id uint64) (string, bool) {
+	if id == UnknownHashAlg {
+		return algUnknownName, true
+	}
+
+	a, ok := LookupHashAlgorithm(id)
+
+	return a.Name, ok
+}
+
+// algIDFromName returns the ID of the named algorithm, including the unknown
+// algorithm
+func algIDFromName(name string) (uint64, bool) {
+	if strings.ToLower(name) == algUnknownName {
+		return UnknownHashAlg, true
+	}
+
+	a, ok := LookupHashAlgorithmByName(name)
+
+	return a.ID, ok
+}
@@ -0,0 +1,156 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"crypto/sha256"
+	"hash/fnv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// a private use algorithm, registered once for all the tests in the package
+const testPrivateHashAlg uint64 = 0x10000
+
+func init() {
+	if err := RegisterHashAlgorithm(HashAlgorithm{
+		ID:       testPrivateHashAlg,
+		Name:     "x-fnv-128a",
+		ValueLen: 16,
+		New:      fnv.New128a,
+	}); err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterHashAlgorithm_ko(t *testing.T) {
+	for _, tv := range []struct {
+		In          HashAlgorithm
+		ExpectedErr string
+	}{
+		{
+			In:          HashAlgorithm{ID: UnknownHashAlg, Name: "zero", ValueLen: 1},
+			ExpectedErr: "the unknown hash algorithm cannot be registered",
+		},
+		{
+			In:          HashAlgorithm{ID: 0x10001, Name: "Unknown", ValueLen: 1},
+			ExpectedErr: "the unknown hash algorithm cannot be registered",
+		},
+		{
+			In:          HashAlgorithm{ID: 0x10001, Name: "", ValueLen: 1},
+			ExpectedErr: `invalid hash algorithm name ""`,
+		},
+		{
+			In:          HashAlgorithm{ID: 0x10001, Name: "x;y", ValueLen: 1},
+			ExpectedErr: `invalid hash algorithm name "x;y"`,
+		},
+		{
+			In:          HashAlgorithm{ID: 0x10001, Name: "x-empty", ValueLen: 0},
+			ExpectedErr: "invalid value length 0 for hash algorithm x-empty",
+		},
+		{
+			In:          HashAlgorithm{ID: Sha256, Name: "x-sha-256", ValueLen: 32},
+			ExpectedErr: "hash algorithm 1 already registered as sha-256",
+		},
+		{
+			In:          HashAlgorithm{ID: 0x10001, Name: "SHA-256", ValueLen: 32},
+			ExpectedErr: "hash algorithm sha-256 already registered with ID 1",
+		},
+		{
+			In:          HashAlgorithm{ID: 0x10001, Name: "x-sha-256", ValueLen: 32, XMLNamespace: "http://www.w3.org/2001/04/xmlenc#sha256"},
+			ExpectedErr: "XML namespace http://www.w3.org/2001/04/xmlenc#sha256 already registered with ID 1",
+		},
+	} {
+		assert.EqualError(t, RegisterHashAlgorithm(tv.In), tv.ExpectedErr)
+	}
+}
+
+func TestRegisterHashAlgorithm_replace_constructor(t *testing.T) {
+	a, ok := LookupHashAlgorithm(Sha3_256)
+	require.True(t, ok)
+	assert.Nil(t, a.New)
+
+	_, err := ComputeHashEntry(Sha3_256, strings.NewReader("Hello World!"))
+	assert.EqualError(t, err, "no implementation available for hash algorithm sha3-256")
+
+	// a fake implementation with the right output length
+	require.Nil(t, RegisterHashAlgorithm(HashAlgorithm{
+		ID: Sha3_256, Name: "sha3-256", ValueLen: 32, New: sha256.New,
+	}))
+	defer func() { _ = RegisterHashAlgorithm(a) }()
+
+	h, err := ComputeHashEntry(Sha3_256, strings.NewReader("Hello World!"))
+	require.Nil(t, err)
+	assert.Equal(t, Sha3_256, h.HashAlgID)
+	assert.Len(t, h.HashValue, 32)
+}
+
+func TestLookupHashAlgorithmByName(t *testing.T) {
+	a, ok := LookupHashAlgorithmByName("X-FNV-128A")
+	require.True(t, ok)
+	assert.Equal(t, testPrivateHashAlg, a.ID)
+	assert.Equal(t, "x-fnv-128a", a.Name)
+
+	_, ok = LookupHashAlgorithmByName("unknown")
+	assert.False(t, ok)
+}
+
+func TestHashAlgorithms(t *testing.T) {
+	algs := HashAlgorithms()
+
+	require.True(t, len(algs) >= 12)
+	assert.Equal(t, "sha-256", algs[0].Name)
+	assert.Equal(t, "sha3-512", algs[11].Name)
+}
+
+func TestComputeHashEntry(t *testing.T) {
+	for _, tv := range []struct {
+		Alg      uint64
+		Expected string
+	}{
+		{
+			Alg:      Sha256,
+			Expected: "7f83b1657ff1fc53b92dc18148a1d65dfc2d4b1fa3d677284addd200126d9069",
+		},
+		{
+			Alg:      Sha256_32,
+			Expected: "7f83b165",
+		},
+		{
+			Alg:      Sha384,
+			Expected: "bfd76c0ebbd006fee583410547c1887b0292be76d582d96c242d2a792723e3fd6fd061f9d5cfd13b8f961358e6adba4a",
+		},
+	} {
+		h, err := ComputeHashEntry(tv.Alg, strings.NewReader("Hello World!"))
+		require.Nil(t, err)
+		assert.Equal(t, tv.Alg, h.HashAlgID)
+		assert.Equal(t, MustHexDecode(t, tv.Expected), h.HashValue)
+		assert.Nil(t, ValidHashEntry(h.HashAlgID, h.HashValue))
+	}
+
+	_, err := ComputeHashEntry(1024, strings.NewReader("Hello World!"))
+	assert.EqualError(t, err, "unknown hash algorithm 1024")
+}
+
+func TestHashEntry_private_algorithm(t *testing.T) {
+	h, err := ComputeHashEntry(testPrivateHashAlg, strings.NewReader("Hello World!"))
+	require.Nil(t, err)
+	assert.Len(t, h.HashValue, 16)
+
+	j, err := h.MarshalJSON()
+	require.Nil(t, err)
+
+	actual, err := ParseHashEntry(strings.Trim(string(j), `"`))
+	require.Nil(t, err)
+	assert.Equal(t, h, actual)
+
+	data := []byte(`{"tag-id":"example.acme.roadrunner-sw-v1-0-0","tag-version":0,"software-name":"Roadrunner software","entity":[{"entity-name":"ACME Ltd","role":"tagCreator"}],"payload":{"file":[{"fs-name":"roadrunner.bin","hash":` + string(j) + `}]}}`)
+
+	var tag SoftwareIdentity
+	require.Nil(t, tag.FromJSON(data))
+	assert.Equal(t, h, *(*tag.Payload.Files)[0].Hash)
+}
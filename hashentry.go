@@ -5,6 +5,7 @@ package swid
 
 import (
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
@@ -31,8 +32,14 @@ type HashEntry struct {
 	HashValue []byte
 }
 
+// UnknownHashAlg is the hash-alg-id to be used when the hash algorithm is not
+// known, e.g., when converting from ISO SWID tags
+const UnknownHashAlg uint64 = 0
+
 // Named Information Hash Algorithm Registry
 // https://www.iana.org/assignments/named-information/named-information.xhtml#hash-alg
+//
+// Further algorithms can be added using RegisterHashAlgorithm
 const (
 	Sha256 uint64 = (iota + 1)
 	Sha256_128
@@ -49,49 +56,15 @@ const (
 )
 
 var (
-	algToValueLen = map[uint64]int{
-		Sha256:     32,
-		Sha256_128: 16,
-		Sha256_120: 15,
-		Sha256_96:  12,
-		Sha256_64:  8,
-		Sha256_32:  4,
-		Sha384:     48,
-		Sha512:     64,
-		Sha3_224:   28,
-		Sha3_256:   32,
-		Sha3_384:   48,
-		Sha3_512:   64,
-	}
-
-	algToString = map[uint64]string{
-		Sha256:     "sha-256",
-		Sha256_128: "sha-256-128",
-		Sha256_120: "sha-256-120",
-		Sha256_96:  "sha-256-96",
-		Sha256_64:  "sha-256-64",
-		Sha256_32:  "sha-256-32",
-		Sha384:     "sha-384",
-		Sha512:     "sha-512",
-		Sha3_224:   "sha3-224",
-		Sha3_256:   "sha3-256",
-		Sha3_384:   "sha3-384",
-		Sha3_512:   "sha3-512",
-	}
-
-	stringToAlg = map[string]uint64{
-		"sha-256":     Sha256,
-		"sha-256-128": Sha256_128,
-		"sha-256-120": Sha256_120,
-		"sha-256-96":  Sha256_96,
-		"sha-256-64":  Sha256_64,
-		"sha-256-32":  Sha256_32,
-		"sha-384":     Sha384,
-		"sha-512":     Sha512,
-		"sha3-224":    Sha3_224,
-		"sha3-256":    Sha3_256,
-		"sha3-384":    Sha3_384,
-		"sha3-512":    Sha3_512,
+	// the most likely algorithm for a given hash value length. Where more
+	// than one algorithm produces values of the same length, SHA-2 is
+	// preferred over SHA-3. Truncated SHA-256 variants are never inferred
+	// since their lengths clash with those of legacy algorithms (e.g., MD5).
+	valueLenToAlg = map[int]uint64{
+		28: Sha3_224,
+		32: Sha256,
+		48: Sha384,
+		64: Sha512,
 	}
 )
 
@@ -111,16 +84,17 @@ func (h *HashEntry) Set(algID uint64, value []byte) error {
 // algoirthm ID. If the name does not correspond to a known algorithm, 0 is
 // returned.
 func AlgIDFromString(name string) uint64 {
-	alg, ok := stringToAlg[name]
-	if !ok {
+	a, ok := LookupHashAlgorithmByName(name)
+	if !ok || a.Name != name {
 		return 0
 	}
 
-	return alg
+	return a.ID
 }
 
 // ParseHashEntry parses a string representation (e.g as produced when
-// marshaled to JSON) into a HashEntry.
+// marshaled to JSON) into a HashEntry. RFC 6920 "ni" and "nih" URIs are also
+// accepted.
 func ParseHashEntry(v string) (HashEntry, error) {
 	var he HashEntry
 	if err := he.codify(v); err != nil {
@@ -130,23 +104,64 @@ func ParseHashEntry(v string) (HashEntry, error) {
 	return he, nil
 }
 
+// AlgIDFromValueLen returns the identifier of the most likely hash algorithm
+// for a hash value of the supplied length. If no algorithm can be inferred,
+// UnknownHashAlg is returned.
+func AlgIDFromValueLen(l int) uint64 {
+	alg, ok := valueLenToAlg[l]
+	if !ok {
+		return UnknownHashAlg
+	}
+
+	return alg
+}
+
 // ValidHashEntry checks whether the supplied algorithm identifier and hash
-// value are a coherent pair
+// value are a coherent pair. Since the unknown algorithm (hash-alg-id 0) has
+// no associated length, any non-empty value is accepted in that case.
 func ValidHashEntry(algID uint64, value []byte) error {
-	wantLen, ok := algToValueLen[algID]
+	if algID == UnknownHashAlg {
+		if len(value) == 0 {
+			return fmt.Errorf("empty hash value")
+		}
+		return nil
+	}
+
+	a, ok := LookupHashAlgorithm(algID)
 	if !ok {
 		return fmt.Errorf("unknown hash algorithm %d", algID)
 	}
 
+	wantLen := a.ValueLen
 	gotLen := len(value)
 
 	if wantLen != gotLen {
 		return fmt.Errorf(
 			"length mismatch for hash algorithm %s: want %d bytes, got %d",
-			algToString[algID], wantLen, gotLen,
+			a.Name, wantLen, gotLen,
+		)
+	}
+
+	return nil
+}
+
+// InferAlgID replaces an unknown hash-alg-id in the HashEntry receiver with the
+// identifier of the most likely algorithm given the length of its hash value.
+// It is a no-op if the algorithm is already known.
+func (h *HashEntry) InferAlgID() error {
+	if h.HashAlgID != UnknownHashAlg {
+		return nil
+	}
+
+	alg := AlgIDFromValueLen(len(h.HashValue))
+	if alg == UnknownHashAlg {
+		return fmt.Errorf(
+			"cannot infer hash algorithm from a %d bytes value", len(h.HashValue),
 		)
 	}
 
+	h.HashAlgID = alg
+
 	return nil
 }
 
@@ -154,7 +169,7 @@ func ValidHashEntry(algID uint64, value []byte) error {
 // consists of the algorithm name and the base64-encoded hash value separated by
 // a semicolon.
 func (h HashEntry) String() string {
-	sAlg, ok := algToString[h.HashAlgID]
+	sAlg, ok := algName(h.HashAlgID)
 	if !ok {
 		sAlg = "unknown-alg"
 	}
@@ -168,7 +183,7 @@ func (h HashEntry) String() string {
 }
 
 func (h HashEntry) stringify() (string, error) {
-	sAlg, ok := algToString[h.HashAlgID]
+	sAlg, ok := algName(h.HashAlgID)
 	if !ok {
 		return "", fmt.Errorf("unknown hash algorithm ID %d", h.HashAlgID)
 	}
@@ -184,6 +199,16 @@ func (h HashEntry) stringify() (string, error) {
 }
 
 func (h *HashEntry) codify(v string) error {
+	// RFC 6920 ni and nih URIs are accepted as an alternative representation
+	if isNamedInformation(v) {
+		he, err := ParseNamedInformation(v)
+		if err != nil {
+			return err
+		}
+		*h = he
+		return nil
+	}
+
 	// expected format is <hash-alg-string>;<hash-value>
 	s := strings.Split(v, ";")
 
@@ -205,7 +230,7 @@ func (h *HashEntry) codify(v string) error {
 		return fmt.Errorf("bad format: expecting <hash-alg-string>;<hash-value>")
 	}
 
-	algID, ok := stringToAlg[strings.ToLower(sAlg)]
+	algID, ok := algIDFromName(sAlg)
 	if !ok {
 		return fmt.Errorf("unknown hash algorithm %s", sAlg)
 	}
@@ -225,7 +250,7 @@ func (h *HashEntry) codify(v string) error {
 // AlgIDToString provides a conversion from the algorithm ID to the string
 // representation of the algorithm
 func (h *HashEntry) AlgIDToString() string {
-	sAlg, ok := algToString[h.HashAlgID]
+	sAlg, ok := algName(h.HashAlgID)
 	if !ok {
 		return fmt.Sprintf("alg-id(%d)", h.HashAlgID)
 	}
@@ -271,3 +296,142 @@ func (h HashEntry) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
 func (h *HashEntry) UnmarshalXMLAttr(attr xml.Attr) error {
 	return h.codify(attr.Value)
 }
+
+// HashEntries models a collection of hash-entry
+type HashEntries []HashEntry
+
+// MarshalXMLAttr encodes the HashEntries receiver as a space separated list of
+// <hash-alg-string>;<hash-value> items
+func (ha HashEntries) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	items := make([]string, len(ha))
+
+	for i, h := range ha {
+		s, err := h.stringify()
+		if err != nil {
+			return xml.Attr{}, err
+		}
+		items[i] = s
+	}
+
+	return xml.Attr{Name: name, Value: strings.Join(items, " ")}, nil
+}
+
+// UnmarshalXMLAttr decodes a space separated list of hash entries into the
+// HashEntries receiver
+func (ha *HashEntries) UnmarshalXMLAttr(attr xml.Attr) error {
+	var hashes HashEntries
+
+	for _, v := range strings.Fields(attr.Value) {
+		var h HashEntry
+
+		if err := h.codify(v); err != nil {
+			return err
+		}
+
+		hashes = append(hashes, h)
+	}
+
+	*ha = hashes
+
+	return nil
+}
+
+// toXMLAttrs returns the ISO SWID namespace-qualified hash attributes for the
+// HashEntries receiver, preceded by the relevant namespace declarations. Since
+// not all algorithms have an XML namespace (e.g., the truncated SHA-256
+// variants, or the unknown algorithm), the entries using those are listed in an
+// unqualified "hashes" attribute, as for links. The optional primary entry
+// (i.e., the File's Hash) is only used to detect duplicate algorithms.
+func (ha HashEntries) toXMLAttrs(primary *HashEntry) ([]xml.Attr, error) {
+	var (
+		decls, attrs []xml.Attr
+		others       HashEntries
+	)
+
+	seen := map[uint64]bool{}
+
+	if primary != nil && primary.HashAlgID != UnknownHashAlg {
+		seen[primary.HashAlgID] = true
+	}
+
+	for _, h := range ha {
+		if len(h.HashValue) == 0 {
+			return nil, fmt.Errorf("empty hash value")
+		}
+
+		// distinct digests may share the unknown algorithm
+		if h.HashAlgID == UnknownHashAlg {
+			others = append(others, h)
+			continue
+		}
+
+		a, ok := LookupHashAlgorithm(h.HashAlgID)
+		if !ok {
+			return nil, fmt.Errorf("unknown hash algorithm ID %d", h.HashAlgID)
+		}
+
+		if seen[a.ID] {
+			return nil, fmt.Errorf("duplicate hash for algorithm %s", a.Name)
+		}
+		seen[a.ID] = true
+
+		if a.XMLNamespace == "" {
+			others = append(others, h)
+			continue
+		}
+
+		prefix := xmlHashPrefix(a.Name)
+
+		decls = append(decls, xml.Attr{
+			Name:  xml.Name{Local: "xmlns:" + prefix},
+			Value: a.XMLNamespace,
+		})
+
+		attrs = append(attrs, xml.Attr{
+			Name:  xml.Name{Local: prefix + ":hash"},
+			Value: hex.EncodeToString(h.HashValue),
+		})
+	}
+
+	if len(others) > 0 {
+		attr, err := others.MarshalXMLAttr(xml.Name{Local: "hashes"})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+
+	return append(decls, attrs...), nil
+}
+
+// xmlHashPrefix returns the namespace prefix conventionally used for the
+// supplied algorithm in ISO SWID tags, e.g., SHA256 for sha-256
+func xmlHashPrefix(algName string) string {
+	p := strings.Replace(strings.ToUpper(algName), "SHA-", "SHA", 1)
+
+	if p[0] < 'A' || p[0] > 'Z' {
+		p = "H" + p
+	}
+
+	return p
+}
+
+func hashEntryFromXMLNamespacedAttr(attr xml.Attr) (HashEntry, error) {
+	a, ok := LookupHashAlgorithmByXMLNamespace(attr.Name.Space)
+	if !ok {
+		return HashEntry{}, fmt.Errorf("unknown hash algorithm namespace %s", attr.Name.Space)
+	}
+
+	value, err := hex.DecodeString(strings.TrimSpace(attr.Value))
+	if err != nil {
+		return HashEntry{}, fmt.Errorf("decoding %s hash: %w", a.Name, err)
+	}
+
+	var h HashEntry
+
+	if err := h.Set(a.ID, value); err != nil {
+		return HashEntry{}, err
+	}
+
+	return h, nil
+}
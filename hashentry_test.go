@@ -4,10 +4,12 @@
 package swid
 
 import (
+	"encoding/xml"
 	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHashEntry_UnmarshalJSON(t *testing.T) {
@@ -377,9 +379,88 @@ func TestHashEntry_Set_mismatched_input(t *testing.T) {
 }
 
 func TestHashEntry_ValidHashEntry_unknown_algo(t *testing.T) {
-	var unknownAlgID uint64 = 0
-	err := ValidHashEntry(unknownAlgID, []byte{})
-	assert.EqualError(t, err, "unknown hash algorithm 0")
+	err := ValidHashEntry(UnknownHashAlg, []byte{0xde, 0xad, 0xbe, 0xef})
+	assert.Nil(t, err)
+
+	err = ValidHashEntry(UnknownHashAlg, []byte{})
+	assert.EqualError(t, err, "empty hash value")
+
+	err = ValidHashEntry(1024, []byte{0xde, 0xad, 0xbe, 0xef})
+	assert.EqualError(t, err, "unknown hash algorithm 1024")
+}
+
+func TestHashEntry_unknown_algo_roundtrip(t *testing.T) {
+	tv := HashEntry{
+		HashAlgID: UnknownHashAlg,
+		HashValue: []byte{0xde, 0xad, 0xbe, 0xef},
+	}
+
+	j, err := tv.MarshalJSON()
+	require.Nil(t, err)
+	assert.JSONEq(t, `"unknown;3q2+7w=="`, string(j))
+
+	var fromJSON HashEntry
+	require.Nil(t, fromJSON.UnmarshalJSON(j))
+	assert.Equal(t, tv, fromJSON)
+
+	x, err := tv.MarshalXMLAttr(xml.Name{Local: "hash"})
+	require.Nil(t, err)
+	assert.Equal(t, "unknown;3q2+7w==", x.Value)
+
+	var fromXML HashEntry
+	require.Nil(t, fromXML.UnmarshalXMLAttr(x))
+	assert.Equal(t, tv, fromXML)
+
+	/*
+		82               # array(2)
+		   00            # unsigned(0)
+		   44            # bytes(4)
+		      deadbeef   # "\xDE\xAD\xBE\xEF"
+	*/
+	expectedCBOR := []byte{0x82, 0x00, 0x44, 0xde, 0xad, 0xbe, 0xef}
+
+	roundTripper(t, tv, expectedCBOR)
+}
+
+func TestAlgIDFromValueLen(t *testing.T) {
+	for _, tv := range []struct {
+		In       int
+		Expected uint64
+	}{
+		{In: 28, Expected: Sha3_224},
+		{In: 32, Expected: Sha256},
+		{In: 48, Expected: Sha384},
+		{In: 64, Expected: Sha512},
+		{In: 16, Expected: UnknownHashAlg},
+		{In: 20, Expected: UnknownHashAlg},
+		{In: 0, Expected: UnknownHashAlg},
+	} {
+		assert.Equal(t, tv.Expected, AlgIDFromValueLen(tv.In))
+	}
+}
+
+func TestHashEntry_InferAlgID(t *testing.T) {
+	h := HashEntry{
+		HashAlgID: UnknownHashAlg,
+		HashValue: MustHexDecode(t, "e45b72f5c0c0b572db4d8d3ab7e97f368ff74e62347a824decb67a84e5224d75"),
+	}
+	assert.Nil(t, h.InferAlgID())
+	assert.Equal(t, Sha256, h.HashAlgID)
+
+	// known algorithms are left untouched
+	h = HashEntry{
+		HashAlgID: Sha3_256,
+		HashValue: MustHexDecode(t, "e45b72f5c0c0b572db4d8d3ab7e97f368ff74e62347a824decb67a84e5224d75"),
+	}
+	assert.Nil(t, h.InferAlgID())
+	assert.Equal(t, Sha3_256, h.HashAlgID)
+
+	h = HashEntry{
+		HashAlgID: UnknownHashAlg,
+		HashValue: []byte{0xde, 0xad, 0xbe, 0xef},
+	}
+	assert.EqualError(t, h.InferAlgID(), "cannot infer hash algorithm from a 4 bytes value")
+	assert.Equal(t, UnknownHashAlg, h.HashAlgID)
 }
 
 func TestParseHashEntry(t *testing.T) {
@@ -431,6 +512,10 @@ func TestAlgFromString(t *testing.T) {
 			In:       "sha-256",
 			Expected: 1,
 		},
+		{
+			In:       "unknown",
+			Expected: UnknownHashAlg,
+		},
 		{
 			In:       "foo",
 			Expected: 0,
@@ -0,0 +1,239 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// IMA templates supported by ParseIMALog
+const (
+	IMATemplateNG  = "ima-ng"
+	IMATemplateSig = "ima-sig"
+)
+
+// IMAEntry is an entry of the Linux IMA runtime measurement log, as found in
+// /sys/kernel/security/ima/ascii_runtime_measurements
+type IMAEntry struct {
+	// The PCR extended with the template hash
+	PCR int
+
+	// The hash of the template data
+	TemplateHash []byte
+
+	// The name of the template, either IMATemplateNG or IMATemplateSig
+	Template string
+
+	// The digest of the content of the measured file. If the digest
+	// algorithm is not in the hash algorithm registry, its ID is
+	// UnknownHashAlg.
+	Digest HashEntry
+
+	// The name of the digest algorithm as found in the log (e.g., "sha256")
+	DigestAlg string
+
+	// The path of the measured file, or a pseudo file name such as
+	// "boot_aggregate"
+	Path string
+
+	// The file signature (ima-sig template only), if any
+	Signature []byte
+}
+
+// IsViolation returns true if the entry records a measurement violation
+// (e.g., a file opened for writing while being measured). Violations are
+// logged with a template hash made of zeros.
+func (e IMAEntry) IsViolation() bool {
+	return len(bytes.Trim(e.TemplateHash, "\x00")) == 0
+}
+
+// IMA names of the digest algorithms whose name differs in the hash algorithm
+// registry. Other names (e.g., "sha3-256") are looked up in the registry as
+// they are.
+var imaAlgNames = map[string]string{
+	"sha256": "sha-256",
+	"sha384": "sha-384",
+	"sha512": "sha-512",
+}
+
+// ParseIMALog parses an IMA runtime measurement log in ASCII format, with
+// entries using the ima-ng or ima-sig templates:
+//
+//	10 <template-hash> ima-ng <alg>:<digest> <path>
+//	10 <template-hash> ima-sig <alg>:<digest> <path> [<signature>]
+//
+// Digest algorithms are mapped to the hash algorithm registry. Digests whose
+// algorithm is not registered (e.g., sha1) are recorded with the unknown hash
+// algorithm, so that they do not take part in comparisons unless an
+// implementation is registered under the IMA name. Empty lines are ignored.
+func ParseIMALog(r io.Reader) ([]IMAEntry, error) {
+	var entries []IMAEntry
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		e, err := parseIMAEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		entries = append(entries, *e)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func parseIMAEntry(line string) (*IMAEntry, error) {
+	// the path is the last of the common fields and may contain spaces
+	f := strings.SplitN(line, " ", 5)
+	if len(f) != 5 || f[4] == "" {
+		return nil, fmt.Errorf("bad format: expecting <pcr> <template-hash> <template> <digest> <path>")
+	}
+
+	pcr, err := strconv.ParseUint(f[0], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("bad PCR %q", f[0])
+	}
+
+	e := IMAEntry{PCR: int(pcr), Template: f[2], Path: f[4]}
+
+	if e.TemplateHash, err = hex.DecodeString(f[1]); err != nil {
+		return nil, fmt.Errorf("bad template hash: %w", err)
+	}
+
+	switch e.Template {
+	case IMATemplateNG:
+	case IMATemplateSig:
+		// the signature follows the path, and is empty if the file is not
+		// signed
+		if i := strings.LastIndexByte(e.Path, ' '); i >= 0 {
+			sig, err := hex.DecodeString(e.Path[i+1:])
+			if err == nil {
+				e.Path = e.Path[:i]
+				if len(sig) != 0 {
+					e.Signature = sig
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported template %q", e.Template)
+	}
+
+	if e.DigestAlg, e.Digest, err = parseIMADigest(f[3]); err != nil {
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func parseIMADigest(v string) (string, HashEntry, error) {
+	s := strings.SplitN(v, ":", 2)
+	if len(s) != 2 || s[0] == "" {
+		return "", HashEntry{}, fmt.Errorf("bad digest %q: expecting <alg>:<hex-value>", v)
+	}
+
+	value, err := hex.DecodeString(s[1])
+	if err != nil {
+		return "", HashEntry{}, fmt.Errorf("bad digest value: %w", err)
+	}
+
+	name := s[0]
+	if n, ok := imaAlgNames[name]; ok {
+		name = n
+	}
+
+	algID := UnknownHashAlg
+	if a, ok := LookupHashAlgorithmByName(name); ok {
+		algID = a.ID
+	}
+
+	var h HashEntry
+
+	if err := h.Set(algID, value); err != nil {
+		return "", HashEntry{}, err
+	}
+
+	return s[0], h, nil
+}
+
+// AddIMAEntries adds the files measured in the supplied IMA log entries to the
+// Evidence receiver. Each file is added with the "/" root, its parent
+// directories as location, and the measured digest as hash. Entries that do
+// not refer to an absolute path (e.g., "boot_aggregate") and violations are
+// skipped, as are repeated measurements of a file with the same digest.
+func (e *Evidence) AddIMAEntries(entries []IMAEntry) error {
+	seen := map[string]bool{}
+
+	for _, ie := range entries {
+		p := path.Clean(ie.Path)
+
+		if !path.IsAbs(p) || p == "/" || ie.IsViolation() {
+			continue
+		}
+
+		k := p + ";" + ie.Digest.String()
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		h := ie.Digest
+
+		f := File{
+			FileSystemItem: FileSystemItem{
+				Root:     "/",
+				Location: strings.TrimPrefix(path.Dir(p), "/"),
+				FsName:   path.Base(p),
+			},
+			Hash: &h,
+		}
+
+		if err := e.AddFile(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AppraiseIMALog parses the IMA runtime measurement log read from r into an
+// Evidence, and appraises it against the supplied reference tags. Reference
+// files are matched by path and digest: as IMA does not record file sizes,
+// reference files are compared using their hashes only.
+func AppraiseIMALog(r io.Reader, refs []*SoftwareIdentity, opts *AppraisalOptions) (*Evidence, *Appraisal, error) {
+	entries, err := ParseIMALog(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ev := NewEvidence("")
+
+	if err := ev.AddIMAEntries(entries); err != nil {
+		return nil, nil, err
+	}
+
+	res, err := Appraise(ev, refs, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ev, res, nil
+}
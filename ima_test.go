@@ -0,0 +1,174 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIMATemplateHash = "91f34b5c671d73504b274a919661cf80dab1e127"
+
+func testIMALog(t *testing.T) string {
+	digest := func(data string) string {
+		return "sha256:" + hex.EncodeToString(testSha256(t, data).HashValue)
+	}
+
+	zeros := strings.Repeat("0", 40)
+
+	return strings.Join([]string{
+		"10 " + testIMATemplateHash + " ima-ng " + digest("aggregate") + " boot_aggregate",
+		"10 " + testIMATemplateHash + " ima-ng " + digest("roadrunner detector") + " /opt/acme/bin/rrdetector",
+		"10 " + testIMATemplateHash + " ima-ng " + digest("coyote library") + " /opt/acme/lib/librr.so",
+		"10 " + zeros + " ima-ng sha256:" + strings.Repeat("0", 64) + " /var/log/rrdetector.log",
+		"10 " + testIMATemplateHash + " ima-ng sha1:" + testIMATemplateHash + " /usr/bin/ls",
+		"",
+		"10 " + testIMATemplateHash + " ima-ng " + digest("roadrunner detector") + " /opt/acme/bin/rrdetector",
+		"10 " + testIMATemplateHash + " ima-sig " + digest("beep beep") + " /opt/acme/share/doc/README 030202531f402500",
+		"10 " + testIMATemplateHash + " ima-sig " + digest("MIT") + " /opt/acme/share/doc/LICENSE.md ",
+		"10 " + testIMATemplateHash + " ima-ng " + digest("sensitivity=high") + " /opt/acme/etc/rr detector.conf\r",
+	}, "\n")
+}
+
+func TestParseIMALog(t *testing.T) {
+	entries, err := ParseIMALog(strings.NewReader(testIMALog(t)))
+	require.Nil(t, err)
+	require.Len(t, entries, 9)
+
+	e := entries[1]
+	assert.Equal(t, 10, e.PCR)
+	assert.Equal(t, IMATemplateNG, e.Template)
+	assert.Equal(t, MustHexDecode(t, testIMATemplateHash), e.TemplateHash)
+	assert.Equal(t, *testSha256(t, "roadrunner detector"), e.Digest)
+	assert.Equal(t, "sha256", e.DigestAlg)
+	assert.Equal(t, "/opt/acme/bin/rrdetector", e.Path)
+	assert.False(t, e.IsViolation())
+	assert.Nil(t, e.Signature)
+
+	assert.True(t, entries[3].IsViolation())
+
+	e = entries[4]
+	assert.Equal(t, "sha1", e.DigestAlg)
+	assert.Equal(t, UnknownHashAlg, e.Digest.HashAlgID)
+
+	e = entries[6]
+	assert.Equal(t, IMATemplateSig, e.Template)
+	assert.Equal(t, "/opt/acme/share/doc/README", e.Path)
+	assert.Equal(t, MustHexDecode(t, "030202531f402500"), e.Signature)
+
+	e = entries[7]
+	assert.Equal(t, "/opt/acme/share/doc/LICENSE.md", e.Path)
+	assert.Nil(t, e.Signature)
+
+	assert.Equal(t, "/opt/acme/etc/rr detector.conf", entries[8].Path)
+}
+
+func TestParseIMALog_ko(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+
+	for _, tv := range []struct {
+		In          string
+		ExpectedErr string
+	}{
+		{
+			In:          "10 " + testIMATemplateHash + " ima-ng " + digest,
+			ExpectedErr: "line 1: bad format: expecting <pcr> <template-hash> <template> <digest> <path>",
+		},
+		{
+			In:          "\n256 " + testIMATemplateHash + " ima-ng " + digest + " /bin/ls",
+			ExpectedErr: `line 2: bad PCR "256"`,
+		},
+		{
+			In:          "10 xyz ima-ng " + digest + " /bin/ls",
+			ExpectedErr: "line 1: bad template hash: encoding/hex: invalid byte: U+0078 'x'",
+		},
+		{
+			In:          "10 " + testIMATemplateHash + " ima " + testIMATemplateHash + " /bin/ls",
+			ExpectedErr: `line 1: unsupported template "ima"`,
+		},
+		{
+			In:          "10 " + testIMATemplateHash + " ima-ng " + strings.Repeat("ab", 32) + " /bin/ls",
+			ExpectedErr: fmt.Sprintf("line 1: bad digest %q: expecting <alg>:<hex-value>", strings.Repeat("ab", 32)),
+		},
+		{
+			In:          "10 " + testIMATemplateHash + " ima-ng sha256:xy /bin/ls",
+			ExpectedErr: "line 1: bad digest value: encoding/hex: invalid byte: U+0078 'x'",
+		},
+		{
+			In:          "10 " + testIMATemplateHash + " ima-ng sha256:abcd /bin/ls",
+			ExpectedErr: "line 1: length mismatch for hash algorithm sha-256: want 32 bytes, got 2",
+		},
+	} {
+		_, err := ParseIMALog(strings.NewReader(tv.In))
+		assert.EqualError(t, err, tv.ExpectedErr)
+	}
+}
+
+func TestEvidence_AddIMAEntries(t *testing.T) {
+	entries, err := ParseIMALog(strings.NewReader(testIMALog(t)))
+	require.Nil(t, err)
+
+	e := NewEvidence("BAD809B1-7032-43D9-8F94-BF128E5D061D")
+	require.Nil(t, e.AddIMAEntries(entries))
+
+	var paths []string
+	_ = e.Walk(func(r ResolvedItem) error {
+		paths = append(paths, r.FullPath())
+		return nil
+	})
+
+	// boot_aggregate, the violation and the repeated measurement are skipped
+	assert.Equal(t, []string{
+		"/opt/acme/bin/rrdetector",
+		"/opt/acme/lib/librr.so",
+		"/usr/bin/ls",
+		"/opt/acme/share/doc/README",
+		"/opt/acme/share/doc/LICENSE.md",
+		"/opt/acme/etc/rr detector.conf",
+	}, paths)
+
+	f := (*e.Files)[0]
+	assert.Equal(t, "/", f.Root)
+	assert.Equal(t, "opt/acme/bin", f.Location)
+	assert.Equal(t, "rrdetector", f.FsName)
+	assert.Equal(t, testSha256(t, "roadrunner detector"), f.Hash)
+	assert.Nil(t, f.Size)
+}
+
+func TestAppraiseIMALog(t *testing.T) {
+	bin := testTagFromFS(t, testFS, "opt/acme/bin", &PayloadOptions{Root: "/opt/acme/bin"})
+	lib := testTagFromFS(t, testFS, "opt/acme/lib", &PayloadOptions{Root: "/opt/acme/lib"})
+	doc := testTagFromFS(t, testFS, "opt/acme/share/doc", &PayloadOptions{Root: "/opt/acme/share/doc"})
+
+	ev, res, err := AppraiseIMALog(strings.NewReader(testIMALog(t)), []*SoftwareIdentity{bin, lib, doc}, nil)
+	require.Nil(t, err)
+	assert.Len(t, *ev.Files, 6)
+
+	assert.Equal(t, AppraisalMatched, res.Tags[0].Status)
+
+	assert.Equal(t, AppraisalContradicted, res.Tags[1].Status)
+	assert.Equal(t, "sha-256 hash mismatch", res.Tags[1].Files[1].Reason)
+
+	assert.Equal(t, AppraisalMatched, res.Tags[2].Status)
+
+	assert.Equal(t, []string{"/usr/bin/ls", "/opt/acme/etc/rr detector.conf"}, res.UnknownFiles)
+
+	// a file measured again after being modified contradicts the reference
+	log := testIMALog(t) + "\n10 " + testIMATemplateHash + " ima-ng sha256:" + strings.Repeat("ab", 32) + " /opt/acme/bin/rrdetector"
+
+	_, res, err = AppraiseIMALog(strings.NewReader(log), []*SoftwareIdentity{bin}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, AppraisalContradicted, res.Tags[0].Status)
+
+	_, _, err = AppraiseIMALog(strings.NewReader("10"), nil, nil)
+	assert.NotNil(t, err)
+
+	_, _, err = AppraiseIMALog(strings.NewReader(""), []*SoftwareIdentity{nil}, nil)
+	assert.EqualError(t, err, "reference tag at index 0 is nil")
+}
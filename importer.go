@@ -0,0 +1,488 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ImportOptions controls how the package databases read by the importers
+// (e.g., ImportDpkg) are converted to tags
+type ImportOptions struct {
+	// The algorithms used to hash the installed files, which are read from
+	// the file system. The first hash is stored in File.Hash, unless the
+	// package database records a digest computed with a registered
+	// algorithm, any further one in the Hashes extension. The digests
+	// recorded in the package database take precedence: the algorithms
+	// they use are not computed again, so that a file modified since its
+	// installation is still described as installed. If empty, files are not
+	// read and only the digests found in the package database are used.
+	// Symlinks are never followed.
+	HashAlgIDs []uint64
+
+	// The entity recorded with the tag-creator role. If nil, the distributor
+	// of the packages is recorded as tag creator.
+	TagCreator *Entity
+}
+
+// packageURL is a package URL (https://github.com/package-url/purl-spec), used
+// as tag ID of the imported packages and to reference their dependencies
+type packageURL struct {
+	Type       string
+	Namespace  string
+	Name       string
+	Version    string
+	Qualifiers map[string]string
+	Subpath    string
+}
+
+func (p packageURL) String() string {
+	var b strings.Builder
+
+	b.WriteString("pkg:")
+	b.WriteString(p.Type)
+
+	if p.Namespace != "" {
+		for _, s := range strings.Split(p.Namespace, "/") {
+			b.WriteString("/")
+			b.WriteString(escapePURLSegment(s))
+		}
+	}
+
+	b.WriteString("/")
+	b.WriteString(escapePURLSegment(p.Name))
+
+	if p.Version != "" {
+		b.WriteString("@")
+		b.WriteString(url.PathEscape(p.Version))
+	}
+
+	var keys []string
+	for k, v := range p.Qualifiers {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for i, k := range keys {
+		if i == 0 {
+			b.WriteString("?")
+		} else {
+			b.WriteString("&")
+		}
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(escapePURLQualifier(p.Qualifiers[k]))
+	}
+
+	if p.Subpath != "" {
+		for i, s := range strings.Split(p.Subpath, "/") {
+			if i == 0 {
+				b.WriteString("#")
+			} else {
+				b.WriteString("/")
+			}
+			b.WriteString(url.PathEscape(s))
+		}
+	}
+
+	return b.String()
+}
+
+// escapePURLSegment escapes a segment of the namespace or the name of a
+// package URL, where "@" separates the version (e.g., in npm scopes)
+func escapePURLSegment(s string) string {
+	return strings.ReplaceAll(url.PathEscape(s), "@", "%40")
+}
+
+// escapePURLQualifier percent-encodes the value of a qualifier of a package
+// URL, including spaces
+func escapePURLQualifier(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// versionless returns the package URL with no version, qualifiers and subpath,
+// used to reference a package regardless of the installed version
+func (p packageURL) versionless() packageURL {
+	return packageURL{Type: p.Type, Namespace: p.Namespace, Name: p.Name}
+}
+
+// dependency is a package required or recommended by an installed package
+type dependency struct {
+	// The reference to the package: a package URL, or a "swid:" URI
+	href string
+	use  int64
+}
+
+// installedFile is a file installed by a package
+type installedFile struct {
+	// The absolute slash separated path of the file
+	path string
+
+	// The size of the file, if recorded in the package database
+	size *int64
+
+	// The digests recorded in the package database. Digests computed with
+	// algorithms missing from the registry are not used.
+	digests HashEntries
+}
+
+// installedPackage is the importer-neutral description of an installed
+// package, converted to a tag by toTag
+type installedPackage struct {
+	purl    packageURL
+	name    string
+	version string
+
+	// SoftwareMeta items
+	summary     string
+	description string
+	product     string
+	revision    string
+
+	// The checksum of the package source, recorded in the software meta
+	// extension
+	sourceChecksum string
+
+	// The organisation distributing the package (e.g., "Debian"), and the
+	// person or team maintaining it
+	distributor string
+	maintainer  string
+
+	homepage string
+
+	deps  []dependency
+	files []installedFile
+}
+
+// toTag converts the package into a primary tag whose ID is its package URL.
+// Installed files missing from the file system are included only if the
+// package database records their digest, and non-regular files are skipped.
+func (p installedPackage) toTag(fsys fs.FS, opts *ImportOptions) (*SoftwareIdentity, error) {
+	var o ImportOptions
+
+	if opts != nil {
+		o = *opts
+	}
+
+	tag, err := p.newTag(o.TagCreator)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := p.pathEntries(fsys, o.HashAlgIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setPayload(tag, entries); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// newTag returns a tag describing the package, with no payload
+func (p installedPackage) newTag(creator *Entity) (*SoftwareIdentity, error) {
+	tag, err := NewTag(p.purl.String(), p.name, p.version)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.addEntities(tag, creator); err != nil {
+		return nil, err
+	}
+
+	if p.summary != "" || p.description != "" || p.product != "" || p.revision != "" ||
+		p.sourceChecksum != "" {
+		m := SoftwareMeta{
+			Summary:     p.summary,
+			Description: p.description,
+			Product:     p.product,
+			Revision:    p.revision,
+		}
+		m.SourceChecksum = p.sourceChecksum
+
+		if err := tag.AddSoftwareMeta(m); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.homepage != "" {
+		if err := addLink(tag, p.homepage, RelSeeAlso, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := map[string]bool{}
+
+	for _, d := range p.deps {
+		if seen[d.href] {
+			continue
+		}
+		seen[d.href] = true
+
+		if err := addLink(tag, d.href, RelRequires, d.use); err != nil {
+			return nil, err
+		}
+	}
+
+	return tag, nil
+}
+
+// setPayload sets the payload of the tag to the tree holding the supplied
+// files, if any
+func setPayload(tag *SoftwareIdentity, entries []PathEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	pe, err := NewPathElementsFromPaths(entries)
+	if err != nil {
+		return err
+	}
+
+	tag.Payload = NewPayload()
+	tag.Payload.PathElements = *pe
+
+	return nil
+}
+
+func (p installedPackage) addEntities(tag *SoftwareIdentity, creator *Entity) error {
+	if creator == nil && p.distributor == "" {
+		return errors.New("no tag creator: the package has no distributor")
+	}
+
+	var entities []Entity
+
+	if creator != nil {
+		entities = append(entities, *creator)
+	}
+
+	if p.distributor != "" {
+		roles := []interface{}{RoleDistributor}
+		if creator == nil {
+			roles = append([]interface{}{RoleTagCreator}, roles...)
+		}
+		if p.maintainer == p.distributor {
+			roles = append(roles, RoleMaintainer)
+		}
+
+		e, err := NewEntity(p.distributor, roles...)
+		if err != nil {
+			return err
+		}
+
+		entities = append(entities, *e)
+	}
+
+	if p.maintainer != "" && p.maintainer != p.distributor {
+		e, err := NewEntity(p.maintainer, RoleMaintainer)
+		if err != nil {
+			return err
+		}
+
+		entities = append(entities, *e)
+	}
+
+	for _, e := range entities {
+		if err := tag.AddEntity(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addLink(tag *SoftwareIdentity, href string, rel int64, use int64) error {
+	l, err := NewLink(href, *NewRel(rel))
+	if err != nil {
+		return err
+	}
+
+	if use != 0 {
+		l.Use = &Use{use}
+	}
+
+	return tag.AddLink(*l)
+}
+
+// pathEntries returns the files of the package, with the size and the hashes
+// of those found in fsys. Symlinks, including parent directories that are
+// symlinks, are not followed, since absolute links would resolve outside an
+// image mounted as fsys: such files are described only by the digests recorded
+// in the package database.
+func (p installedPackage) pathEntries(fsys fs.FS, algIDs []uint64) ([]PathEntry, error) {
+	var entries []PathEntry
+
+	types := fileTypes{}
+
+	for _, f := range p.files {
+		e := PathEntry{Path: f.path, File: File{Size: f.size}}
+
+		hashes := append(HashEntries(nil), f.digests...)
+
+		name := strings.TrimPrefix(path.Clean(f.path), "/")
+
+		var info fs.FileInfo
+
+		mode, err := types.lstat(fsys, name)
+		if err == nil && mode.IsRegular() {
+			info, err = fs.Stat(fsys, name)
+		}
+
+		switch {
+		case errors.Is(err, fs.ErrNotExist), err == nil && mode&fs.ModeSymlink != 0:
+			if len(hashes) == 0 {
+				continue
+			}
+		case err != nil:
+			return nil, fmt.Errorf("%s: %w", f.path, err)
+		case !mode.IsRegular():
+			continue
+		default:
+			if e.File.Size == nil {
+				size := info.Size()
+				e.File.Size = &size
+			}
+
+			if missing := missingAlgIDs(algIDs, hashes); len(missing) != 0 {
+				computed, err := hashFSFile(fsys, name, missing)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", f.path, err)
+				}
+				hashes = append(hashes, computed...)
+			}
+		}
+
+		if len(hashes) != 0 {
+			e.File.Hash = &hashes[0]
+			if len(hashes) > 1 {
+				e.File.Hashes = hashes[1:]
+			}
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// fileTypes caches the types of the entries of the directories of a file
+// system, keyed by directory and entry name
+type fileTypes map[string]map[string]fs.FileMode
+
+// lstat returns the type of the named file of fsys, or fs.ModeSymlink if the
+// file or one of its parent directories is a symlink
+func (t fileTypes) lstat(fsys fs.FS, name string) (fs.FileMode, error) {
+	dir := "."
+
+	elems := strings.Split(name, "/")
+
+	for i, elem := range elems {
+		dirTypes, ok := t[dir]
+		if !ok {
+			entries, err := fs.ReadDir(fsys, dir)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return 0, err
+			}
+
+			dirTypes = map[string]fs.FileMode{}
+			for _, de := range entries {
+				dirTypes[de.Name()] = de.Type()
+			}
+			t[dir] = dirTypes
+		}
+
+		mode, ok := dirTypes[elem]
+		switch {
+		case !ok:
+			return 0, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrNotExist}
+		case mode&fs.ModeSymlink != 0, i == len(elems)-1:
+			return mode, nil
+		case !mode.IsDir():
+			return 0, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrNotExist}
+		}
+
+		dir = path.Join(dir, elem)
+	}
+
+	return 0, nil
+}
+
+// missingAlgIDs returns the algorithms that are not used by the recorded
+// digests
+func missingAlgIDs(algIDs []uint64, recorded HashEntries) []uint64 {
+	var missing []uint64
+
+	for _, id := range algIDs {
+		found := false
+
+		for _, h := range recorded {
+			if h.HashAlgID == id {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			missing = append(missing, id)
+		}
+	}
+
+	return missing
+}
+
+func hashFSFile(fsys fs.FS, name string, algIDs []uint64) (HashEntries, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return computeHashEntries(algIDs, f)
+}
+
+// lookupDigestAlg returns the registered hash algorithm with the supplied
+// name, which can also be spelt as in Python's hashlib, subresource integrity
+// and IMA (e.g., "sha256")
+func lookupDigestAlg(name string) (HashAlgorithm, bool) {
+	if n, ok := imaAlgNames[name]; ok {
+		name = n
+	}
+
+	return LookupHashAlgorithmByName(name)
+}
+
+// registeredDigest returns a hash entry for a digest recorded in a package
+// database using the named algorithm, if the algorithm is registered and the
+// hex-encoded value is valid
+func registeredDigest(algName, hexValue string) (HashEntry, bool) {
+	a, ok := LookupHashAlgorithmByName(algName)
+	if !ok {
+		return HashEntry{}, false
+	}
+
+	v, err := hex.DecodeString(hexValue)
+	if err != nil {
+		return HashEntry{}, false
+	}
+
+	var h HashEntry
+
+	if err := h.Set(a.ID, v); err != nil {
+		return HashEntry{}, false
+	}
+
+	return h, true
+}
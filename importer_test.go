@@ -0,0 +1,119 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPayloadFiles returns the files of the payload of the tag, indexed by full
+// path
+func testPayloadFiles(t *testing.T, tag *SoftwareIdentity) map[string]*File {
+	files := map[string]*File{}
+
+	require.NotNil(t, tag.Payload)
+	require.Nil(t, tag.Payload.Walk(func(r ResolvedItem) error {
+		if !r.IsDir() {
+			files[r.FullPath()] = r.File
+		}
+		return nil
+	}))
+
+	return files
+}
+
+func TestPackageURL_String(t *testing.T) {
+	p := packageURL{
+		Type:       "maven",
+		Namespace:  "org.acme/tools",
+		Name:       "rr detector",
+		Version:    "1.0+b1",
+		Qualifiers: map[string]string{"type": "jar", "classifier": "", "arch": "x86_64 v2", "repository_url": "a+b&c=d"},
+	}
+
+	assert.Equal(t, "pkg:maven/org.acme/tools/rr%20detector@1.0+b1?arch=x86_64%20v2&repository_url=a%2Bb%26c%3Dd&type=jar", p.String())
+	assert.Equal(t, "pkg:maven/org.acme/tools/rr%20detector", p.versionless().String())
+}
+
+func TestPackageURL_String_subpath(t *testing.T) {
+	p := packageURL{
+		Type:      "golang",
+		Namespace: "github.com/acme",
+		Name:      "rrd",
+		Version:   "v1.2.0",
+		Subpath:   "cmd/rr detector",
+	}
+
+	assert.Equal(t, "pkg:golang/github.com/acme/rrd@v1.2.0#cmd/rr%20detector", p.String())
+	assert.Equal(t, "pkg:golang/github.com/acme/rrd", p.versionless().String())
+}
+
+func TestInstalledPackage_toTag_recordedDigests(t *testing.T) {
+	p := installedPackage{
+		purl:        packageURL{Type: "generic", Name: "rrdetector"},
+		name:        "rrdetector",
+		distributor: "ACME",
+		files: []installedFile{
+			{path: "/usr/bin/rrdetector", digests: HashEntries{*testSha256(t, "roadrunner detector")}},
+		},
+	}
+
+	// the file was modified after its installation
+	fsys := fstest.MapFS{"usr/bin/rrdetector": {Data: []byte("coyote detector")}}
+
+	tag, err := p.toTag(fsys, &ImportOptions{HashAlgIDs: []uint64{Sha256, Sha512}})
+	require.Nil(t, err)
+
+	// one hash per algorithm, the recorded one taking precedence
+	f := testPayloadFiles(t, tag)["/usr/bin/rrdetector"]
+	require.NotNil(t, f)
+	assert.Equal(t, testSha256(t, "roadrunner detector"), f.Hash)
+	require.Len(t, f.Hashes, 1)
+	assert.Equal(t, Sha512, f.Hashes[0].HashAlgID)
+
+	_, err = tag.ToXML()
+	assert.Nil(t, err)
+}
+
+func TestInstalledPackage_toTag_symlinks(t *testing.T) {
+	p := installedPackage{
+		purl:        packageURL{Type: "generic", Name: "rrdetector"},
+		name:        "rrdetector",
+		distributor: "ACME",
+		files: []installedFile{
+			{path: "/usr/bin/rrdetector"},
+			{path: "/usr/bin/rrd", digests: HashEntries{*testSha256(t, "roadrunner detector")}},
+			{path: "/etc/passwd"},
+			{path: "/lib/librr.so"},
+		},
+	}
+
+	// absolute links would resolve to the host when fsys is a mounted image
+	fsys := fstest.MapFS{
+		"usr/bin/rrdetector": {Data: []byte("roadrunner detector")},
+		"usr/bin/rrd":        {Data: []byte("/usr/bin/rrdetector"), Mode: fs.ModeSymlink},
+		"etc/passwd":         {Data: []byte("/etc/passwd"), Mode: fs.ModeSymlink},
+		"lib":                {Data: []byte("/usr/lib"), Mode: fs.ModeSymlink},
+		"usr/lib/librr.so":   {Data: []byte("roadrunner library")},
+	}
+
+	tag, err := p.toTag(fsys, &ImportOptions{HashAlgIDs: []uint64{Sha512}})
+	require.Nil(t, err)
+
+	files := testPayloadFiles(t, tag)
+	assert.Len(t, files, 2)
+	assert.Contains(t, files, "/usr/bin/rrdetector")
+
+	// links are not followed, only the recorded digests are kept
+	f := files["/usr/bin/rrd"]
+	require.NotNil(t, f)
+	assert.Nil(t, f.Size)
+	assert.Equal(t, testSha256(t, "roadrunner detector"), f.Hash)
+	assert.Nil(t, f.Hashes)
+}
@@ -0,0 +1,322 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InventoryEntry records a software component observed on a device, as
+// described by an evidence tag
+type InventoryEntry struct {
+	DeviceID        string
+	TagID           string
+	SoftwareName    string
+	SoftwareVersion string
+
+	// The date of the evidence
+	Date time.Time
+
+	// The evidence tag
+	Tag *SoftwareIdentity
+}
+
+// Inventory aggregates the evidence tags collected from a fleet of devices,
+// and indexes them by device, software name, version and tag ID. Only the
+// most recent evidence for a given device and tag ID is retained. An
+// Inventory is safe for concurrent use.
+type Inventory struct {
+	mu sync.RWMutex
+
+	// device ID -> tag ID -> entry
+	devices map[string]map[string]*InventoryEntry
+
+	// software name -> device IDs
+	byName map[string]map[string]bool
+
+	// tag ID -> device IDs
+	byTagID map[string]map[string]bool
+
+	// process names declared by reference payloads
+	knownProcesses map[string]bool
+}
+
+// NewInventory returns an empty Inventory
+func NewInventory() *Inventory {
+	return &Inventory{
+		devices:        map[string]map[string]*InventoryEntry{},
+		byName:         map[string]map[string]bool{},
+		byTagID:        map[string]map[string]bool{},
+		knownProcesses: map[string]bool{},
+	}
+}
+
+// Add ingests an evidence tag. The tag must carry an Evidence with a device
+// ID. If the inventory already holds a more recent evidence for the same
+// device and tag ID, the tag is ignored.
+func (inv *Inventory) Add(tag *SoftwareIdentity) error {
+	if tag == nil || tag.Evidence == nil {
+		return errors.New("not an evidence tag")
+	}
+
+	if tag.Evidence.DeviceID == "" {
+		return errors.New("evidence has no device ID")
+	}
+
+	e := InventoryEntry{
+		DeviceID:        tag.Evidence.DeviceID,
+		TagID:           tag.TagID.String(),
+		SoftwareName:    tag.SoftwareName,
+		SoftwareVersion: tag.SoftwareVersion,
+		Date:            tag.Evidence.Date,
+		Tag:             tag,
+	}
+
+	if e.TagID == "" {
+		return errors.New("evidence tag has no tag ID")
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	entries, ok := inv.devices[e.DeviceID]
+	if !ok {
+		entries = map[string]*InventoryEntry{}
+		inv.devices[e.DeviceID] = entries
+	}
+
+	if cur, ok := entries[e.TagID]; ok {
+		if cur.Date.After(e.Date) {
+			return nil
+		}
+		// the software name of a tag ID is not expected to change, but
+		// the index must not be left stale if it does
+		inv.unindexName(cur)
+	}
+
+	entries[e.TagID] = &e
+
+	addToIndex(inv.byName, e.SoftwareName, e.DeviceID)
+	addToIndex(inv.byTagID, e.TagID, e.DeviceID)
+
+	return nil
+}
+
+func addToIndex(idx map[string]map[string]bool, k, deviceID string) {
+	if idx[k] == nil {
+		idx[k] = map[string]bool{}
+	}
+	idx[k][deviceID] = true
+}
+
+func (inv *Inventory) unindexName(e *InventoryEntry) {
+	for _, other := range inv.devices[e.DeviceID] {
+		if other != e && other.SoftwareName == e.SoftwareName {
+			return
+		}
+	}
+
+	delete(inv.byName[e.SoftwareName], e.DeviceID)
+}
+
+// AddReference registers the processes declared in the payload of the
+// supplied reference tag, which are then considered identified when found in
+// the evidence of a device
+func (inv *Inventory) AddReference(tag *SoftwareIdentity) error {
+	if tag == nil {
+		return errors.New("nil reference tag")
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	if p := tag.Payload; p != nil && p.Processes != nil {
+		for _, pr := range *p.Processes {
+			inv.knownProcesses[pr.ProcessName] = true
+		}
+	}
+
+	return nil
+}
+
+// Devices returns the IDs of all the devices in the inventory, sorted
+func (inv *Inventory) Devices() []string {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	ids := make([]string, 0, len(inv.devices))
+	for id := range inv.devices {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// DeviceSoftware returns the software observed on the supplied device, sorted
+// by software name, version and tag ID
+func (inv *Inventory) DeviceSoftware(deviceID string) []InventoryEntry {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	return sortedEntries(inv.devices[deviceID])
+}
+
+// Entries returns the entries of the named software, sorted by device ID,
+// version and tag ID. If version is not empty, only the entries with that
+// version are returned.
+func (inv *Inventory) Entries(softwareName, version string) []InventoryEntry {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	var entries []InventoryEntry
+
+	for deviceID := range inv.byName[softwareName] {
+		for _, e := range inv.devices[deviceID] {
+			if e.SoftwareName == softwareName && (version == "" || e.SoftwareVersion == version) {
+				entries = append(entries, *e)
+			}
+		}
+	}
+
+	sortEntries(entries)
+
+	return entries
+}
+
+// DevicesRunning returns the sorted IDs of the devices on which the named
+// software was observed. If version is not empty, only the devices running
+// that version are returned.
+func (inv *Inventory) DevicesRunning(softwareName, version string) []string {
+	return uniqueDevices(inv.Entries(softwareName, version))
+}
+
+// DevicesWithTag returns the sorted IDs of the devices on which the software
+// with the supplied tag ID was observed
+func (inv *Inventory) DevicesWithTag(tagID string) []string {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	var ids []string
+	for id := range inv.byTagID[tagID] {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// VersionDistribution returns, for each observed version of the named
+// software, the number of devices running it
+func (inv *Inventory) VersionDistribution(softwareName string) map[string]int {
+	dist := map[string]int{}
+	seen := map[string]bool{}
+
+	for _, e := range inv.Entries(softwareName, "") {
+		k := e.DeviceID + "\x00" + e.SoftwareVersion
+		if !seen[k] {
+			seen[k] = true
+			dist[e.SoftwareVersion]++
+		}
+	}
+
+	return dist
+}
+
+// UnidentifiedProcesses returns, for each device, the processes found in its
+// evidence whose names are not declared by the payload of a reference tag
+// (see AddReference), nor by the payload of any evidence tag of the same
+// device. Devices with no unidentified processes are omitted.
+func (inv *Inventory) UnidentifiedProcesses() map[string][]Process {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	res := map[string][]Process{}
+
+	for deviceID, entries := range inv.devices {
+		known := map[string]bool{}
+
+		for _, e := range entries {
+			if p := e.Tag.Payload; p != nil && p.Processes != nil {
+				for _, pr := range *p.Processes {
+					known[pr.ProcessName] = true
+				}
+			}
+		}
+
+		for _, e := range sortedEntries(entries) {
+			if e.Tag.Evidence.Processes == nil {
+				continue
+			}
+
+			for _, pr := range *e.Tag.Evidence.Processes {
+				if !known[pr.ProcessName] && !inv.knownProcesses[pr.ProcessName] {
+					res[deviceID] = append(res[deviceID], pr)
+				}
+			}
+		}
+	}
+
+	return res
+}
+
+// DevicesWithUnidentifiedProcesses returns the sorted IDs of the devices whose
+// evidence holds unidentified processes, as reported by UnidentifiedProcesses
+func (inv *Inventory) DevicesWithUnidentifiedProcesses() []string {
+	var ids []string
+
+	for id := range inv.UnidentifiedProcesses() {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+func sortedEntries(m map[string]*InventoryEntry) []InventoryEntry {
+	entries := make([]InventoryEntry, 0, len(m))
+	for _, e := range m {
+		entries = append(entries, *e)
+	}
+
+	sortEntries(entries)
+
+	return entries
+}
+
+func sortEntries(entries []InventoryEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+
+		for _, c := range [][2]string{
+			{a.DeviceID, b.DeviceID},
+			{a.SoftwareName, b.SoftwareName},
+			{a.SoftwareVersion, b.SoftwareVersion},
+		} {
+			if c[0] != c[1] {
+				return c[0] < c[1]
+			}
+		}
+
+		return a.TagID < b.TagID
+	})
+}
+
+func uniqueDevices(entries []InventoryEntry) []string {
+	var ids []string
+
+	for i, e := range entries {
+		if i == 0 || e.DeviceID != entries[i-1].DeviceID {
+			ids = append(ids, e.DeviceID)
+		}
+	}
+
+	return ids
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testInventoryDate = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func testEvidenceTag(t *testing.T, deviceID, tagID, name, version string, date time.Time, procs ...string) *SoftwareIdentity {
+	tag, err := NewTag(tagID, name, version)
+	require.Nil(t, err)
+
+	tag.Evidence = NewEvidence(deviceID)
+	tag.Evidence.Date = date
+
+	for _, p := range procs {
+		require.Nil(t, tag.Evidence.AddProcess(Process{ProcessName: p}))
+	}
+
+	return tag
+}
+
+func testInventory(t *testing.T) *Inventory {
+	inv := NewInventory()
+
+	for _, tag := range []*SoftwareIdentity{
+		testEvidenceTag(t, "dev-1", "acme.rrd.1.0", "rrdetector", "1.0", testInventoryDate, "rrdetector"),
+		testEvidenceTag(t, "dev-2", "acme.rrd.1.0", "rrdetector", "1.0", testInventoryDate, "rrdetector", "coyote"),
+		testEvidenceTag(t, "dev-3", "acme.rrd.2.0", "rrdetector", "2.0", testInventoryDate),
+		testEvidenceTag(t, "dev-3", "acme.anvil.3.1", "anvil", "3.1", testInventoryDate, "anvild"),
+	} {
+		require.Nil(t, inv.Add(tag))
+	}
+
+	return inv
+}
+
+func TestInventory_Queries(t *testing.T) {
+	inv := testInventory(t)
+
+	assert.Equal(t, []string{"dev-1", "dev-2", "dev-3"}, inv.Devices())
+	assert.Equal(t, []string{"dev-1", "dev-2"}, inv.DevicesRunning("rrdetector", "1.0"))
+	assert.Equal(t, []string{"dev-1", "dev-2", "dev-3"}, inv.DevicesRunning("rrdetector", ""))
+	assert.Nil(t, inv.DevicesRunning("rrdetector", "3.0"))
+	assert.Equal(t, []string{"dev-3"}, inv.DevicesWithTag("acme.anvil.3.1"))
+	assert.Equal(t, map[string]int{"1.0": 2, "2.0": 1}, inv.VersionDistribution("rrdetector"))
+	assert.Empty(t, inv.VersionDistribution("coyote"))
+
+	sw := inv.DeviceSoftware("dev-3")
+	require.Len(t, sw, 2)
+	assert.Equal(t, "anvil", sw[0].SoftwareName)
+	assert.Equal(t, "acme.rrd.2.0", sw[1].TagID)
+	assert.Equal(t, "2.0", sw[1].SoftwareVersion)
+	assert.Empty(t, inv.DeviceSoftware("dev-4"))
+}
+
+func TestInventory_Add_keeps_latest_evidence(t *testing.T) {
+	inv := testInventory(t)
+
+	// an older snapshot is ignored
+	older := testEvidenceTag(t, "dev-1", "acme.rrd.1.0", "rrdetector", "1.0", testInventoryDate.Add(-time.Hour))
+	require.Nil(t, inv.Add(older))
+	assert.Equal(t, testInventoryDate, inv.DeviceSoftware("dev-1")[0].Date)
+
+	// dev-1 is upgraded
+	later := testInventoryDate.Add(time.Hour)
+	require.Nil(t, inv.Add(testEvidenceTag(t, "dev-1", "acme.rrd.2.0", "rrdetector", "2.0", later)))
+	require.Nil(t, inv.Add(testEvidenceTag(t, "dev-1", "acme.rrd.1.0", "roadrunner-detector", "1.0", later)))
+
+	assert.Equal(t, []string{"dev-1", "dev-3"}, inv.DevicesRunning("rrdetector", "2.0"))
+	assert.Equal(t, []string{"dev-1"}, inv.DevicesRunning("roadrunner-detector", ""))
+	assert.Equal(t, map[string]int{"1.0": 1, "2.0": 2}, inv.VersionDistribution("rrdetector"))
+	assert.Len(t, inv.DeviceSoftware("dev-1"), 2)
+}
+
+func TestInventory_Add_errors(t *testing.T) {
+	inv := NewInventory()
+
+	assert.EqualError(t, inv.Add(nil), "not an evidence tag")
+
+	tag, err := NewTag("acme.rrd.1.0", "rrdetector", "1.0")
+	require.Nil(t, err)
+	assert.EqualError(t, inv.Add(tag), "not an evidence tag")
+
+	tag.Evidence = NewEvidence("")
+	assert.EqualError(t, inv.Add(tag), "evidence has no device ID")
+
+	assert.EqualError(t, inv.AddReference(nil), "nil reference tag")
+	assert.Empty(t, inv.Devices())
+}
+
+func TestInventory_UnidentifiedProcesses(t *testing.T) {
+	inv := testInventory(t)
+
+	assert.Equal(t, []string{"dev-1", "dev-2", "dev-3"}, inv.DevicesWithUnidentifiedProcesses())
+
+	ref, err := NewTag("acme.rrd.ref", "rrdetector", "1.0")
+	require.Nil(t, err)
+	ref.Payload = NewPayload()
+	require.Nil(t, ref.Payload.AddProcess(Process{ProcessName: "rrdetector"}))
+	require.Nil(t, inv.AddReference(ref))
+
+	// a process declared by the payload of an evidence tag of the device is
+	// identified
+	anvil := testEvidenceTag(t, "dev-3", "acme.anvil.3.1", "anvil", "3.1", testInventoryDate, "anvild")
+	anvil.Payload = NewPayload()
+	require.Nil(t, anvil.Payload.AddProcess(Process{ProcessName: "anvild"}))
+	require.Nil(t, inv.Add(anvil))
+
+	assert.Equal(t, map[string][]Process{"dev-2": {{ProcessName: "coyote"}}}, inv.UnidentifiedProcesses())
+	assert.Equal(t, []string{"dev-2"}, inv.DevicesWithUnidentifiedProcesses())
+}
+
+func TestInventory_concurrent_use(t *testing.T) {
+	inv := NewInventory()
+
+	var wg sync.WaitGroup
+
+	for _, id := range []string{"dev-1", "dev-2", "dev-3", "dev-4"} {
+		tag := testEvidenceTag(t, id, "acme.rrd.1.0", "rrdetector", "1.0", testInventoryDate)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, inv.Add(tag))
+			inv.VersionDistribution("rrdetector")
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, map[string]int{"1.0": 4}, inv.VersionDistribution("rrdetector"))
+}
@@ -0,0 +1,420 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// JAROptions controls how NewTagsFromJAR reads a Java archive
+type JAROptions struct {
+	// The algorithms in HashAlgIDs are used to hash the entries of the
+	// archives and the archive itself. If none is supplied, SHA-256 is used.
+	ImportOptions
+
+	// The distributor of the archives whose manifest names no vendor, and
+	// which are not nested in an archive naming one
+	Vendor string
+
+	// The file name of the archive, e.g., "rrd-1.2.0.war", recorded as
+	// artifact of the installation media link. If empty, no installation
+	// media link is added. The name is also used to select the Maven
+	// coordinates of the archive when it embeds several pom.properties files,
+	// and as software name when neither the Maven coordinates nor the
+	// manifest name the archive.
+	Name string
+}
+
+// JARMediaType is the media type of Java archives
+const JARMediaType = "application/java-archive"
+
+// maxJARNesting is the maximum depth of the nested archives that are read
+const maxJARNesting = 4
+
+// maxNestedJARSize is the maximum uncompressed size of the nested archives
+// that are read, since they are held in memory
+var maxNestedJARSize uint64 = 64 << 20
+
+// NewTagsFromJAR reads a Java archive (e.g., a .jar, .war or .ear file) of the
+// given size from r and returns a tag describing it, followed by one tag per
+// nested archive (e.g., WEB-INF/lib/*.jar), in depth-first order. Nested
+// entries that are not valid archives, or that are larger than 64 MiB, are
+// only listed in the payload. Each tag has:
+//
+//   - the Maven coordinates found in META-INF/maven/*/*/pom.properties as
+//     identity, e.g., pkg:maven/org.acme/rrd@1.2.0, or the name and version
+//     found in META-INF/MANIFEST.MF (Implementation-* or Bundle-* attributes),
+//     e.g., pkg:generic/rrd@1.2.0;
+//   - the Implementation-Vendor (or Bundle-Vendor) of the manifest as
+//     distributor, tag creator unless one is supplied. Nested archives with
+//     no vendor inherit the one of the enclosing archive;
+//   - the Bundle-Description and Bundle-DocURL of the manifest as summary and
+//     "see-also" link;
+//   - a "component" link for each nested archive;
+//   - a payload listing the entries of the archive, with no root, with their
+//     size and hashes. Absolute entry names are listed relative to the
+//     archive, and entries whose name escapes it (e.g., "../evil") are
+//     skipped.
+//
+// The tag of the outermost archive has an "installation-media" link to the
+// archive, carrying its hashes in the Hashes extension, if its Name is
+// supplied. Nested archives sharing the same identity are described once.
+func NewTagsFromJAR(r io.ReaderAt, size int64, opts *JAROptions) ([]*SoftwareIdentity, error) {
+	var o JAROptions
+
+	if opts != nil {
+		o = *opts
+	}
+
+	if len(o.HashAlgIDs) == 0 {
+		o.HashAlgIDs = []uint64{Sha256}
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	j := jarReader{opts: &o, seen: map[string]bool{}}
+
+	tag, err := j.read(zr, o.Name, o.Vendor, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Name != "" {
+		hashes, err := computeHashEntries(o.HashAlgIDs, io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, err
+		}
+
+		l, err := NewLink(o.Name, *NewRel(RelInstallationMedia))
+		if err != nil {
+			return nil, err
+		}
+
+		l.Artifact = o.Name
+		l.MediaType = JARMediaType
+		l.Hashes = hashes
+
+		if err := tag.AddLink(*l); err != nil {
+			return nil, err
+		}
+	}
+
+	return j.tags, nil
+}
+
+type jarReader struct {
+	opts *JAROptions
+
+	// the tags, in depth-first order, and the IDs of the nested archives
+	// already described
+	tags []*SoftwareIdentity
+	seen map[string]bool
+}
+
+// read describes the archive zr, whose file name is name, and the archives
+// nested in it. The distributor is used if the manifest names no vendor.
+func (j *jarReader) read(zr *zip.Reader, name, distributor string, depth int) (*SoftwareIdentity, error) {
+	p, err := newJARPackage(zr, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.distributor == "" {
+		p.distributor = distributor
+	}
+
+	tag, err := p.newTag(j.opts.TagCreator)
+	if err != nil {
+		return nil, err
+	}
+
+	id := p.purl.String()
+
+	if depth > 0 && j.seen[id] {
+		return tag, nil
+	}
+	j.seen[id] = true
+
+	// the tag precedes those of the nested archives
+	j.tags = append(j.tags, tag)
+
+	var entries []PathEntry
+
+	components := map[string]bool{}
+
+	for _, f := range zr.File {
+		if f.Mode().IsDir() || strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+
+		entryName := strings.TrimLeft(f.Name, "/")
+		if !fs.ValidPath(entryName) {
+			continue
+		}
+
+		e, nested, err := j.readEntry(f, entryName, depth)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+
+		entries = append(entries, e)
+
+		if nested == nil {
+			continue
+		}
+
+		t, err := j.read(nested, path.Base(entryName), p.distributor, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+
+		href := t.TagID.String()
+		if components[href] {
+			continue
+		}
+		components[href] = true
+
+		if err := addLink(tag, href, RelComponent, UseRequired); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := setPayload(tag, entries); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// readEntry hashes an entry of the archive, listed as name, and returns the
+// nested archive it holds, if it is one to be read
+func (j *jarReader) readEntry(f *zip.File, name string, depth int) (PathEntry, *zip.Reader, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return PathEntry{}, nil, err
+	}
+	defer rc.Close()
+
+	var (
+		r      io.Reader = rc
+		nested *zip.Reader
+	)
+
+	if isJARName(name) && depth < maxJARNesting && f.UncompressedSize64 <= maxNestedJARSize {
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			return PathEntry{}, nil, err
+		}
+		r = bytes.NewReader(data)
+
+		// e.g., a test fixture or a renamed resource
+		nested, err = zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			nested = nil
+		}
+	}
+
+	hashes, err := computeHashEntries(j.opts.HashAlgIDs, r)
+	if err != nil {
+		return PathEntry{}, nil, err
+	}
+
+	size := int64(f.UncompressedSize64)
+
+	e := PathEntry{Path: name, File: File{Size: &size}}
+
+	e.File.Hash = &hashes[0]
+	if len(hashes) > 1 {
+		e.File.Hashes = hashes[1:]
+	}
+
+	return e, nested, nil
+}
+
+func isJARName(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jar", ".war", ".ear":
+		return true
+	}
+
+	return false
+}
+
+// newJARPackage returns the description of an archive found in its manifest
+// and Maven properties
+func newJARPackage(fsys fs.FS, name string) (*installedPackage, error) {
+	m, err := readJARAttributes(fsys, "META-INF/MANIFEST.MF", parseJARManifest)
+	if err != nil {
+		return nil, fmt.Errorf("META-INF/MANIFEST.MF: %w", err)
+	}
+
+	pom, err := findPOMProperties(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := installedPackage{
+		name:        firstNonEmpty(m["Implementation-Title"], m["Bundle-Name"], pom["artifactId"]),
+		version:     firstNonEmpty(pom["version"], m["Implementation-Version"], m["Bundle-Version"]),
+		summary:     m["Bundle-Description"],
+		distributor: firstNonEmpty(m["Implementation-Vendor"], m["Bundle-Vendor"]),
+		homepage:    m["Bundle-DocURL"],
+	}
+
+	if p.name == "" && name != "" {
+		p.name = strings.TrimSuffix(name, path.Ext(name))
+	}
+
+	if p.name == "" {
+		return nil, errors.New("no name: no pom.properties, manifest title or archive name")
+	}
+
+	if pom != nil {
+		p.purl = packageURL{
+			Type:      "maven",
+			Namespace: pom["groupId"],
+			Name:      pom["artifactId"],
+			Version:   p.version,
+		}
+	} else {
+		p.purl = packageURL{Type: "generic", Name: p.name, Version: p.version}
+	}
+
+	return &p, nil
+}
+
+// findPOMProperties returns the Maven properties embedded in the archive. If
+// there are several (e.g., in an archive bundling its dependencies), those
+// whose artifactId matches the archive name are used, if any.
+func findPOMProperties(fsys fs.FS, name string) (map[string]string, error) {
+	matches, err := fs.Glob(fsys, "META-INF/maven/*/*/pom.properties")
+	if err != nil {
+		return nil, err
+	}
+
+	var found []map[string]string
+
+	for _, m := range matches {
+		props, err := readJARAttributes(fsys, m, parseProperties)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m, err)
+		}
+
+		if props["groupId"] == "" || props["artifactId"] == "" {
+			return nil, fmt.Errorf("%s: missing groupId or artifactId", m)
+		}
+
+		found = append(found, props)
+	}
+
+	if len(found) == 1 {
+		return found[0], nil
+	}
+
+	for _, props := range found {
+		if strings.HasPrefix(name, props["artifactId"]+"-") || strings.HasPrefix(name, props["artifactId"]+".") {
+			return props, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// readJARAttributes parses the named file, which may be missing
+func readJARAttributes(fsys fs.FS, name string, parse func(io.Reader) (map[string]string, error)) (map[string]string, error) {
+	f, err := fsys.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parse(f)
+}
+
+// parseJARManifest parses the main section of a JAR manifest, made of
+// "<name>: <value>" lines, where values are continued by lines starting with
+// a space
+func parseJARManifest(r io.Reader) (map[string]string, error) {
+	attrs := map[string]string{}
+
+	var last string
+
+	s := bufio.NewScanner(r)
+
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+
+		if line == "" {
+			break
+		}
+
+		if strings.HasPrefix(line, " ") {
+			if last == "" {
+				return nil, fmt.Errorf("line %d: continuation line without an attribute", n)
+			}
+			attrs[last] += line[1:]
+			continue
+		}
+
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: bad format: expecting <name>: <value>", n)
+		}
+
+		last = strings.TrimSpace(k)
+		attrs[last] = strings.TrimPrefix(v, " ")
+	}
+
+	return attrs, s.Err()
+}
+
+// parseProperties parses a Java properties file made of "<key>=<value>" lines,
+// such as those generated by Maven. Escape sequences and continuation lines
+// are not supported.
+func parseProperties(r io.Reader) (map[string]string, error) {
+	props := map[string]string{}
+
+	s := bufio.NewScanner(r)
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+
+		i := strings.IndexAny(line, "=:")
+		if i < 0 {
+			props[line] = ""
+			continue
+		}
+
+		props[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+
+	return props, s.Err()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
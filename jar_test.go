@@ -0,0 +1,255 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testWARManifest = "Manifest-Version: 1.0\r\n" +
+	"Implementation-Title: RR Detector Web\r\n" +
+	"Implementation-Version: 1.2.0-SNAPSHOT\r\n" +
+	"Implementation-Vendor: ACME\r\n" +
+	"Bundle-Description: detects roadrunners from a dis\r\n" +
+	" tance\r\n" +
+	"Bundle-DocURL: https://acme.example/rrd\r\n" +
+	"\r\n" +
+	"Name: org/acme/rrd/\r\n" +
+	"Sealed: true\r\n"
+
+func testJAR(t *testing.T, entries ...testZipEntry) string {
+	return string(testZip(t, entries...))
+}
+
+func testWAR(t *testing.T) []byte {
+	anvil := testJAR(t,
+		testZipEntry{"META-INF/MANIFEST.MF", "Manifest-Version: 1.0\nImplementation-Version: 3.1-ignored\n"},
+		testZipEntry{"META-INF/maven/org.acme.tools/anvil/pom.properties", "#Generated by Maven\ngroupId=org.acme.tools\nartifactId=anvil\nversion=3.1\n"},
+		testZipEntry{"org/acme/tools/Anvil.class", "drop"},
+	)
+
+	skates := testJAR(t,
+		testZipEntry{"META-INF/MANIFEST.MF", "Bundle-Name: Skates\nBundle-Version: 1.0\nBundle-Vendor: Wile\n"},
+	)
+
+	// a jar bundling its dependencies
+	rocket := testJAR(t,
+		testZipEntry{"META-INF/maven/org.acme/fuel/pom.properties", "groupId=org.acme\nartifactId=fuel\nversion=0.9\n"},
+		testZipEntry{"META-INF/maven/org.acme/rocket/pom.properties", "groupId = org.acme\nartifactId: rocket\nversion=2.0\n"},
+	)
+
+	fuse := testJAR(t, testZipEntry{"fuse.txt", "tick"})
+
+	return testZip(t,
+		testZipEntry{"META-INF/", ""},
+		testZipEntry{"META-INF/MANIFEST.MF", testWARManifest},
+		testZipEntry{"META-INF/maven/org.acme/rrd-web/pom.properties", "groupId=org.acme\nartifactId=rrd-web\nversion=1.2.0\n"},
+		testZipEntry{"WEB-INF/web.xml", "<web-app/>"},
+		testZipEntry{"WEB-INF/lib/anvil-3.1.jar", anvil},
+		testZipEntry{"WEB-INF/lib/skates.jar", skates},
+		testZipEntry{"WEB-INF/lib/rocket-2.0.jar", rocket},
+		testZipEntry{"WEB-INF/lib/fuse.jar", fuse},
+		testZipEntry{"WEB-INF/lib/old/anvil-3.1.jar", anvil},
+	)
+}
+
+func TestNewTagsFromJAR(t *testing.T) {
+	war := testWAR(t)
+
+	tags, err := NewTagsFromJAR(bytes.NewReader(war), int64(len(war)), &JAROptions{Name: "rrd-web-1.2.0.war"})
+	require.Nil(t, err)
+
+	var ids []string
+	for _, tag := range tags {
+		ids = append(ids, tag.TagID.String()+" "+tag.SoftwareName+" "+tag.Entities[0].EntityName)
+	}
+
+	assert.Equal(t, []string{
+		"pkg:maven/org.acme/rrd-web@1.2.0 RR Detector Web ACME",
+		"pkg:maven/org.acme.tools/anvil@3.1 anvil ACME",
+		"pkg:generic/Skates@1.0 Skates Wile",
+		"pkg:maven/org.acme/rocket@2.0 rocket ACME",
+		"pkg:generic/fuse fuse ACME",
+	}, ids)
+
+	war0 := tags[0]
+	assert.Equal(t, "1.2.0", war0.SoftwareVersion)
+	assert.Equal(t, "tagCreator distributor", war0.Entities[0].Roles.String())
+	assert.Equal(t, "detects roadrunners from a distance", (*war0.SoftwareMetas)[0].Summary)
+
+	assert.Equal(t, []string{
+		"see also https://acme.example/rrd ",
+		"component pkg:maven/org.acme.tools/anvil@3.1 required",
+		"component pkg:generic/Skates@1.0 required",
+		"component pkg:maven/org.acme/rocket@2.0 required",
+		"component pkg:generic/fuse required",
+		"installation media rrd-web-1.2.0.war ",
+	}, testLinks(war0))
+
+	media := (*war0.Links)[5]
+	assert.Equal(t, "rrd-web-1.2.0.war", media.Artifact)
+	assert.Equal(t, JARMediaType, media.MediaType)
+	sum := sha256.Sum256(war)
+	assert.Equal(t, HashEntries{{HashAlgID: Sha256, HashValue: sum[:]}}, media.Hashes)
+
+	files := testPayloadFiles(t, war0)
+	assert.Len(t, files, 8)
+
+	f := files["WEB-INF/web.xml"]
+	require.NotNil(t, f)
+	assert.Equal(t, testSha256(t, "<web-app/>"), f.Hash)
+	assert.Equal(t, int64(10), *f.Size)
+
+	assert.Contains(t, files, "WEB-INF/lib/old/anvil-3.1.jar")
+
+	anvil := tags[1]
+	assert.Nil(t, anvil.Links)
+	assert.Contains(t, testPayloadFiles(t, anvil), "org/acme/tools/Anvil.class")
+
+	// named after the archive, with no version
+	assert.Nil(t, tags[4].Links)
+	assert.Equal(t, "", tags[4].SoftwareVersion)
+}
+
+func TestNewTagsFromJAR_options(t *testing.T) {
+	creator, err := NewEntity("ACME Java", RoleTagCreator)
+	require.Nil(t, err)
+
+	jar := testZip(t,
+		testZipEntry{"META-INF/maven/org.acme/fuel/pom.properties", "groupId=org.acme\nartifactId=fuel\nversion=0.9\n"},
+		testZipEntry{"META-INF/maven/org.acme/rocket/pom.properties", "groupId=org.acme\nartifactId=rocket\nversion=2.0\n"},
+	)
+
+	tags, err := NewTagsFromJAR(bytes.NewReader(jar), int64(len(jar)), &JAROptions{
+		ImportOptions: ImportOptions{HashAlgIDs: []uint64{Sha256, Sha512}, TagCreator: creator},
+		Vendor:        "Wile",
+		Name:          "rocket-2.0.jar",
+	})
+	require.Nil(t, err)
+	require.Len(t, tags, 1)
+
+	// the archive name selects the pom.properties
+	tag := tags[0]
+	assert.Equal(t, "pkg:maven/org.acme/rocket@2.0", tag.TagID.String())
+	require.Len(t, tag.Entities, 2)
+	assert.Equal(t, "ACME Java", tag.Entities[0].EntityName)
+	assert.Equal(t, "Wile", tag.Entities[1].EntityName)
+
+	require.Len(t, *tag.Links, 1)
+	assert.Len(t, (*tag.Links)[0].Hashes, 2)
+
+	for _, f := range testPayloadFiles(t, tag) {
+		require.Len(t, f.Hashes, 1)
+		assert.Equal(t, Sha512, f.Hashes[0].HashAlgID)
+	}
+}
+
+func TestNewTagsFromJAR_ko(t *testing.T) {
+	for _, tv := range []struct {
+		jar         []byte
+		opts        *JAROptions
+		expectedErr string
+	}{
+		{[]byte("PK"), nil, "zip: not a valid zip file"},
+		{testZip(t, testZipEntry{"rrd.txt", ""}), nil, "no name: no pom.properties, manifest title or archive name"},
+		{testZip(t, testZipEntry{"rrd.txt", ""}), &JAROptions{Name: "rrd.jar"}, "no tag creator: the package has no distributor"},
+		{
+			testZip(t, testZipEntry{"META-INF/MANIFEST.MF", " orphan"}), nil,
+			"META-INF/MANIFEST.MF: line 1: continuation line without an attribute",
+		},
+		{
+			testZip(t, testZipEntry{"META-INF/MANIFEST.MF", "Implementation-Title rrd"}), nil,
+			"META-INF/MANIFEST.MF: line 1: bad format: expecting <name>: <value>",
+		},
+		{
+			testZip(t, testZipEntry{"META-INF/maven/org.acme/rrd/pom.properties", "artifactId=rrd"}), nil,
+			"META-INF/maven/org.acme/rrd/pom.properties: missing groupId or artifactId",
+		},
+		{
+			testZip(t, testZipEntry{"rrd.txt", ""}),
+			&JAROptions{ImportOptions: ImportOptions{HashAlgIDs: []uint64{Sha3_256}}, Name: "rrd.jar", Vendor: "ACME"},
+			"rrd.txt: no implementation available for hash algorithm sha3-256",
+		},
+	} {
+		_, err := NewTagsFromJAR(bytes.NewReader(tv.jar), int64(len(tv.jar)), tv.opts)
+		assert.EqualError(t, err, tv.expectedErr)
+	}
+}
+
+func TestNewTagsFromJAR_plainEntries(t *testing.T) {
+	lib := testJAR(t, testZipEntry{"META-INF/MANIFEST.MF", "Implementation-Title: librr\n"})
+
+	jar := testZip(t,
+		testZipEntry{"META-INF/MANIFEST.MF", "Implementation-Title: rrd\n"},
+		testZipEntry{"lib/broken.jar", "PK"},
+		testZipEntry{"lib/librr.jar", lib},
+	)
+
+	tags, err := NewTagsFromJAR(bytes.NewReader(jar), int64(len(jar)), &JAROptions{Vendor: "ACME"})
+	require.Nil(t, err)
+	require.Len(t, tags, 2)
+
+	// archives that cannot be read are listed with no component link
+	assert.Equal(t, []string{"component pkg:generic/librr required"}, testLinks(tags[0]))
+
+	files := testPayloadFiles(t, tags[0])
+	require.Contains(t, files, "lib/broken.jar")
+	assert.Equal(t, testSha256(t, "PK"), files["lib/broken.jar"].Hash)
+
+	// so are the archives that are too large to be read in memory
+	defer func(max uint64) { maxNestedJARSize = max }(maxNestedJARSize)
+	maxNestedJARSize = uint64(len(lib)) - 1
+
+	tags, err = NewTagsFromJAR(bytes.NewReader(jar), int64(len(jar)), &JAROptions{Vendor: "ACME"})
+	require.Nil(t, err)
+	require.Len(t, tags, 1)
+	assert.Nil(t, tags[0].Links)
+	assert.Contains(t, testPayloadFiles(t, tags[0]), "lib/librr.jar")
+}
+
+func TestNewTagsFromJAR_entryNames(t *testing.T) {
+	jar := testZip(t,
+		testZipEntry{"META-INF/MANIFEST.MF", "Implementation-Title: rrd\n"},
+		testZipEntry{"../evil", "pwned"},
+		testZipEntry{"lib/../../evil", "pwned"},
+		testZipEntry{"/etc/rrdetector.conf", "sensitivity=high"},
+	)
+
+	tags, err := NewTagsFromJAR(bytes.NewReader(jar), int64(len(jar)), &JAROptions{Vendor: "ACME"})
+	require.Nil(t, err)
+	require.Len(t, tags, 1)
+
+	// escaping entries are skipped, absolute ones have no root
+	files := testPayloadFiles(t, tags[0])
+	assert.Len(t, files, 2)
+	assert.Contains(t, files, "META-INF/MANIFEST.MF")
+	assert.Contains(t, files, "etc/rrdetector.conf")
+
+	require.Nil(t, tags[0].Payload.Walk(func(r ResolvedItem) error {
+		assert.Equal(t, "", r.Root, r.Path)
+		return nil
+	}))
+}
+
+func TestNewTagsFromJAR_nesting(t *testing.T) {
+	// each archive nests the previous one
+	jar := testJAR(t, testZipEntry{"META-INF/MANIFEST.MF", "Implementation-Title: level0\n"})
+
+	for i := 1; i <= maxJARNesting+1; i++ {
+		jar = testJAR(t,
+			testZipEntry{"META-INF/MANIFEST.MF", "Implementation-Title: level" + strings.Repeat("I", i) + "\n"},
+			testZipEntry{"lib/nested.jar", jar},
+		)
+	}
+
+	tags, err := NewTagsFromJAR(strings.NewReader(jar), int64(len(jar)), &JAROptions{Vendor: "ACME"})
+	require.Nil(t, err)
+	assert.Len(t, tags, maxJARNesting+1)
+}
@@ -148,3 +148,27 @@ func (l Link) GetOwnershipAsString() string {
 func (l Link) GetRelAsString() string {
 	return l.Rel.String()
 }
+
+// SetHrefFromHashEntry sets the href of the Link receiver to the RFC 6920 "ni"
+// URI of the supplied HashEntry
+func (l *Link) SetHrefFromHashEntry(h HashEntry) error {
+	ni, err := h.ToNI()
+	if err != nil {
+		return err
+	}
+
+	l.Href = ni
+
+	return nil
+}
+
+// HashEntryFromHref returns the HashEntry encoded in the href of the Link
+// receiver, which must be a RFC 6920 "ni" or "nih" URI
+func (l Link) HashEntryFromHref() (*HashEntry, error) {
+	h, err := ParseNamedInformation(l.Href)
+	if err != nil {
+		return nil, err
+	}
+
+	return &h, nil
+}
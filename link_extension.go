@@ -3,7 +3,10 @@
 
 package swid
 
-// LinkExtension is a placeholder for $$link-extension
+// LinkExtension models $$link-extension
 type LinkExtension struct {
-	// no link-extension defined
+	// The hashes of the referenced resource (e.g., the installation media),
+	// one per hash algorithm. In SWID XML they are serialized as a space
+	// separated list. In CoSWID they use private index -1.
+	Hashes HashEntries `cbor:"-1,keyasint,omitempty" json:"hashes,omitempty" xml:"hashes,attr,omitempty"`
 }
@@ -0,0 +1,234 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Support for the Naming Things with Hashes (RFC 6920) URI schemes:
+//
+//   ni:///sha-256;UyaQV-Ev4rdLoHyJJWCi11OHfrYv9E1aGQAlMO2X_-Q
+//   nih:sha-256-32;53269057;b
+//
+// The "ni" form carries the base64url (unpadded) encoding of the hash value,
+// whilst the human-readable "nih" form carries its hexadecimal encoding -
+// optionally broken up by dashes - followed by an optional check digit.
+
+const (
+	niScheme  = "ni"
+	nihScheme = "nih"
+)
+
+// ParseNamedInformation parses a RFC 6920 "ni" or "nih" URI into a HashEntry.
+// Authority and query components of "ni" URIs are ignored.  The "nih" form
+// accepts either the algorithm name or its numeric identifier, and if a check
+// digit is present it is verified against the hash value.
+func ParseNamedInformation(v string) (HashEntry, error) {
+	var (
+		he  HashEntry
+		err error
+	)
+
+	scheme, rest, err := splitNamedInformationScheme(v)
+	if err != nil {
+		return HashEntry{}, err
+	}
+
+	switch scheme {
+	case niScheme:
+		err = he.fromNI(rest)
+	case nihScheme:
+		err = he.fromNIH(rest)
+	}
+
+	if err != nil {
+		return HashEntry{}, err
+	}
+
+	return he, nil
+}
+
+// ToNI returns the RFC 6920 "ni" URI (with empty authority) of the HashEntry
+// receiver, e.g.: ni:///sha-256;UyaQV-Ev4rdLoHyJJWCi11OHfrYv9E1aGQAlMO2X_-Q
+func (h HashEntry) ToNI() (string, error) {
+	sAlg, err := h.namedInformationAlg()
+	if err != nil {
+		return "", err
+	}
+
+	sVal := base64.RawURLEncoding.EncodeToString(h.HashValue)
+
+	return niScheme + ":///" + sAlg + ";" + sVal, nil
+}
+
+// ToNIH returns the RFC 6920 human-readable "nih" URI of the HashEntry receiver,
+// including the check digit, e.g.: nih:sha-256-32;53269057;b
+func (h HashEntry) ToNIH() (string, error) {
+	sAlg, err := h.namedInformationAlg()
+	if err != nil {
+		return "", err
+	}
+
+	sVal := hex.EncodeToString(h.HashValue)
+
+	return nihScheme + ":" + sAlg + ";" + sVal + ";" + luhnMod16(sVal), nil
+}
+
+func (h HashEntry) namedInformationAlg() (string, error) {
+	// the unknown algorithm is not in the Named Information registry
+	if h.HashAlgID == UnknownHashAlg {
+		return "", fmt.Errorf("hash algorithm %d cannot be used in named information URIs", h.HashAlgID)
+	}
+
+	if err := ValidHashEntry(h.HashAlgID, h.HashValue); err != nil {
+		return "", err
+	}
+
+	sAlg, _ := algName(h.HashAlgID)
+
+	return sAlg, nil
+}
+
+func splitNamedInformationScheme(v string) (string, string, error) {
+	s := strings.SplitN(v, ":", 2)
+	if len(s) != 2 {
+		return "", "", fmt.Errorf("bad format: expecting ni or nih URI")
+	}
+
+	scheme := strings.ToLower(s[0])
+
+	switch scheme {
+	case niScheme, nihScheme:
+		return scheme, s[1], nil
+	default:
+		return "", "", fmt.Errorf("unsupported URI scheme %q: expecting ni or nih", s[0])
+	}
+}
+
+func isNamedInformation(v string) bool {
+	_, _, err := splitNamedInformationScheme(v)
+	return err == nil
+}
+
+// fromNI decodes "//[authority]/<alg>;<base64url-val>[?query]"
+func (h *HashEntry) fromNI(v string) error {
+	u, err := url.Parse(niScheme + ":" + v)
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(v, "//") {
+		return fmt.Errorf("bad format: expecting ni://[authority]/<hash-alg-string>;<hash-value>")
+	}
+
+	s := strings.Split(strings.TrimPrefix(u.Path, "/"), ";")
+	if len(s) != 2 || s[0] == "" || s[1] == "" {
+		return fmt.Errorf("bad format: expecting ni://[authority]/<hash-alg-string>;<hash-value>")
+	}
+
+	a, ok := LookupHashAlgorithmByName(s[0])
+	if !ok {
+		return fmt.Errorf("unknown hash algorithm %s", s[0])
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s[1], "="))
+	if err != nil {
+		return err
+	}
+
+	return h.Set(a.ID, value)
+}
+
+// fromNIH decodes "<alg>;<hex-val>[;<check-digit>]"
+func (h *HashEntry) fromNIH(v string) error {
+	s := strings.Split(v, ";")
+	if len(s) != 2 && len(s) != 3 {
+		return fmt.Errorf("bad format: expecting nih:<hash-alg>;<hex-value>[;<check-digit>]")
+	}
+
+	algID, err := nihAlgID(s[0])
+	if err != nil {
+		return err
+	}
+
+	sVal := strings.ToLower(strings.ReplaceAll(s[1], "-", ""))
+
+	value, err := hex.DecodeString(sVal)
+	if err != nil {
+		return err
+	}
+
+	if len(s) == 3 {
+		if want := luhnMod16(sVal); want != strings.ToLower(s[2]) {
+			return fmt.Errorf("check digit mismatch: want %s, got %s", want, s[2])
+		}
+	}
+
+	return h.Set(algID, value)
+}
+
+func nihAlgID(v string) (uint64, error) {
+	if a, ok := LookupHashAlgorithmByName(v); ok {
+		return a.ID, nil
+	}
+
+	// the hash algorithm can also be specified using its numeric identifier
+	algID, err := strconv.ParseUint(v, 10, 64)
+	if err == nil {
+		if _, ok := LookupHashAlgorithm(algID); ok {
+			return algID, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown hash algorithm %s", v)
+}
+
+// luhnMod16 computes the Luhn mod N (N=16) check digit of the supplied
+// lower-case hex string, as described in Section 7 of RFC 6920
+func luhnMod16(v string) string {
+	const n = 16
+
+	factor, sum := 2, 0
+
+	for i := len(v) - 1; i >= 0; i-- {
+		codePoint, _ := strconv.ParseUint(v[i:i+1], 16, 8)
+		addend := factor * int(codePoint)
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+		sum += addend/n + addend%n
+	}
+
+	return strconv.FormatInt(int64((n-sum%n)%n), 16)
+}
+
+// NIHashEntry is a HashEntry whose text representation (e.g., in JSON and XML)
+// is its RFC 6920 "ni" URI rather than the <hash-alg-string>;<hash-value> form
+// used by HashEntry. It can be used in place of HashEntry where digests are
+// exchanged as ni URIs. Its CBOR encoding is that of HashEntry.
+type NIHashEntry HashEntry
+
+// MarshalText encodes the NIHashEntry receiver as a "ni" URI
+func (h NIHashEntry) MarshalText() ([]byte, error) {
+	s, err := HashEntry(h).ToNI()
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(s), nil
+}
+
+// UnmarshalText decodes a "ni" or "nih" URI, or the text representation of a
+// HashEntry, into the NIHashEntry receiver
+func (h *NIHashEntry) UnmarshalText(data []byte) error {
+	return (*HashEntry)(h).codify(string(data))
+}
@@ -0,0 +1,233 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// test vectors from RFC 6920, Section 8
+var (
+	testHelloWorldSha256 = HashEntry{
+		HashAlgID: Sha256,
+		HashValue: MustHexDecode(nil, "7f83b1657ff1fc53b92dc18148a1d65dfc2d4b1fa3d677284addd200126d9069"),
+	}
+	testSha256_120 = HashEntry{
+		HashAlgID: Sha256_120,
+		HashValue: MustHexDecode(nil, "53269057e12fe2b74ba07c892560a2"),
+	}
+	testSha256_32 = HashEntry{
+		HashAlgID: Sha256_32,
+		HashValue: MustHexDecode(nil, "53269057"),
+	}
+)
+
+func TestParseNamedInformation_ok(t *testing.T) {
+	for _, tv := range []struct {
+		In       string
+		Expected HashEntry
+	}{
+		{
+			In:       "ni:///sha-256;f4OxZX_x_FO5LcGBSKHWXfwtSx-j1ncoSt3SABJtkGk",
+			Expected: testHelloWorldSha256,
+		},
+		{
+			In:       "ni://example.com/sha-256;f4OxZX_x_FO5LcGBSKHWXfwtSx-j1ncoSt3SABJtkGk",
+			Expected: testHelloWorldSha256,
+		},
+		{
+			In:       "ni:///sha-256-32;UyaQVw?ct=text/plain",
+			Expected: testSha256_32,
+		},
+		{
+			In:       "NI:///SHA-256-32;UyaQVw==",
+			Expected: testSha256_32,
+		},
+		{
+			In:       "nih:sha-256-120;5326-9057-e12f-e2b7-4ba0-7c89-2560-a2;f",
+			Expected: testSha256_120,
+		},
+		{
+			In:       "nih:sha-256-32;53269057;b",
+			Expected: testSha256_32,
+		},
+		{
+			In:       "nih:3;53269057e12fe2b74ba07c892560a2;f",
+			Expected: testSha256_120,
+		},
+		{
+			In:       "nih:sha-256-32;53269057",
+			Expected: testSha256_32,
+		},
+	} {
+		actual, err := ParseNamedInformation(tv.In)
+		assert.Nil(t, err, tv.In)
+		assert.Equal(t, tv.Expected, actual, tv.In)
+	}
+}
+
+func TestParseNamedInformation_ko(t *testing.T) {
+	for _, tv := range []struct {
+		In          string
+		ExpectedErr string
+	}{
+		{
+			In:          "swid:2df9de35-0aff-4a86-ace6-f7dddd1ade4c",
+			ExpectedErr: `unsupported URI scheme "swid": expecting ni or nih`,
+		},
+		{
+			In:          "sha-256;f4OxZX_x_FO5LcGBSKHWXfwtSx-j1ncoSt3SABJtkGk",
+			ExpectedErr: `bad format: expecting ni or nih URI`,
+		},
+		{
+			In:          "ni:sha-256;f4OxZX_x_FO5LcGBSKHWXfwtSx-j1ncoSt3SABJtkGk",
+			ExpectedErr: "bad format: expecting ni://[authority]/<hash-alg-string>;<hash-value>",
+		},
+		{
+			In:          "ni:///sha-256",
+			ExpectedErr: "bad format: expecting ni://[authority]/<hash-alg-string>;<hash-value>",
+		},
+		{
+			In:          "ni:///unknown;3q2-7w",
+			ExpectedErr: "unknown hash algorithm unknown",
+		},
+		{
+			In:          "ni:///sha-256;3q2-7w",
+			ExpectedErr: "length mismatch for hash algorithm sha-256: want 32 bytes, got 4",
+		},
+		{
+			In:          "ni:///sha-256;....",
+			ExpectedErr: "illegal base64 data at input byte 0",
+		},
+		{
+			In:          "nih:sha-256-32;53269057;a",
+			ExpectedErr: "check digit mismatch: want b, got a",
+		},
+		{
+			In:          "nih:sha-256-32",
+			ExpectedErr: "bad format: expecting nih:<hash-alg>;<hex-value>[;<check-digit>]",
+		},
+		{
+			In:          "nih:1024;53269057",
+			ExpectedErr: "unknown hash algorithm 1024",
+		},
+		{
+			In:          "nih:sha-256-32;5326905z",
+			ExpectedErr: "encoding/hex: invalid byte: U+007A 'z'",
+		},
+	} {
+		_, err := ParseNamedInformation(tv.In)
+		assert.EqualError(t, err, tv.ExpectedErr, tv.In)
+	}
+}
+
+func TestHashEntry_ToNI(t *testing.T) {
+	ni, err := testHelloWorldSha256.ToNI()
+	require.Nil(t, err)
+	assert.Equal(t, "ni:///sha-256;f4OxZX_x_FO5LcGBSKHWXfwtSx-j1ncoSt3SABJtkGk", ni)
+
+	_, err = HashEntry{HashAlgID: UnknownHashAlg, HashValue: []byte{0x00}}.ToNI()
+	assert.EqualError(t, err, "hash algorithm 0 cannot be used in named information URIs")
+
+	_, err = HashEntry{HashAlgID: Sha256, HashValue: []byte{0x00}}.ToNI()
+	assert.EqualError(t, err, "length mismatch for hash algorithm sha-256: want 32 bytes, got 1")
+}
+
+func TestHashEntry_ToNIH(t *testing.T) {
+	nih, err := testSha256_120.ToNIH()
+	require.Nil(t, err)
+	assert.Equal(t, "nih:sha-256-120;53269057e12fe2b74ba07c892560a2;f", nih)
+
+	nih, err = testSha256_32.ToNIH()
+	require.Nil(t, err)
+	assert.Equal(t, "nih:sha-256-32;53269057;b", nih)
+
+	_, err = HashEntry{HashAlgID: 1024, HashValue: []byte{0x00}}.ToNIH()
+	assert.EqualError(t, err, "unknown hash algorithm 1024")
+}
+
+func TestHashEntry_UnmarshalJSON_NI(t *testing.T) {
+	var actual HashEntry
+
+	err := actual.UnmarshalJSON([]byte(`"ni:///sha-256;f4OxZX_x_FO5LcGBSKHWXfwtSx-j1ncoSt3SABJtkGk"`))
+	require.Nil(t, err)
+	assert.Equal(t, testHelloWorldSha256, actual)
+
+	err = actual.UnmarshalJSON([]byte(`"nih:sha-256-32;53269057;b"`))
+	require.Nil(t, err)
+	assert.Equal(t, testSha256_32, actual)
+}
+
+func TestFile_FromXML_NI(t *testing.T) {
+	var actual File
+
+	data := []byte(`<File name="hello.txt" hash="ni:///sha-256;f4OxZX_x_FO5LcGBSKHWXfwtSx-j1ncoSt3SABJtkGk"></File>`)
+
+	require.Nil(t, xml.Unmarshal(data, &actual))
+	assert.Equal(t, testHelloWorldSha256, *actual.Hash)
+}
+
+func TestLink_HashEntryHref(t *testing.T) {
+	l, err := NewLink("", *NewRel(RelSeeAlso))
+	require.Nil(t, err)
+
+	require.Nil(t, l.SetHrefFromHashEntry(testHelloWorldSha256))
+	assert.Equal(t, "ni:///sha-256;f4OxZX_x_FO5LcGBSKHWXfwtSx-j1ncoSt3SABJtkGk", l.Href)
+
+	h, err := l.HashEntryFromHref()
+	require.Nil(t, err)
+	assert.Equal(t, testHelloWorldSha256, *h)
+
+	l.Href = "swid:2df9de35-0aff-4a86-ace6-f7dddd1ade4c"
+	_, err = l.HashEntryFromHref()
+	assert.EqualError(t, err, `unsupported URI scheme "swid": expecting ni or nih`)
+
+	err = l.SetHrefFromHashEntry(HashEntry{HashAlgID: UnknownHashAlg, HashValue: []byte{0x00}})
+	assert.EqualError(t, err, "hash algorithm 0 cannot be used in named information URIs")
+}
+
+func TestNIHashEntry_roundtrip(t *testing.T) {
+	type feed struct {
+		XMLName xml.Name    `json:"-" xml:"Feed"`
+		Digest  NIHashEntry `json:"digest" xml:"digest,attr"`
+	}
+
+	expected := feed{Digest: NIHashEntry(testHelloWorldSha256)}
+	ni := "ni:///sha-256;f4OxZX_x_FO5LcGBSKHWXfwtSx-j1ncoSt3SABJtkGk"
+
+	data, err := json.Marshal(expected)
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"digest": "`+ni+`"}`, string(data))
+
+	var actual feed
+	require.Nil(t, json.Unmarshal(data, &actual))
+	assert.Equal(t, expected.Digest, actual.Digest)
+
+	data, err = xml.Marshal(expected)
+	require.Nil(t, err)
+	assert.Equal(t, `<Feed digest="`+ni+`"></Feed>`, string(data))
+
+	actual = feed{}
+	require.Nil(t, xml.Unmarshal(data, &actual))
+	assert.Equal(t, expected.Digest, actual.Digest)
+
+	// the usual text representation is accepted on input
+	require.Nil(t, json.Unmarshal([]byte(`{"digest": "sha-256;f4OxZX/x/FO5LcGBSKHWXfwtSx+j1ncoSt3SABJtkGk="}`), &actual))
+	assert.Equal(t, expected.Digest, actual.Digest)
+
+	// the CBOR encoding is unaffected
+	niCBOR, err := em.Marshal(expected.Digest)
+	require.Nil(t, err)
+	heCBOR, err := em.Marshal(testHelloWorldSha256)
+	require.Nil(t, err)
+	assert.Equal(t, heCBOR, niCBOR)
+
+	_, err = json.Marshal(feed{Digest: NIHashEntry{HashAlgID: UnknownHashAlg, HashValue: []byte{0x00}}})
+	assert.Contains(t, err.Error(), "hash algorithm 0 cannot be used in named information URIs")
+}
@@ -0,0 +1,462 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// NPMOptions controls how ImportNPM reads an npm project
+type NPMOptions struct {
+	ImportOptions
+
+	// The distributor of the packages. If empty, "npm" is used.
+	Vendor string
+
+	// Whether to import the packages only needed for development, and the
+	// development dependencies of the project and of its workspaces
+	Dev bool
+}
+
+// npmLockfile is the subset of package-lock.json used by ImportNPM
+type npmLockfile struct {
+	LockfileVersion int                     `json:"lockfileVersion"`
+	Packages        map[string]npmLockEntry `json:"packages"`
+}
+
+type npmLockEntry struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Resolved  string `json:"resolved"`
+	Integrity string `json:"integrity"`
+	Link      bool   `json:"link"`
+	Dev       bool   `json:"dev"`
+
+	Dependencies         map[string]string `json:"dependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+}
+
+// npmManifest is the subset of package.json used by ImportNPM
+type npmManifest struct {
+	Description string          `json:"description"`
+	Homepage    string          `json:"homepage"`
+	Author      json.RawMessage `json:"author"`
+}
+
+// ImportNPM reads the package-lock.json file (lockfile version 2 or 3) of the
+// npm project in the dir directory of the supplied file system, whose root is
+// the root of the host, and the package.json files of the installed packages.
+// It returns one primary tag per package of the lockfile, including the
+// project itself and its workspaces, ordered by location. Each tag has:
+//
+//   - a package URL as tag ID, e.g., pkg:npm/%40acme/rrd@1.2.0;
+//   - the distributor (tag creator unless one is supplied) and the author as
+//     entities;
+//   - the description as software meta;
+//   - a "requires" link for each dependency, referencing the package URL of
+//     the version that node would load from the location of the package, as
+//     recorded in the lockfile. Optional dependencies are referenced with
+//     optional use, and skipped if not installed;
+//   - an "installation-media" link to the resolved tarball, carrying the
+//     integrity digests computed with a registered algorithm in the Hashes
+//     extension;
+//   - a payload with the regular files installed in the package directory,
+//     excluding nested node_modules directories.
+//
+// The project is only described if the lockfile records its name and
+// version. Workspaces with no version (e.g., private ones) are identified by a
+// package URL with no version. A package version installed at several
+// locations (e.g., nested below distinct dependents) is described by a single
+// tag, ordered by its first location, whose payload lists the files of every
+// location and whose links reference the dependencies of every location.
+func ImportNPM(fsys fs.FS, dir string, opts *NPMOptions) ([]*SoftwareIdentity, error) {
+	var o NPMOptions
+
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.Vendor == "" {
+		o.Vendor = "npm"
+	}
+
+	data, err := fs.ReadFile(fsys, path.Join(dir, "package-lock.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var lock npmLockfile
+
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("package-lock.json: %w", err)
+	}
+
+	if lock.LockfileVersion < 2 || lock.Packages == nil {
+		return nil, fmt.Errorf("package-lock.json: unsupported lockfile version %d", lock.LockfileVersion)
+	}
+
+	keys := make([]string, 0, len(lock.Packages))
+	for k := range lock.Packages {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	type located struct {
+		loc string
+		e   npmLockEntry
+		p   *installedPackage
+	}
+
+	var pkgs []located
+
+	// the index of the packages in pkgs, by package URL
+	seen := map[string]int{}
+
+	for _, k := range keys {
+		e := lock.Packages[k]
+
+		if e.Link || (e.Dev && !o.Dev) {
+			continue
+		}
+
+		name := npmPackageName(k, e)
+
+		if k == "" && (name == "" || e.Version == "") {
+			continue
+		}
+
+		loc := k
+		if loc == "" {
+			loc = "."
+		}
+
+		p, err := lock.newPackage(fsys, dir, k, name, &o)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", loc, err)
+		}
+
+		// the same version installed at several locations is described by
+		// a single tag
+		if i, ok := seen[p.purl.String()]; ok {
+			pkgs[i].p.merge(p)
+			continue
+		}
+
+		seen[p.purl.String()] = len(pkgs)
+		pkgs = append(pkgs, located{loc, e, p})
+	}
+
+	var tags []*SoftwareIdentity
+
+	for _, l := range pkgs {
+		tag, err := l.p.toTag(fsys, &o.ImportOptions)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", l.loc, err)
+		}
+
+		if err := addNPMTarballLink(tag, l.e); err != nil {
+			return nil, fmt.Errorf("%s: %w", l.loc, err)
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// merge adds to the receiver the files and the dependencies of the other copy
+// of the package, installed at a different location
+func (p *installedPackage) merge(other *installedPackage) {
+	p.files = append(p.files, other.files...)
+
+	for _, d := range other.deps {
+		found := false
+
+		for _, known := range p.deps {
+			if known == d {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			p.deps = append(p.deps, d)
+		}
+	}
+}
+
+// npmPackageName returns the name of the package at the k location, which is
+// the path of its directory below the last node_modules directory, unless the
+// lockfile records it (e.g., for the project, workspaces and aliases)
+func npmPackageName(k string, e npmLockEntry) string {
+	if e.Name != "" {
+		return e.Name
+	}
+
+	if i := strings.LastIndex(k, "node_modules/"); i >= 0 {
+		return k[i+len("node_modules/"):]
+	}
+
+	return ""
+}
+
+func npmURL(name, version string) packageURL {
+	p := packageURL{Type: "npm", Name: name, Version: version}
+
+	if strings.HasPrefix(name, "@") {
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			p.Namespace, p.Name = name[:i], name[i+1:]
+		}
+	}
+
+	return p
+}
+
+func (l npmLockfile) newPackage(fsys fs.FS, dir, k, name string, o *NPMOptions) (*installedPackage, error) {
+	e := l.Packages[k]
+
+	// only the workspaces, which are outside node_modules, may have no
+	// version
+	if name == "" || (e.Version == "" && strings.Contains(k, "node_modules/")) {
+		return nil, errors.New("missing name or version")
+	}
+
+	p := installedPackage{
+		purl:        npmURL(name, e.Version),
+		name:        name,
+		version:     e.Version,
+		distributor: o.Vendor,
+	}
+
+	pkgDir := path.Join(dir, k)
+
+	m, err := readNPMManifest(fsys, path.Join(pkgDir, "package.json"))
+	if err != nil {
+		return nil, fmt.Errorf("package.json: %w", err)
+	}
+
+	p.summary = m.Description
+	p.homepage = m.Homepage
+	p.maintainer = m.author()
+
+	type group struct {
+		deps map[string]string
+		use  int64
+	}
+
+	groups := []group{
+		{e.Dependencies, UseRequired},
+		{e.PeerDependencies, UseRequired},
+		{e.OptionalDependencies, UseOptional},
+	}
+
+	if o.Dev {
+		groups = append(groups, group{e.DevDependencies, UseRequired})
+	}
+
+	for _, g := range groups {
+		names := make([]string, 0, len(g.deps))
+		for n := range g.deps {
+			names = append(names, n)
+		}
+
+		sort.Strings(names)
+
+		for _, n := range names {
+			href, ok := l.resolve(k, n)
+			if !ok {
+				if g.use == UseOptional {
+					continue
+				}
+				href = npmURL(n, "").String()
+			}
+
+			p.deps = append(p.deps, dependency{href: href, use: g.use})
+		}
+	}
+
+	// the project files are not part of the payload
+	if k != "" {
+		p.files, err = npmInstalledFiles(fsys, pkgDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &p, nil
+}
+
+// resolve returns the package URL of the package loaded by node when the
+// package at the from location requires name: the nearest node_modules
+// directory holding name, from the package directory up to the project
+// directory. Links to workspaces are followed.
+func (l npmLockfile) resolve(from, name string) (string, bool) {
+	dir := from
+
+	for {
+		k := path.Join(dir, "node_modules", name)
+
+		if e, ok := l.Packages[k]; ok {
+			if e.Link {
+				k = e.Resolved
+				if e, ok = l.Packages[k]; !ok {
+					return "", false
+				}
+			}
+
+			return npmURL(npmPackageName(k, e), e.Version).String(), true
+		}
+
+		if dir == "" {
+			return "", false
+		}
+
+		if i := strings.LastIndex(dir, "node_modules/"); i >= 0 {
+			dir = strings.TrimSuffix(dir[:i], "/")
+		} else {
+			dir = ""
+		}
+	}
+}
+
+// readNPMManifest reads a package.json file, which may be missing (e.g., if
+// the package is not installed)
+func readNPMManifest(fsys fs.FS, name string) (npmManifest, error) {
+	var m npmManifest
+
+	data, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return m, err
+	}
+
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, err
+	}
+
+	return m, nil
+}
+
+// author returns the name of the author, who is described either by a string,
+// e.g., "Wile E. Coyote <wile@acme.example> (https://acme.example)", or by an
+// object with a name field
+func (m npmManifest) author() string {
+	var s string
+
+	if err := json.Unmarshal(m.Author, &s); err == nil {
+		if i := strings.IndexByte(s, '('); i >= 0 {
+			s = s[:i]
+		}
+		return entityName(s)
+	}
+
+	var a struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.Unmarshal(m.Author, &a); err == nil {
+		return strings.TrimSpace(a.Name)
+	}
+
+	return ""
+}
+
+// npmInstalledFiles lists the files in the directory of a package, excluding
+// the packages installed in nested node_modules directories
+func npmInstalledFiles(fsys fs.FS, pkgDir string) ([]installedFile, error) {
+	var files []installedFile
+
+	err := fs.WalkDir(fsys, pkgDir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == pkgDir {
+			return fs.SkipDir
+		} else if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if d.Name() == "node_modules" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		files = append(files, installedFile{path: "/" + p})
+
+		return nil
+	})
+
+	return files, err
+}
+
+// addNPMTarballLink links the tag to the tarball the package was installed
+// from, if it was fetched from a registry or a URL
+func addNPMTarballLink(tag *SoftwareIdentity, e npmLockEntry) error {
+	u, err := url.Parse(e.Resolved)
+	if err != nil || u.Scheme == "" || u.Scheme == "file" {
+		return nil
+	}
+
+	l, err := NewLink(e.Resolved, *NewRel(RelInstallationMedia))
+	if err != nil {
+		return err
+	}
+
+	l.Artifact = path.Base(u.Path)
+
+	l.Hashes, err = parseIntegrity(e.Integrity)
+	if err != nil {
+		return err
+	}
+
+	return tag.AddLink(*l)
+}
+
+// parseIntegrity decodes a subresource integrity value, i.e., a space
+// separated list of "<alg>-<base64 digest>" items, possibly followed by
+// options. Digests computed with algorithms missing from the registry are
+// ignored.
+func parseIntegrity(v string) (HashEntries, error) {
+	var hashes HashEntries
+
+	for _, item := range strings.Fields(v) {
+		alg, digest, ok := strings.Cut(item, "-")
+		if !ok {
+			return nil, fmt.Errorf("bad integrity %q", item)
+		}
+
+		a, ok := lookupDigestAlg(alg)
+		if !ok {
+			continue
+		}
+
+		digest, _, _ = strings.Cut(digest, "?")
+
+		value, err := base64.StdEncoding.DecodeString(digest)
+		if err != nil {
+			return nil, fmt.Errorf("bad integrity %q: %w", item, err)
+		}
+
+		var h HashEntry
+
+		if err := h.Set(a.ID, value); err != nil {
+			return nil, fmt.Errorf("bad integrity %q: %w", item, err)
+		}
+
+		hashes = append(hashes, h)
+	}
+
+	return hashes, nil
+}
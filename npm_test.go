@@ -0,0 +1,323 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testIntegrity(data string) string {
+	sum := sha512.Sum512([]byte(data))
+	return "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+var testNPMLock = `{
+  "name": "rrd-app",
+  "version": "1.0.0",
+  "lockfileVersion": 3,
+  "requires": true,
+  "packages": {
+    "": {
+      "name": "rrd-app",
+      "version": "1.0.0",
+      "workspaces": ["packages/*"],
+      "dependencies": {"@acme/rrd": "^1.2.0", "anvil": "^3.0.0", "rrd-ui": "*"},
+      "devDependencies": {"test-rig": "^1.0.0"}
+    },
+    "node_modules/@acme/rrd": {
+      "version": "1.2.0",
+      "resolved": "https://registry.npmjs.org/@acme/rrd/-/rrd-1.2.0.tgz",
+      "integrity": "sha1-AAAAAAAAAAAAAAAAAAAAAAAAAAA= ` + testIntegrity("rrd-1.2.0.tgz") + `",
+      "dependencies": {"anvil": "^2.0.0", "skates": "^1.0.0"},
+      "optionalDependencies": {"rocket": "^1.0.0", "fsevents": "^2.0.0"},
+      "peerDependencies": {"react": ">=17"}
+    },
+    "node_modules/@acme/rrd/node_modules/anvil": {
+      "version": "2.5.0",
+      "resolved": "https://registry.npmjs.org/anvil/-/anvil-2.5.0.tgz"
+    },
+    "node_modules/anvil": {
+      "version": "3.1.0",
+      "resolved": "https://registry.npmjs.org/anvil/-/anvil-3.1.0.tgz",
+      "integrity": "` + testIntegrity("anvil-3.1.0.tgz") + `"
+    },
+    "node_modules/rocket": {
+      "name": "acme-rocket",
+      "version": "1.0.0",
+      "resolved": "https://registry.npmjs.org/acme-rocket/-/acme-rocket-1.0.0.tgz",
+      "optional": true
+    },
+    "node_modules/rrd-ui": {
+      "resolved": "packages/ui",
+      "link": true
+    },
+    "node_modules/skates": {
+      "version": "1.0.0",
+      "resolved": "file:../skates"
+    },
+    "node_modules/test-rig": {
+      "version": "1.0.0",
+      "resolved": "https://registry.npmjs.org/test-rig/-/test-rig-1.0.0.tgz",
+      "dev": true
+    },
+    "packages/ui": {
+      "name": "rrd-ui",
+      "version": "0.1.0",
+      "dependencies": {"@acme/rrd": "^1.2.0"}
+    }
+  }
+}`
+
+func testNPMFS() fstest.MapFS {
+	return fstest.MapFS{
+		"srv/rrd/package-lock.json": {Data: []byte(testNPMLock)},
+		"srv/rrd/package.json":      {Data: []byte(`{"name": "rrd-app", "description": "roadrunner detection"}`)},
+		"srv/rrd/node_modules/@acme/rrd/package.json": {Data: []byte(`{
+			"name": "@acme/rrd",
+			"description": "detects roadrunners",
+			"homepage": "https://acme.example/rrd",
+			"author": "Wile E. Coyote <wile@acme.example> (https://acme.example/wile)"
+		}`)},
+		"srv/rrd/node_modules/@acme/rrd/index.js":                          {Data: []byte("module.exports = {}")},
+		"srv/rrd/node_modules/@acme/rrd/node_modules/anvil/package.json":   {Data: []byte(`{"author": {"name": "ACME"}}`)},
+		"srv/rrd/node_modules/anvil/package.json":                          {Data: []byte(`{}`)},
+		"srv/rrd/node_modules/anvil/lib/anvil.js":                          {Data: []byte("drop()")},
+		"srv/rrd/packages/ui/package.json":                                 {Data: []byte(`{"name": "rrd-ui"}`)},
+		"srv/rrd/packages/ui/node_modules/.package-lock.json":              {Data: []byte(`{}`)},
+		"srv/rrd/node_modules/@acme/rrd/node_modules/anvil/lib/anvil.js":   {Data: []byte("drop(old)")},
+		"srv/rrd/node_modules/@acme/rrd/node_modules/anvil/lib/anvil.d.ts": {Data: []byte("")},
+	}
+}
+
+func testLinks(tag *SoftwareIdentity) []string {
+	var links []string
+
+	if tag.Links == nil {
+		return nil
+	}
+
+	for _, l := range *tag.Links {
+		use := ""
+		if l.Use != nil {
+			use = l.Use.String()
+		}
+		links = append(links, l.Rel.String()+" "+l.Href+" "+use)
+	}
+
+	return links
+}
+
+func TestImportNPM(t *testing.T) {
+	tags, err := ImportNPM(testNPMFS(), "srv/rrd", nil)
+	require.Nil(t, err)
+
+	var ids []string
+	for _, tag := range tags {
+		ids = append(ids, tag.TagID.String())
+	}
+
+	assert.Equal(t, []string{
+		"pkg:npm/rrd-app@1.0.0",
+		"pkg:npm/%40acme/rrd@1.2.0",
+		"pkg:npm/anvil@2.5.0",
+		"pkg:npm/anvil@3.1.0",
+		"pkg:npm/acme-rocket@1.0.0",
+		"pkg:npm/skates@1.0.0",
+		"pkg:npm/rrd-ui@0.1.0",
+	}, ids)
+
+	app := tags[0]
+	assert.Equal(t, "roadrunner detection", (*app.SoftwareMetas)[0].Summary)
+	assert.Nil(t, app.Payload)
+	assert.Equal(t, []string{
+		"requires pkg:npm/%40acme/rrd@1.2.0 required",
+		"requires pkg:npm/anvil@3.1.0 required",
+		"requires pkg:npm/rrd-ui@0.1.0 required",
+	}, testLinks(app))
+
+	rrd := tags[1]
+	assert.Equal(t, "@acme/rrd", rrd.SoftwareName)
+	require.Len(t, rrd.Entities, 2)
+	assert.Equal(t, "npm", rrd.Entities[0].EntityName)
+	assert.Equal(t, "Wile E. Coyote", rrd.Entities[1].EntityName)
+	assert.Equal(t, "detects roadrunners", (*rrd.SoftwareMetas)[0].Summary)
+
+	// nested anvil shadows the top-level one, missing optional fsevents is
+	// skipped, missing peer react is referenced with no version
+	assert.Equal(t, []string{
+		"see also https://acme.example/rrd ",
+		"requires pkg:npm/anvil@2.5.0 required",
+		"requires pkg:npm/skates@1.0.0 required",
+		"requires pkg:npm/react required",
+		"requires pkg:npm/acme-rocket@1.0.0 optional",
+		"installation media https://registry.npmjs.org/@acme/rrd/-/rrd-1.2.0.tgz ",
+	}, testLinks(rrd))
+
+	// only the registered SHA-512 integrity digest is used
+	media := (*rrd.Links)[5]
+	assert.Equal(t, "rrd-1.2.0.tgz", media.Artifact)
+	sum := sha512.Sum512([]byte("rrd-1.2.0.tgz"))
+	assert.Equal(t, HashEntries{{HashAlgID: Sha512, HashValue: sum[:]}}, media.Hashes)
+
+	files := testPayloadFiles(t, rrd)
+	assert.Len(t, files, 2)
+	assert.Contains(t, files, "/srv/rrd/node_modules/@acme/rrd/index.js")
+	assert.NotNil(t, files["/srv/rrd/node_modules/@acme/rrd/index.js"].Size)
+
+	nested := tags[2]
+	assert.Equal(t, "ACME", nested.Entities[1].EntityName)
+	assert.Len(t, testPayloadFiles(t, nested), 3)
+
+	// not installed
+	assert.Nil(t, tags[4].Payload)
+
+	// installed from a local file
+	assert.Nil(t, tags[5].Links)
+
+	ui := tags[6]
+	assert.Equal(t, []string{"requires pkg:npm/%40acme/rrd@1.2.0 required"}, testLinks(ui))
+
+	// nested node_modules directories are skipped
+	files = testPayloadFiles(t, ui)
+	assert.Len(t, files, 1)
+	assert.Contains(t, files, "/srv/rrd/packages/ui/package.json")
+}
+
+func TestImportNPM_dev(t *testing.T) {
+	creator, err := NewEntity("ACME Frontend", RoleTagCreator)
+	require.Nil(t, err)
+
+	tags, err := ImportNPM(testNPMFS(), "srv/rrd", &NPMOptions{
+		ImportOptions: ImportOptions{HashAlgIDs: []uint64{Sha256}, TagCreator: creator},
+		Dev:           true,
+	})
+	require.Nil(t, err)
+	require.Len(t, tags, 8)
+
+	app := tags[0]
+	assert.Equal(t, "ACME Frontend", app.Entities[0].EntityName)
+	assert.Contains(t, testLinks(app), "requires pkg:npm/test-rig@1.0.0 required")
+	assert.Equal(t, "pkg:npm/test-rig@1.0.0", tags[6].TagID.String())
+
+	f := testPayloadFiles(t, tags[3])["/srv/rrd/node_modules/anvil/lib/anvil.js"]
+	require.NotNil(t, f)
+	sum := sha256.Sum256([]byte("drop()"))
+	assert.Equal(t, &HashEntry{HashAlgID: Sha256, HashValue: sum[:]}, f.Hash)
+}
+
+func TestImportNPM_workspaces(t *testing.T) {
+	lock := `{
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"workspaces": ["packages/*"], "dependencies": {"rrd-cli": "*"}},
+    "node_modules/rrd-cli": {"resolved": "packages/cli", "link": true},
+    "packages/cli": {"name": "rrd-cli"}
+  }
+}`
+
+	tags, err := ImportNPM(fstest.MapFS{"package-lock.json": {Data: []byte(lock)}}, ".", nil)
+	require.Nil(t, err)
+
+	// the project has no name, the private workspace no version
+	require.Len(t, tags, 1)
+	assert.Equal(t, "pkg:npm/rrd-cli", tags[0].TagID.String())
+	assert.Equal(t, "", tags[0].SoftwareVersion)
+}
+
+func TestImportNPM_duplicates(t *testing.T) {
+	lock := `{
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "rrd-app", "version": "1.0.0", "dependencies": {"anvil": "^3.0.0", "rocket": "^1.0.0"}},
+    "node_modules/anvil": {"version": "3.1.0"},
+    "node_modules/rocket": {"version": "1.0.0", "dependencies": {"anvil": "^2.0.0", "skates": "^1.0.0"}},
+    "node_modules/rocket/node_modules/anvil": {"version": "2.5.0", "dependencies": {"fuse": "^1.0.0"}},
+    "node_modules/rocket/node_modules/anvil/node_modules/fuse": {"version": "1.0.0"},
+    "node_modules/skates": {"version": "1.0.0", "dependencies": {"anvil": "^2.0.0"}},
+    "node_modules/skates/node_modules/anvil": {"version": "2.5.0", "dependencies": {"fuse": "^1.0.0"}},
+    "node_modules/skates/node_modules/anvil/node_modules/fuse": {"version": "1.0.0"}
+  }
+}`
+
+	fsys := fstest.MapFS{
+		"package-lock.json": {Data: []byte(lock)},
+		"package.json":      {Data: []byte(`{}`)},
+		"node_modules/rocket/node_modules/anvil/package.json":                   {Data: []byte(`{}`)},
+		"node_modules/rocket/node_modules/anvil/node_modules/fuse/package.json": {Data: []byte(`{}`)},
+		"node_modules/skates/node_modules/anvil/package.json":                   {Data: []byte(`{}`)},
+	}
+
+	tags, err := ImportNPM(fsys, ".", &NPMOptions{Vendor: "ACME"})
+	require.Nil(t, err)
+
+	var ids []string
+	for _, tag := range tags {
+		ids = append(ids, tag.TagID.String())
+	}
+
+	// one tag per package version
+	assert.Equal(t, []string{
+		"pkg:npm/rrd-app@1.0.0",
+		"pkg:npm/anvil@3.1.0",
+		"pkg:npm/rocket@1.0.0",
+		"pkg:npm/anvil@2.5.0",
+		"pkg:npm/fuse@1.0.0",
+		"pkg:npm/skates@1.0.0",
+	}, ids)
+
+	// the files of both locations, and the dependencies once
+	anvil := tags[3]
+	assert.Equal(t, []string{"requires pkg:npm/fuse@1.0.0 required"}, testLinks(anvil))
+
+	files := testPayloadFiles(t, anvil)
+	assert.Len(t, files, 2)
+	assert.Contains(t, files, "/node_modules/rocket/node_modules/anvil/package.json")
+	assert.Contains(t, files, "/node_modules/skates/node_modules/anvil/package.json")
+}
+
+func TestImportNPM_ko(t *testing.T) {
+	_, err := ImportNPM(fstest.MapFS{}, ".", nil)
+	assert.EqualError(t, err, "open package-lock.json: file does not exist")
+
+	for _, tv := range []struct {
+		lock        string
+		manifest    string
+		expectedErr string
+	}{
+		{`[]`, "", "package-lock.json: json: cannot unmarshal array into Go value of type swid.npmLockfile"},
+		{`{"lockfileVersion": 1, "dependencies": {}}`, "", "package-lock.json: unsupported lockfile version 1"},
+		{`{"lockfileVersion": 2, "packages": {"node_modules/anvil": {}}}`, "", "node_modules/anvil: missing name or version"},
+		{`{"lockfileVersion": 2, "packages": {"": {"name": "app", "version": "1.0.0"}}}`, "{", ".: package.json: unexpected end of JSON input"},
+		{
+			`{"lockfileVersion": 2, "packages": {"node_modules/anvil": {"version": "1.0.0", "resolved": "https://acme.example/anvil.tgz", "integrity": "sha512"}}}`,
+			"", `node_modules/anvil: bad integrity "sha512"`,
+		},
+		{
+			`{"lockfileVersion": 2, "packages": {"node_modules/anvil": {"version": "1.0.0", "resolved": "https://acme.example/anvil.tgz", "integrity": "sha512-!"}}}`,
+			"", `node_modules/anvil: bad integrity "sha512-!": illegal base64 data at input byte 0`,
+		},
+		{
+			`{"lockfileVersion": 2, "packages": {"node_modules/anvil": {"version": "1.0.0", "resolved": "https://acme.example/anvil.tgz", "integrity": "sha512-AAAA"}}}`,
+			"", `node_modules/anvil: bad integrity "sha512-AAAA": length mismatch for hash algorithm sha-512: want 64 bytes, got 3`,
+		},
+	} {
+		fsys := fstest.MapFS{"package-lock.json": {Data: []byte(tv.lock)}}
+		if tv.manifest != "" {
+			fsys["package.json"] = &fstest.MapFile{Data: []byte(tv.manifest)}
+		}
+
+		_, err := ImportNPM(fsys, ".", nil)
+		assert.EqualError(t, err, tv.expectedErr)
+	}
+
+	_, err = ImportNPM(testNPMFS(), "srv/rrd", &NPMOptions{ImportOptions: ImportOptions{HashAlgIDs: []uint64{Sha3_256}}})
+	assert.EqualError(t, err, "node_modules/@acme/rrd: /srv/rrd/node_modules/@acme/rrd/index.js: no implementation available for hash algorithm sha3-256")
+}
@@ -0,0 +1,318 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// VariableTable resolves the names of the variables referenced in tag paths
+// (e.g., "programdata" in "%programdata%") to their values
+type VariableTable func(name string) (string, bool)
+
+// NewVariableTable returns a VariableTable backed by the supplied map. If
+// caseInsensitive is true, names are looked up ignoring case, as done by
+// Windows for environment variables.
+func NewVariableTable(vars map[string]string, caseInsensitive bool) VariableTable {
+	m := make(map[string]string, len(vars))
+
+	for k, v := range vars {
+		if caseInsensitive {
+			k = strings.ToUpper(k)
+		}
+		m[k] = v
+	}
+
+	return func(name string) (string, bool) {
+		if caseInsensitive {
+			name = strings.ToUpper(name)
+		}
+		v, ok := m[name]
+		return v, ok
+	}
+}
+
+// EnvVariableTable resolves variables using the environment of the running
+// process
+var EnvVariableTable VariableTable = os.LookupEnv
+
+// VariableSyntax identifies how variables are referenced in tag paths
+type VariableSyntax int
+
+const (
+	// PercentVariables references are of the form %NAME%
+	PercentVariables VariableSyntax = iota
+	// DollarVariables references are of the form $NAME or ${NAME}
+	DollarVariables
+)
+
+// PathProfile describes the conventions of the platform on which a tag was
+// produced, so that the roots and locations found in the tag can be mapped
+// onto local paths
+type PathProfile struct {
+	// The table used to expand variables. If nil, paths referencing
+	// variables cannot be expanded.
+	Variables VariableTable
+
+	// The syntax of variable references
+	Syntax VariableSyntax
+
+	// Whether backslashes are path separators. If so, they are converted to
+	// forward slashes.
+	BackslashSeparator bool
+
+	// Whether file names are case insensitive
+	CaseInsensitive bool
+
+	// Whether paths may start with a volume name (e.g., "C:"). Volume names
+	// are dropped when paths are mapped onto a file system.
+	VolumeNames bool
+}
+
+// WindowsPathProfile returns the profile of tags produced on Windows: %NAME%
+// variables, backslash separators, volume names and case insensitive file
+// names
+func WindowsPathProfile(vars VariableTable) *PathProfile {
+	return &PathProfile{
+		Variables:          vars,
+		Syntax:             PercentVariables,
+		BackslashSeparator: true,
+		CaseInsensitive:    true,
+		VolumeNames:        true,
+	}
+}
+
+// POSIXPathProfile returns the profile of tags produced on POSIX systems:
+// $NAME and ${NAME} variables, forward slash separators and case sensitive
+// file names
+func POSIXPathProfile(vars VariableTable) *PathProfile {
+	return &PathProfile{
+		Variables: vars,
+		Syntax:    DollarVariables,
+	}
+}
+
+// Expand expands the variables referenced in p and normalises its separators.
+// The returned path is slash separated and cleaned, unless it is empty.
+func (pp PathProfile) Expand(p string) (string, error) {
+	var (
+		s   string
+		err error
+	)
+
+	switch pp.Syntax {
+	case PercentVariables:
+		s, err = pp.expandPercent(p)
+	case DollarVariables:
+		s, err = pp.expandDollar(p)
+	default:
+		return "", fmt.Errorf("unknown variable syntax %d", pp.Syntax)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if pp.BackslashSeparator {
+		s = strings.ReplaceAll(s, `\`, "/")
+	}
+
+	if s == "" {
+		return "", nil
+	}
+
+	return path.Clean(s), nil
+}
+
+// LocalPath returns the expanded and normalised path of the supplied item,
+// including its root
+func (pp PathProfile) LocalPath(r ResolvedItem) (string, error) {
+	root, err := pp.Expand(r.Root)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := pp.Expand(r.Path)
+	if err != nil {
+		return "", err
+	}
+
+	if pp.IsAbs(p) {
+		return p, nil
+	}
+
+	return path.Join(root, p), nil
+}
+
+// IsAbs returns true if the supplied expanded path is absolute, i.e., it
+// starts with a slash or, if allowed by the profile, a volume name
+func (pp PathProfile) IsAbs(p string) bool {
+	t := pp.trimVolume(p)
+
+	return t != p || strings.HasPrefix(t, "/")
+}
+
+func (pp PathProfile) trimVolume(p string) string {
+	if pp.VolumeNames && len(p) >= 2 && p[1] == ':' && isASCIILetter(p[0]) {
+		return p[2:]
+	}
+	return p
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// fsPath maps an absolute expanded path onto the file system, whose root is
+// assumed to correspond to the root of the volume
+func (pp PathProfile) fsPath(p string) (string, error) {
+	s := strings.TrimLeft(pp.trimVolume(p), "/")
+	if s == "" {
+		s = "."
+	}
+
+	s = path.Clean(s)
+	if !fs.ValidPath(s) {
+		return "", fmt.Errorf("path %q is outside the file system", p)
+	}
+
+	return s, nil
+}
+
+func (pp PathProfile) lookup(name string) (string, error) {
+	if pp.Variables != nil {
+		if v, ok := pp.Variables(name); ok {
+			return v, nil
+		}
+	}
+
+	return "", fmt.Errorf("undefined variable %q", name)
+}
+
+// expandPercent expands %NAME% references. An unpaired % is kept as is.
+func (pp PathProfile) expandPercent(p string) (string, error) {
+	var b strings.Builder
+
+	for {
+		i := strings.IndexByte(p, '%')
+		if i < 0 {
+			break
+		}
+
+		j := strings.IndexByte(p[i+1:], '%')
+		if j < 0 {
+			break
+		}
+
+		name := p[i+1 : i+1+j]
+		if name == "" {
+			// %% is an escaped %
+			b.WriteString(p[:i+1])
+			p = p[i+2:]
+			continue
+		}
+
+		v, err := pp.lookup(name)
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(p[:i])
+		b.WriteString(v)
+		p = p[i+2+j:]
+	}
+
+	b.WriteString(p)
+
+	return b.String(), nil
+}
+
+// expandDollar expands $NAME and ${NAME} references. A $ not followed by a
+// name is kept as is.
+func (pp PathProfile) expandDollar(p string) (string, error) {
+	var b strings.Builder
+
+	for {
+		i := strings.IndexByte(p, '$')
+		if i < 0 || i == len(p)-1 {
+			break
+		}
+
+		b.WriteString(p[:i])
+		p = p[i+1:]
+
+		var name string
+
+		if p[0] == '{' {
+			j := strings.IndexByte(p, '}')
+			if j < 0 {
+				return "", errors.New("unterminated variable reference")
+			}
+			name, p = p[1:j], p[j+1:]
+			if name == "" {
+				return "", errors.New("empty variable reference")
+			}
+		} else {
+			j := 0
+			for j < len(p) && isVariableNameChar(p[j], j == 0) {
+				j++
+			}
+			if j == 0 {
+				b.WriteByte('$')
+				continue
+			}
+			name, p = p[:j], p[j:]
+		}
+
+		v, err := pp.lookup(name)
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(v)
+	}
+
+	b.WriteString(p)
+
+	return b.String(), nil
+}
+
+func isVariableNameChar(c byte, first bool) bool {
+	return c == '_' || isASCIILetter(c) || (!first && c >= '0' && c <= '9')
+}
+
+// resolveFold maps the slash separated path p onto the name used in fsys,
+// matching each element ignoring case if no exact match exists. Elements that
+// cannot be matched are kept as they are.
+func resolveFold(fsys fs.FS, p string) string {
+	if p == "." {
+		return p
+	}
+
+	cur := "."
+
+	for _, elem := range strings.Split(p, "/") {
+		next := path.Join(cur, elem)
+
+		if _, err := fs.Stat(fsys, next); err != nil {
+			if entries, err := fs.ReadDir(fsys, cur); err == nil {
+				for _, e := range entries {
+					if strings.EqualFold(e.Name(), elem) {
+						next = path.Join(cur, e.Name())
+						break
+					}
+				}
+			}
+		}
+
+		cur = next
+	}
+
+	return cur
+}
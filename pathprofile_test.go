@@ -0,0 +1,208 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testWindowsVars = NewVariableTable(map[string]string{
+	"ProgramData":  `C:\ProgramData`,
+	"ProgramFiles": `C:\Program Files`,
+	"USERPROFILE":  `C:\Users\wile`,
+}, true)
+
+var testPOSIXVars = NewVariableTable(map[string]string{
+	"HOME":   "/home/wile",
+	"PREFIX": "/opt/acme/",
+}, false)
+
+func TestNewVariableTable(t *testing.T) {
+	v, ok := testWindowsVars("programdata")
+	assert.True(t, ok)
+	assert.Equal(t, `C:\ProgramData`, v)
+
+	_, ok = testPOSIXVars("home")
+	assert.False(t, ok)
+}
+
+func TestPathProfile_Expand_windows(t *testing.T) {
+	pp := WindowsPathProfile(testWindowsVars)
+
+	for _, tv := range []struct {
+		In       string
+		Expected string
+	}{
+		{"", ""},
+		{"%programdata%", "C:/ProgramData"},
+		{`%ProgramFiles%\Acme\..\Acme Corp\`, "C:/Program Files/Acme Corp"},
+		{`acme\rrdetector/bin`, "acme/rrdetector/bin"},
+		{`%USERPROFILE%\100%%`, "C:/Users/wile/100%"},
+		{"50% off", "50% off"},
+		{"$HOME", "$HOME"},
+	} {
+		actual, err := pp.Expand(tv.In)
+		assert.Nil(t, err, tv.In)
+		assert.Equal(t, tv.Expected, actual, tv.In)
+	}
+
+	_, err := pp.Expand("%windir%/system32")
+	assert.EqualError(t, err, `undefined variable "windir"`)
+
+	assert.True(t, pp.IsAbs("C:/ProgramData"))
+	assert.True(t, pp.IsAbs("/ProgramData"))
+	assert.False(t, pp.IsAbs("ProgramData"))
+}
+
+func TestPathProfile_Expand_posix(t *testing.T) {
+	pp := POSIXPathProfile(testPOSIXVars)
+
+	for _, tv := range []struct {
+		In       string
+		Expected string
+	}{
+		{"$HOME/.config", "/home/wile/.config"},
+		{"${PREFIX}lib", "/opt/acme/lib"},
+		{`$PREFIX/share\doc`, `/opt/acme/share\doc`},
+		{"cost$", "cost$"},
+		{"$1.00", "$1.00"},
+		{"%programdata%", "%programdata%"},
+	} {
+		actual, err := pp.Expand(tv.In)
+		assert.Nil(t, err, tv.In)
+		assert.Equal(t, tv.Expected, actual, tv.In)
+	}
+
+	for _, tv := range []struct {
+		In          string
+		ExpectedErr string
+	}{
+		{"$home", `undefined variable "home"`},
+		{"${HOME", "unterminated variable reference"},
+		{"${}", "empty variable reference"},
+	} {
+		_, err := pp.Expand(tv.In)
+		assert.EqualError(t, err, tv.ExpectedErr)
+	}
+
+	assert.False(t, pp.IsAbs("C:/ProgramData"))
+
+	_, err := PathProfile{Syntax: 42}.Expand("")
+	assert.EqualError(t, err, "unknown variable syntax 42")
+}
+
+func TestPathProfile_LocalPath(t *testing.T) {
+	pp := WindowsPathProfile(testWindowsVars)
+
+	for _, tv := range []struct {
+		In       ResolvedItem
+		Expected string
+	}{
+		{ResolvedItem{Root: "%programdata%", Path: `acme\rrdetector.exe`}, "C:/ProgramData/acme/rrdetector.exe"},
+		{ResolvedItem{Path: `bin\rrdetector.exe`}, "bin/rrdetector.exe"},
+		{ResolvedItem{Root: "%programdata%", Path: `%programfiles%\acme`}, "C:/Program Files/acme"},
+	} {
+		actual, err := pp.LocalPath(tv.In)
+		assert.Nil(t, err)
+		assert.Equal(t, tv.Expected, actual)
+	}
+
+	_, err := pp.LocalPath(ResolvedItem{Root: "%temp%"})
+	assert.EqualError(t, err, `undefined variable "temp"`)
+
+	_, err = pp.LocalPath(ResolvedItem{Root: "%programdata%", Path: "%temp%"})
+	assert.EqualError(t, err, `undefined variable "temp"`)
+}
+
+func TestVerifyPayload_windows_profile(t *testing.T) {
+	data := []byte("roadrunner detector")
+
+	fsys := fstest.MapFS{
+		"ProgramData/ACME/RRDetector/rrdetector.exe": {Data: data},
+		"ProgramData/ACME/RRDetector/plugins.dll":    {Data: data},
+		"Program Files/Acme/README.txt":              {Data: data},
+	}
+
+	h := testSha256(t, string(data))
+	size := int64(len(data))
+
+	p := NewPayload()
+	require.Nil(t, p.AddDirectory(Directory{
+		FileSystemItem: FileSystemItem{
+			Root:     "%programdata%",
+			Location: `acme`,
+			FsName:   "rrdetector",
+		},
+		PathElements: &PathElements{
+			Files: &Files{
+				{FileSystemItem: FileSystemItem{FsName: "RRDETECTOR.EXE"}, Size: &size, Hash: h},
+			},
+		},
+	}))
+	require.Nil(t, p.AddFile(File{FileSystemItem: FileSystemItem{
+		Root:     "%ProgramFiles%",
+		Location: `Acme\docs`,
+		FsName:   "README.txt",
+	}}))
+	require.Nil(t, p.AddFile(File{FileSystemItem: FileSystemItem{
+		Root:   "%temp%",
+		FsName: "rr.log",
+	}}))
+
+	tag, err := NewTag("com.acme.rrd2013-ce-sp1-v4-1-5-0", "ACME Roadrunner Detector", "4.1.5")
+	require.Nil(t, err)
+	tag.Payload = p
+
+	// without a profile, variable roots cannot be resolved
+	v, err := VerifyPayload(tag, fsys, nil)
+	require.Nil(t, err)
+	assert.Len(t, v.Missing, 3)
+	assert.Equal(t, `unknown root "%programdata%"`, v.Missing[0].Reason)
+
+	v, err = VerifyPayload(tag, fsys, &VerifyOptions{
+		Profile: WindowsPathProfile(testWindowsVars),
+	})
+	require.Nil(t, err)
+
+	require.Len(t, v.Verified, 1)
+	assert.Equal(t, "ProgramData/ACME/RRDetector/rrdetector.exe", v.Verified[0].FSPath)
+	assert.Equal(t, 1, v.Verified[0].HashesChecked)
+
+	require.Len(t, v.Missing, 2)
+	assert.Equal(t, "Program Files/Acme/docs/README.txt", v.Missing[0].FSPath)
+	assert.Equal(t, "not found", v.Missing[0].Reason)
+	assert.Equal(t, `undefined variable "temp"`, v.Missing[1].Reason)
+
+	assert.Equal(t, []string{"ProgramData/ACME/RRDetector/plugins.dll"}, v.Unexpected)
+}
+
+func TestVerifyPayload_posix_profile(t *testing.T) {
+	tag := testTagFromFS(t, testFS, "opt/acme", &PayloadOptions{Root: "$PREFIX"})
+
+	v, err := VerifyPayload(tag, testFS, &VerifyOptions{
+		Profile: POSIXPathProfile(testPOSIXVars),
+	})
+	require.Nil(t, err)
+	assert.True(t, v.OK())
+	assert.Len(t, v.Verified, 7)
+
+	// explicit root mappings take precedence
+	v, err = VerifyPayload(tag, testFS, &VerifyOptions{
+		Roots:   map[string]string{"$PREFIX": "opt"},
+		Profile: POSIXPathProfile(testPOSIXVars),
+	})
+	require.Nil(t, err)
+	assert.Len(t, v.Missing, 7)
+
+	// relative expansions cannot be mapped
+	v, err = VerifyPayload(tag, testFS, &VerifyOptions{
+		Profile: POSIXPathProfile(NewVariableTable(map[string]string{"PREFIX": "opt/acme"}, false)),
+	})
+	require.Nil(t, err)
+	assert.Equal(t, `root "$PREFIX" does not expand to an absolute path`, v.Missing[0].Reason)
+}
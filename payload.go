@@ -37,6 +37,18 @@ func (p *Payload) AddFile(f File) error {
 	return nil
 }
 
+// AddProcess adds the supplied Process to the embedded ResourceCollection of the
+// Payload receiver
+func (p *Payload) AddProcess(pr Process) error {
+	if p.Processes == nil {
+		p.Processes = new(Processes)
+	}
+
+	*p.Processes = append(*p.Processes, pr)
+
+	return nil
+}
+
 // AddResource adds the supplied Directory to the ResourceCollection of the
 // Payload receiver
 func (p *Payload) AddResource(r Resource) error {
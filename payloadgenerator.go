@@ -0,0 +1,305 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// PayloadOptions controls how NewPayloadFromFS builds the resource collection
+// from a file system tree
+type PayloadOptions struct {
+	// The algorithms used to hash each file. The first hash is stored in
+	// File.Hash, any further one in the Hashes extension. If empty, files
+	// are hashed with SHA-256.
+	HashAlgIDs []uint64
+
+	// The number of files hashed concurrently. If zero, the number of CPUs is
+	// used.
+	Workers int
+
+	// If not empty, only files matching at least one of these patterns are
+	// included. Directories left empty as a result are not included.
+	Include []string
+
+	// Files and directories matching any of these patterns are skipped.
+	Exclude []string
+
+	// Files matching any of these patterns are marked as key files.
+	Key []string
+
+	// If set, the root of the items at the top of the generated tree.
+	Root string
+}
+
+// Patterns use the syntax of path.Match and are matched against the slash
+// separated path relative to the walked directory, e.g., "bin/*.so".  Patterns
+// without a slash are also matched against the base name, e.g., "*.so".
+func matchAny(patterns []string, rel string) (bool, error) {
+	for _, p := range patterns {
+		name := rel
+		if !strings.Contains(p, "/") {
+			name = path.Base(rel)
+		}
+
+		ok, err := path.Match(p, name)
+		if err != nil {
+			return false, fmt.Errorf("bad pattern %q: %w", p, err)
+		}
+
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// NewPayloadFromFS walks the file system fsys starting at dir and returns a
+// Payload with the nested directories and files found there, including file
+// sizes and hashes. Entries are sorted by name so that the output is
+// reproducible. Only regular files and directories are considered, other
+// types of entries (e.g., symbolic links) are skipped.
+func NewPayloadFromFS(fsys fs.FS, dir string, opts *PayloadOptions) (*Payload, error) {
+	pe, err := pathElementsFromFS(fsys, dir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	p := NewPayload()
+	p.PathElements = *pe
+
+	return p, nil
+}
+
+type hashJob struct {
+	path string
+	file *File
+}
+
+type fsWalker struct {
+	fsys fs.FS
+	opts PayloadOptions
+	jobs []hashJob
+}
+
+func newFSWalker(fsys fs.FS, opts *PayloadOptions) *fsWalker {
+	w := fsWalker{fsys: fsys}
+
+	if opts != nil {
+		w.opts = *opts
+	}
+
+	if len(w.opts.HashAlgIDs) == 0 {
+		w.opts.HashAlgIDs = []uint64{Sha256}
+	}
+
+	if w.opts.Workers <= 0 {
+		w.opts.Workers = runtime.NumCPU()
+	}
+
+	return &w
+}
+
+func pathElementsFromFS(fsys fs.FS, dir string, opts *PayloadOptions) (*PathElements, error) {
+	w := newFSWalker(fsys, opts)
+
+	pe, err := w.walk(dir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.hashAll(); err != nil {
+		return nil, err
+	}
+
+	if w.opts.Root != "" {
+		setRoot(pe, w.opts.Root)
+	}
+
+	return pe, nil
+}
+
+func setRoot(pe *PathElements, root string) {
+	if pe.Directories != nil {
+		for i := range *pe.Directories {
+			(*pe.Directories)[i].Root = root
+		}
+	}
+
+	if pe.Files != nil {
+		for i := range *pe.Files {
+			(*pe.Files)[i].Root = root
+		}
+	}
+}
+
+// walk builds the PathElements for the directory at p (rel is the same
+// directory relative to the starting point of the walk) and queues its files
+// for hashing
+func (w *fsWalker) walk(p, rel string) (*PathElements, error) {
+	entries, err := fs.ReadDir(w.fsys, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		dirs  Directories
+		files Files
+	)
+
+	for _, e := range entries {
+		eRel := path.Join(rel, e.Name())
+
+		excluded, err := matchAny(w.opts.Exclude, eRel)
+		if err != nil {
+			return nil, err
+		}
+
+		if excluded {
+			continue
+		}
+
+		switch {
+		case e.IsDir():
+			sub, err := w.walk(path.Join(p, e.Name()), eRel)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(w.opts.Include) != 0 && sub.Directories == nil && sub.Files == nil {
+				continue
+			}
+
+			dirs = append(dirs, Directory{
+				FileSystemItem: FileSystemItem{FsName: e.Name()},
+				PathElements:   sub,
+			})
+		case e.Type().IsRegular():
+			info, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+
+			f, err := w.newFile(info, eRel)
+			if err != nil {
+				return nil, err
+			}
+
+			if f != nil {
+				files = append(files, *f)
+			}
+		}
+	}
+
+	pe := PathElements{}
+
+	if len(dirs) != 0 {
+		pe.Directories = &dirs
+	}
+
+	if len(files) != 0 {
+		pe.Files = &files
+
+		// files is final at this point, so its elements can be safely
+		// referenced by the hashing jobs
+		for i := range files {
+			w.jobs = append(w.jobs, hashJob{
+				path: path.Join(p, files[i].FsName),
+				file: &files[i],
+			})
+		}
+	}
+
+	return &pe, nil
+}
+
+func (w *fsWalker) newFile(info fs.FileInfo, rel string) (*File, error) {
+	if len(w.opts.Include) != 0 {
+		included, err := matchAny(w.opts.Include, rel)
+		if err != nil || !included {
+			return nil, err
+		}
+	}
+
+	size := info.Size()
+
+	f := File{
+		FileSystemItem: FileSystemItem{FsName: info.Name()},
+		Size:           &size,
+	}
+
+	key, err := matchAny(w.opts.Key, rel)
+	if err != nil {
+		return nil, err
+	}
+
+	if key {
+		f.Key = &key
+	}
+
+	return &f, nil
+}
+
+// hashAll hashes the queued files using a pool of workers. If hashing fails
+// for more than one file, the error relating to the first file in walk order
+// is returned.
+func (w *fsWalker) hashAll() error {
+	var wg sync.WaitGroup
+
+	errs := make([]error, len(w.jobs))
+	idx := make(chan int)
+
+	for i := 0; i < w.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range idx {
+				j := w.jobs[i]
+				errs[i] = hashFile(w.fsys, j.path, w.opts.HashAlgIDs, j.file)
+			}
+		}()
+	}
+
+	for i := range w.jobs {
+		idx <- i
+	}
+
+	close(idx)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func hashFile(fsys fs.FS, name string, algIDs []uint64, f *File) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hashes, err := computeHashEntries(algIDs, file)
+	if err != nil {
+		return fmt.Errorf("hashing %s: %w", name, err)
+	}
+
+	for _, h := range hashes {
+		if err := f.AddHash(h); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"crypto/sha256"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFS = fstest.MapFS{
+	"opt/acme/bin/rrdetector":       {Data: []byte("roadrunner detector")},
+	"opt/acme/lib/librr.so":         {Data: []byte("roadrunner library")},
+	"opt/acme/lib/librr.a":          {Data: []byte("roadrunner archive")},
+	"opt/acme/share/doc/README":     {Data: []byte("beep beep")},
+	"opt/acme/etc/rrdetector.conf":  {Data: []byte("sensitivity=high")},
+	"opt/acme/var/cache/.keep":      {Data: []byte{}},
+	"opt/acme/bin/rrdetector-link":  {Data: []byte("rrdetector"), Mode: 0777 | fs.ModeSymlink},
+	"opt/acme/share/doc/LICENSE.md": {Data: []byte("MIT")},
+}
+
+func testSha256(t *testing.T, data string) *HashEntry {
+	sum := sha256.Sum256([]byte(data))
+	return &HashEntry{HashAlgID: Sha256, HashValue: sum[:]}
+}
+
+func TestNewPayloadFromFS_full(t *testing.T) {
+	p, err := NewPayloadFromFS(testFS, "opt/acme", &PayloadOptions{
+		Key:  []string{"bin/*"},
+		Root: "/opt/acme",
+	})
+	require.Nil(t, err)
+
+	dirs := *p.Directories
+	require.Len(t, dirs, 5)
+	assert.Nil(t, p.Files)
+
+	for i, name := range []string{"bin", "etc", "lib", "share", "var"} {
+		assert.Equal(t, name, dirs[i].FsName)
+		assert.Equal(t, "/opt/acme", dirs[i].Root)
+	}
+
+	// symlinks are skipped
+	bin := *dirs[0].Files
+	require.Len(t, bin, 1)
+	assert.Equal(t, "rrdetector", bin[0].FsName)
+	assert.Equal(t, int64(19), *bin[0].Size)
+	assert.Equal(t, testSha256(t, "roadrunner detector"), bin[0].Hash)
+	assert.True(t, *bin[0].Key)
+	assert.Equal(t, "", bin[0].Root)
+
+	lib := *dirs[2].Files
+	require.Len(t, lib, 2)
+	assert.Equal(t, "librr.a", lib[0].FsName)
+	assert.Equal(t, "librr.so", lib[1].FsName)
+	assert.Nil(t, lib[1].Key)
+
+	doc := (*dirs[3].Directories)[0]
+	assert.Equal(t, "doc", doc.FsName)
+	assert.Len(t, *doc.Files, 2)
+
+	cache := (*dirs[4].Directories)[0]
+	assert.Equal(t, testSha256(t, ""), (*cache.Files)[0].Hash)
+}
+
+func TestNewPayloadFromFS_include_exclude(t *testing.T) {
+	p, err := NewPayloadFromFS(testFS, "opt", &PayloadOptions{
+		Include: []string{"*.so", "acme/etc/*"},
+		Exclude: []string{"acme/etc"},
+	})
+	require.Nil(t, err)
+
+	acme := (*p.Directories)[0]
+	assert.Equal(t, "acme", acme.FsName)
+
+	// only lib survives
+	require.Len(t, *acme.Directories, 1)
+	lib := (*acme.Directories)[0]
+	assert.Equal(t, "lib", lib.FsName)
+	require.Len(t, *lib.Files, 1)
+	assert.Equal(t, "librr.so", (*lib.Files)[0].FsName)
+}
+
+func TestNewPayloadFromFS_empty_dirs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/empty": {Mode: fs.ModeDir},
+		"a/file":  {Data: []byte("x")},
+	}
+
+	p, err := NewPayloadFromFS(fsys, "a", nil)
+	require.Nil(t, err)
+
+	empty := (*p.Directories)[0]
+	assert.Equal(t, "empty", empty.FsName)
+	assert.Equal(t, &PathElements{}, empty.PathElements)
+	assert.Equal(t, "file", (*p.Files)[0].FsName)
+}
+
+func TestNewPayloadFromFS_deterministic(t *testing.T) {
+	opts := PayloadOptions{
+		HashAlgIDs: []uint64{Sha256, Sha512},
+		Workers:    1,
+	}
+
+	p1, err := NewPayloadFromFS(testFS, ".", &opts)
+	require.Nil(t, err)
+
+	opts.Workers = 16
+
+	p2, err := NewPayloadFromFS(testFS, ".", &opts)
+	require.Nil(t, err)
+
+	assert.Equal(t, p1, p2)
+
+	d1, err := em.Marshal(p1)
+	require.Nil(t, err)
+	d2, err := em.Marshal(p2)
+	require.Nil(t, err)
+	assert.Equal(t, d1, d2)
+
+	f := (*(*(*(*p1.Directories)[0].Directories)[0].Directories)[0].Files)[0]
+	assert.Equal(t, "rrdetector", f.FsName)
+	require.Len(t, f.Hashes, 1)
+	assert.Equal(t, Sha512, f.Hashes[0].HashAlgID)
+}
+
+func TestNewPayloadFromFS_ko(t *testing.T) {
+	_, err := NewPayloadFromFS(testFS, "opt/road-runner", nil)
+	assert.EqualError(t, err, "open opt/road-runner: file does not exist")
+
+	_, err = NewPayloadFromFS(testFS, "opt", &PayloadOptions{Exclude: []string{"[-]"}})
+	assert.EqualError(t, err, `bad pattern "[-]": syntax error in pattern`)
+
+	_, err = NewPayloadFromFS(testFS, "opt", &PayloadOptions{HashAlgIDs: []uint64{Sha3_512}})
+	assert.EqualError(t, err, "hashing opt/acme/bin/rrdetector: no implementation available for hash algorithm sha3-512")
+}
@@ -0,0 +1,396 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+// VerifyOptions controls how VerifyPayload maps the files declared in a tag
+// onto the verified file system
+type VerifyOptions struct {
+	// Maps the values of FileSystemItem.Root found in the tag to directories
+	// in the verified file system. If nil, the "/" root is mapped to ".".
+	Roots map[string]string
+
+	// The directory, in the verified file system, against which items with
+	// no root are resolved, i.e., the location of the tag. If empty, "." is
+	// used.
+	Base string
+
+	// The conventions of the platform on which the tag was produced. If set,
+	// variables in roots and locations are expanded and separators are
+	// normalised. Roots not found in Roots are then expanded into absolute
+	// paths, which are mapped onto fsys as if it were the root of the volume.
+	// If the profile is case insensitive, file names that do not exactly
+	// match are looked up ignoring case.
+	Profile *PathProfile
+}
+
+// VerifiedFile describes the outcome of the verification of a declared file
+type VerifiedFile struct {
+	// The declared file
+	File *File
+
+	// The full path of the file as declared in the tag, including its root
+	Path string
+
+	// The path of the file in the verified file system. Empty if the declared
+	// path could not be mapped to the file system.
+	FSPath string
+
+	// Whether the file is a key file, i.e., the file, or one of its parent
+	// directories, has the key flag set. A missing or modified key file
+	// indicates that the software component is not installed, or has been
+	// tampered with.
+	Critical bool
+
+	// The number of hashes that were checked. A file whose hashes all use
+	// algorithms with no available implementation is reported as unverified.
+	HashesChecked int
+
+	// If the file is missing or modified, a description of the reason.
+	Reason string
+
+	// The file as found in the file system, with its resolved root and
+	// location, observed size, and the hashes that were checked. Nil if the
+	// file is missing.
+	Observed *File
+}
+
+// PayloadVerification is the report produced by VerifyPayload
+type PayloadVerification struct {
+	// Declared files found with matching size and hashes
+	Verified []VerifiedFile
+
+	// Declared files not found in the file system
+	Missing []VerifiedFile
+
+	// Declared files found with a different size or hash
+	Modified []VerifiedFile
+
+	// Declared files found with matching size, whose hashes could not be
+	// checked since none uses an algorithm with an available implementation
+	Unverified []VerifiedFile
+
+	// Files found in declared directories that are not declared in the tag.
+	// Paths are relative to the verified file system.
+	Unexpected []string
+}
+
+// OK returns true if all the declared files were found unmodified, and no
+// unexpected files were found
+func (v PayloadVerification) OK() bool {
+	return len(v.Missing) == 0 && len(v.Modified) == 0 && len(v.Unverified) == 0 &&
+		len(v.Unexpected) == 0
+}
+
+// CriticalFailures returns the missing and modified key files
+func (v PayloadVerification) CriticalFailures() []VerifiedFile {
+	var failures []VerifiedFile
+
+	for _, l := range [][]VerifiedFile{v.Missing, v.Modified} {
+		for _, vf := range l {
+			if vf.Critical {
+				failures = append(failures, vf)
+			}
+		}
+	}
+
+	return failures
+}
+
+// VerifyPayload checks the files declared in the payload of the supplied tag
+// against the file system fsys. Each declared file is resolved through its
+// enclosing directories, and checked for existence, size and hashes. Hashes
+// using algorithms with no registered implementation are ignored, and files
+// with no other hash are reported as unverified. Undeclared files found in
+// declared directories are reported as unexpected.
+func VerifyPayload(tag *SoftwareIdentity, fsys fs.FS, opts *VerifyOptions) (*PayloadVerification, error) {
+	if tag == nil || tag.Payload == nil {
+		return nil, errors.New("no payload to verify")
+	}
+
+	v := newPayloadVerifier(fsys, opts)
+
+	if err := tag.Payload.Walk(v.visit); err != nil {
+		return nil, err
+	}
+
+	if err := v.findUnexpected(); err != nil {
+		return nil, err
+	}
+
+	return &v.report, nil
+}
+
+func newPayloadVerifier(fsys fs.FS, opts *VerifyOptions) *payloadVerifier {
+	v := payloadVerifier{
+		fsys:     fsys,
+		roots:    map[string]string{"/": "."},
+		base:     ".",
+		declared: map[string]bool{},
+	}
+
+	if opts != nil {
+		if opts.Roots != nil {
+			v.roots = opts.Roots
+		}
+		if opts.Base != "" {
+			v.base = opts.Base
+		}
+		v.profile = opts.Profile
+	}
+
+	return &v
+}
+
+type payloadVerifier struct {
+	fsys    fs.FS
+	roots   map[string]string
+	base    string
+	profile *PathProfile
+
+	// if set, only key files are verified
+	keyOnly bool
+
+	// FS paths of declared directories and files
+	dirs     []string
+	declared map[string]bool
+
+	report PayloadVerification
+}
+
+func (v *payloadVerifier) fsPath(r ResolvedItem) (string, error) {
+	if v.profile != nil {
+		return v.profileFSPath(r)
+	}
+
+	base := v.base
+
+	if r.Root != "" {
+		b, ok := v.roots[r.Root]
+		if !ok {
+			return "", fmt.Errorf("unknown root %q", r.Root)
+		}
+		base = b
+	}
+
+	p := path.Join(base, r.Path)
+	if !fs.ValidPath(p) {
+		return "", fmt.Errorf("path %q is outside the file system", p)
+	}
+
+	return p, nil
+}
+
+func (v *payloadVerifier) profileFSPath(r ResolvedItem) (string, error) {
+	rel, err := v.profile.Expand(r.Path)
+	if err != nil {
+		return "", err
+	}
+
+	var p string
+
+	switch b, ok := v.roots[r.Root]; {
+	case v.profile.IsAbs(rel):
+		p, err = v.profile.fsPath(rel)
+	case r.Root == "":
+		p = path.Join(v.base, rel)
+	case ok:
+		p = path.Join(b, rel)
+	default:
+		p, err = v.profile.LocalPath(r)
+		if err == nil {
+			if !v.profile.IsAbs(p) {
+				return "", fmt.Errorf("root %q does not expand to an absolute path", r.Root)
+			}
+			p, err = v.profile.fsPath(p)
+		}
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if !fs.ValidPath(p) {
+		return "", fmt.Errorf("path %q is outside the file system", p)
+	}
+
+	if v.profile.CaseInsensitive {
+		p = resolveFold(v.fsys, p)
+	}
+
+	return p, nil
+}
+
+func (v *payloadVerifier) visit(r ResolvedItem) error {
+	fsPath, err := v.fsPath(r)
+
+	if r.IsDir() {
+		if err == nil {
+			v.dirs = append(v.dirs, fsPath)
+			v.declared[fsPath] = true
+		}
+		return nil
+	}
+
+	if v.keyOnly && !r.Key {
+		return nil
+	}
+
+	vf := VerifiedFile{
+		File:     r.File,
+		Path:     r.FullPath(),
+		FSPath:   fsPath,
+		Critical: r.Key,
+	}
+
+	if err != nil {
+		vf.Reason = err.Error()
+		v.report.Missing = append(v.report.Missing, vf)
+		return nil
+	}
+
+	v.declared[fsPath] = true
+
+	return v.verifyFile(r, vf)
+}
+
+func (v *payloadVerifier) verifyFile(r ResolvedItem, vf VerifiedFile) error {
+	info, err := fs.Stat(v.fsys, vf.FSPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			vf.Reason = "not found"
+			v.report.Missing = append(v.report.Missing, vf)
+			return nil
+		}
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		vf.Reason = "not a regular file"
+		v.report.Missing = append(v.report.Missing, vf)
+		return nil
+	}
+
+	size := info.Size()
+
+	vf.Observed = &File{
+		FileSystemItem: FileSystemItem{
+			Root:     r.Root,
+			Location: path.Dir(r.Path),
+			FsName:   path.Base(r.Path),
+		},
+		Size: &size,
+	}
+
+	if vf.Observed.Location == "." {
+		vf.Observed.Location = ""
+	}
+
+	if vf.File.Size != nil && *vf.File.Size != info.Size() {
+		vf.Reason = fmt.Sprintf("size mismatch: want %d, got %d", *vf.File.Size, info.Size())
+		v.report.Modified = append(v.report.Modified, vf)
+		return nil
+	}
+
+	all := vf.File.AllHashes()
+	want := verifiableHashes(all)
+
+	if len(want) == 0 {
+		if len(all) != 0 {
+			vf.Reason = "no hash algorithm with an available implementation"
+			v.report.Unverified = append(v.report.Unverified, vf)
+			return nil
+		}
+		v.report.Verified = append(v.report.Verified, vf)
+		return nil
+	}
+
+	got, err := v.hash(vf.FSPath, want)
+	if err != nil {
+		return err
+	}
+
+	vf.HashesChecked = len(want)
+
+	for _, h := range got {
+		if err := vf.Observed.AddHash(h); err != nil {
+			return err
+		}
+	}
+
+	for i := range want {
+		if !bytes.Equal(want[i].HashValue, got[i].HashValue) {
+			vf.Reason = fmt.Sprintf("%s hash mismatch", want[i].AlgIDToString())
+			v.report.Modified = append(v.report.Modified, vf)
+			return nil
+		}
+	}
+
+	v.report.Verified = append(v.report.Verified, vf)
+
+	return nil
+}
+
+func (v *payloadVerifier) hash(name string, want HashEntries) (HashEntries, error) {
+	algIDs := make([]uint64, len(want))
+	for i, h := range want {
+		algIDs[i] = h.HashAlgID
+	}
+
+	f, err := v.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return computeHashEntries(algIDs, f)
+}
+
+// verifiableHashes returns the hashes whose algorithms have an implementation
+func verifiableHashes(hashes HashEntries) HashEntries {
+	var ret HashEntries
+
+	for _, h := range hashes {
+		if a, ok := LookupHashAlgorithm(h.HashAlgID); ok && a.New != nil {
+			ret = append(ret, h)
+		}
+	}
+
+	return ret
+}
+
+func (v *payloadVerifier) findUnexpected() error {
+	seen := map[string]bool{}
+
+	for _, d := range v.dirs {
+		if seen[d] {
+			continue
+		}
+		seen[d] = true
+
+		entries, err := fs.ReadDir(v.fsys, d)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+
+		for _, e := range entries {
+			p := path.Join(d, e.Name())
+			if e.Type().IsRegular() && !v.declared[p] {
+				v.report.Unexpected = append(v.report.Unexpected, p)
+			}
+		}
+	}
+
+	return nil
+}
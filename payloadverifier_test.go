@@ -0,0 +1,147 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTagFromFS(t *testing.T, fsys fstest.MapFS, dir string, opts *PayloadOptions) *SoftwareIdentity {
+	tag, err := NewTag("com.acme.rrd2013-ce-sp1-v4-1-5-0", "ACME Roadrunner Detector", "4.1.5")
+	require.Nil(t, err)
+
+	tag.Payload, err = NewPayloadFromFS(fsys, dir, opts)
+	require.Nil(t, err)
+
+	return tag
+}
+
+func cloneMapFS(fsys fstest.MapFS) fstest.MapFS {
+	c := fstest.MapFS{}
+	for k, v := range fsys {
+		f := *v
+		c[k] = &f
+	}
+	return c
+}
+
+func TestVerifyPayload_ok(t *testing.T) {
+	tag := testTagFromFS(t, testFS, "opt/acme", &PayloadOptions{Root: "/opt/acme"})
+
+	v, err := VerifyPayload(tag, testFS, &VerifyOptions{
+		Roots: map[string]string{"/opt/acme": "opt/acme"},
+	})
+	require.Nil(t, err)
+
+	assert.True(t, v.OK())
+	assert.Len(t, v.Verified, 7)
+	assert.Equal(t, "/opt/acme/bin/rrdetector", v.Verified[0].Path)
+	assert.Equal(t, "opt/acme/bin/rrdetector", v.Verified[0].FSPath)
+	assert.Equal(t, 1, v.Verified[0].HashesChecked)
+}
+
+func TestVerifyPayload_ko(t *testing.T) {
+	tag := testTagFromFS(t, testFS, ".", &PayloadOptions{
+		Root: "/",
+		Key:  []string{"opt/acme/bin/*"},
+	})
+
+	etc := &(*(*(*tag.Payload.Directories)[0].Directories)[0].Directories)[1]
+	require.Equal(t, "etc", etc.FsName)
+	etc.Key = &key
+
+	fsys := cloneMapFS(testFS)
+	delete(fsys, "opt/acme/bin/rrdetector")
+	delete(fsys, "opt/acme/share/doc/README")
+	fsys["opt/acme/lib/librr.so"].Data = []byte("coyote library")
+	fsys["opt/acme/etc/rrdetector.conf"].Data = []byte("sensitivity=low!")
+	fsys["opt/acme/lib/libcoyote.so"] = &fstest.MapFile{Data: []byte("coyote")}
+
+	v, err := VerifyPayload(tag, fsys, nil)
+	require.Nil(t, err)
+
+	assert.False(t, v.OK())
+
+	require.Len(t, v.Missing, 2)
+	assert.Equal(t, "/opt/acme/bin/rrdetector", v.Missing[0].Path)
+	assert.Equal(t, "not found", v.Missing[0].Reason)
+	assert.True(t, v.Missing[0].Critical)
+	assert.Equal(t, "/opt/acme/share/doc/README", v.Missing[1].Path)
+	assert.False(t, v.Missing[1].Critical)
+
+	require.Len(t, v.Modified, 2)
+	// key flag is inherited from the etc directory
+	assert.Equal(t, "/opt/acme/etc/rrdetector.conf", v.Modified[0].Path)
+	assert.Equal(t, "sha-256 hash mismatch", v.Modified[0].Reason)
+	assert.True(t, v.Modified[0].Critical)
+	assert.Equal(t, "/opt/acme/lib/librr.so", v.Modified[1].Path)
+	assert.Equal(t, "size mismatch: want 18, got 14", v.Modified[1].Reason)
+
+	assert.Equal(t, []string{"opt/acme/lib/libcoyote.so"}, v.Unexpected)
+
+	critical := v.CriticalFailures()
+	require.Len(t, critical, 2)
+	assert.Equal(t, "/opt/acme/bin/rrdetector", critical[0].Path)
+	assert.Equal(t, "/opt/acme/etc/rrdetector.conf", critical[1].Path)
+}
+
+func TestVerifyPayload_unresolved(t *testing.T) {
+	tag := testTagFromFS(t, testFS, "opt/acme/bin", &PayloadOptions{Root: "%programdata%"})
+	(*tag.Payload.Files)[0].Location = "../../../.."
+
+	v, err := VerifyPayload(tag, testFS, nil)
+	require.Nil(t, err)
+
+	require.Len(t, v.Missing, 1)
+	assert.Equal(t, `unknown root "%programdata%"`, v.Missing[0].Reason)
+	assert.Equal(t, "", v.Missing[0].FSPath)
+
+	v, err = VerifyPayload(tag, testFS, &VerifyOptions{
+		Roots: map[string]string{"%programdata%": "opt/acme/bin"},
+	})
+	require.Nil(t, err)
+
+	require.Len(t, v.Missing, 1)
+	assert.Equal(t, `path "../rrdetector" is outside the file system`, v.Missing[0].Reason)
+}
+
+func TestVerifyPayload_relative(t *testing.T) {
+	// no root: items are relative to the tag location
+	tag := testTagFromFS(t, testFS, "opt/acme/share", nil)
+
+	v, err := VerifyPayload(tag, testFS, &VerifyOptions{Base: "opt/acme/share"})
+	require.Nil(t, err)
+	assert.True(t, v.OK())
+	assert.Equal(t, "doc/LICENSE.md", v.Verified[0].Path)
+
+	_, err = VerifyPayload(&SoftwareIdentity{}, testFS, nil)
+	assert.EqualError(t, err, "no payload to verify")
+}
+
+func TestVerifyPayload_unverified(t *testing.T) {
+	tag := testTagFromFS(t, testFS, "opt/acme/share", nil)
+
+	// the hashes of LICENSE.md cannot be computed
+	f := &(*(*tag.Payload.Directories)[0].Files)[0]
+	require.Equal(t, "LICENSE.md", f.FsName)
+	f.Hash = &HashEntry{HashAlgID: Sha3_256, HashValue: make([]byte, 32)}
+
+	v, err := VerifyPayload(tag, testFS, &VerifyOptions{Base: "opt/acme/share"})
+	require.Nil(t, err)
+
+	assert.False(t, v.OK())
+	require.Len(t, v.Unverified, 1)
+	assert.Equal(t, "doc/LICENSE.md", v.Unverified[0].Path)
+	assert.Equal(t, "no hash algorithm with an available implementation", v.Unverified[0].Reason)
+	assert.Equal(t, 0, v.Unverified[0].HashesChecked)
+	assert.NotNil(t, v.Unverified[0].Observed)
+
+	for _, vf := range v.Verified {
+		assert.NotEqual(t, "doc/LICENSE.md", vf.Path)
+	}
+}
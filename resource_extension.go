@@ -3,6 +3,19 @@
 
 package swid
 
-// ResourceExtension is a placeholder for $$resource-extension
+// ResourceExtension models $$resource-extension
 type ResourceExtension struct {
+	// The index of the PCR extended with the measurement described by the
+	// resource (e.g., a TCG event log entry). In CoSWID it uses private index
+	// -1.
+	PCR *uint32 `cbor:"-1,keyasint,omitempty" json:"pcr,omitempty" xml:"pcr,attr,omitempty"`
+
+	// The type of the TCG event that recorded the measurement. In CoSWID it
+	// uses private index -2.
+	EventType *uint32 `cbor:"-2,keyasint,omitempty" json:"event-type,omitempty" xml:"eventType,attr,omitempty"`
+
+	// The measured digests, one per hash algorithm. In SWID XML they are
+	// serialized as a space separated list. In CoSWID they use private index
+	// -3.
+	Digests HashEntries `cbor:"-3,keyasint,omitempty" json:"digests,omitempty" xml:"digests,attr,omitempty"`
 }
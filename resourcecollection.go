@@ -3,6 +3,8 @@
 
 package swid
 
+import "fmt"
+
 // ResourceCollection models a resource-collection
 type ResourceCollection struct {
 	ResourceCollectionExtension
@@ -23,3 +25,14 @@ type ResourceCollection struct {
 	// further defined through extension in the future.
 	Resources *Resources `cbor:"19,keyasint,omitempty" json:"resource,omitempty" xml:"Resource,omitempty"`
 }
+
+func (rc *ResourceCollection) inferHashAlgIDs(a *algInferrer) {
+	rc.PathElements.inferHashAlgIDs(a)
+
+	if rc.Resources != nil {
+		for i := range *rc.Resources {
+			r := &(*rc.Resources)[i]
+			a.inferAll(fmt.Sprintf("resource %d", i), r.Digests)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNoContent is returned when reading a file from a ResourceFS: tags only
+// describe files, they do not carry their content
+var ErrNoContent = errors.New("no content available: tags only carry file metadata")
+
+// ResourceFS is a read-only fs.FS view of the directories and files declared
+// in a resource collection. It implements fs.ReadDirFS and fs.StatFS, so that
+// fs.WalkDir, fs.Glob and similar tools can be used to browse a tag.
+//
+// Item paths are resolved as described by ResourceCollection.Walk. Absolute
+// paths are placed relative to the root of the view, whilst other roots (e.g.,
+// "%programdata%") become the first element of the path. Directories implied
+// by the roots and locations of the declared items are synthesised.
+//
+// The Sys method of the fs.FileInfo of a declared item returns its
+// ResolvedItem, which gives access to the declared metadata (e.g., key flag
+// and hashes). Synthesised directories return nil.
+type ResourceFS struct {
+	nodes map[string]*resourceNode
+}
+
+type resourceNode struct {
+	name     string
+	dir      bool
+	item     *ResolvedItem
+	children map[string]*resourceNode
+}
+
+// FS returns a ResourceFS view of the receiver resource collection. It fails
+// if the path of an item cannot be represented in a fs.FS (e.g., it starts
+// with ".."), or if two items clash.
+func (rc *ResourceCollection) FS() (*ResourceFS, error) {
+	rfs := ResourceFS{
+		nodes: map[string]*resourceNode{
+			".": {name: ".", dir: true, children: map[string]*resourceNode{}},
+		},
+	}
+
+	err := rc.Walk(func(r ResolvedItem) error {
+		return rfs.add(r)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &rfs, nil
+}
+
+func (rfs *ResourceFS) add(r ResolvedItem) error {
+	p := strings.TrimLeft(r.FullPath(), "/")
+	if p == "" || !fs.ValidPath(p) || p == "." {
+		return fmt.Errorf("path %q cannot be represented in the file system view", r.FullPath())
+	}
+
+	parent, err := rfs.mkdirAll(path.Dir(p))
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.FullPath(), err)
+	}
+
+	if n, ok := rfs.nodes[p]; ok {
+		// a directory can be declared more than once, e.g., under different
+		// locations that resolve to the same path
+		if !n.dir || !r.IsDir() {
+			return fmt.Errorf("%s: duplicate item", r.FullPath())
+		}
+		if n.item == nil {
+			n.item = &r
+		}
+		return nil
+	}
+
+	n := &resourceNode{name: path.Base(p), dir: r.IsDir(), item: &r}
+	if n.dir {
+		n.children = map[string]*resourceNode{}
+	}
+
+	rfs.nodes[p] = n
+	parent.children[n.name] = n
+
+	return nil
+}
+
+func (rfs *ResourceFS) mkdirAll(p string) (*resourceNode, error) {
+	if n, ok := rfs.nodes[p]; ok {
+		if !n.dir {
+			return nil, fmt.Errorf("%s is a file", p)
+		}
+		return n, nil
+	}
+
+	parent, err := rfs.mkdirAll(path.Dir(p))
+	if err != nil {
+		return nil, err
+	}
+
+	n := &resourceNode{
+		name:     path.Base(p),
+		dir:      true,
+		children: map[string]*resourceNode{},
+	}
+
+	rfs.nodes[p] = n
+	parent.children[n.name] = n
+
+	return n, nil
+}
+
+func (rfs *ResourceFS) lookup(op, name string) (*resourceNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	n, ok := rfs.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	return n, nil
+}
+
+// Open opens the named file or directory. Files carry no content: reading
+// from them returns ErrNoContent.
+func (rfs *ResourceFS) Open(name string) (fs.File, error) {
+	n, err := rfs.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.dir {
+		return &resourceDir{path: name, node: n}, nil
+	}
+
+	return &resourceFile{path: name, node: n}, nil
+}
+
+// Stat returns the fs.FileInfo of the named file or directory
+func (rfs *ResourceFS) Stat(name string) (fs.FileInfo, error) {
+	n, err := rfs.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// ReadDir returns the entries of the named directory sorted by name
+func (rfs *ResourceFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := rfs.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !n.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	return n.entries(), nil
+}
+
+func (n *resourceNode) entries() []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(n.children))
+	for _, c := range n.children {
+		entries = append(entries, c)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries
+}
+
+// resourceNode implements both fs.FileInfo and fs.DirEntry
+
+func (n *resourceNode) Name() string { return n.name }
+
+func (n *resourceNode) Size() int64 {
+	if n.item != nil && n.item.File != nil && n.item.File.Size != nil {
+		return *n.item.File.Size
+	}
+	return 0
+}
+
+func (n *resourceNode) Mode() fs.FileMode {
+	if n.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (n *resourceNode) ModTime() time.Time { return time.Time{} }
+
+func (n *resourceNode) IsDir() bool { return n.dir }
+
+func (n *resourceNode) Sys() interface{} {
+	if n.item == nil {
+		return nil
+	}
+	return *n.item
+}
+
+func (n *resourceNode) Type() fs.FileMode { return n.Mode().Type() }
+
+func (n *resourceNode) Info() (fs.FileInfo, error) { return n, nil }
+
+type resourceFile struct {
+	path string
+	node *resourceNode
+}
+
+func (f *resourceFile) Stat() (fs.FileInfo, error) { return f.node, nil }
+
+func (f *resourceFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.path, Err: ErrNoContent}
+}
+
+func (f *resourceFile) Close() error { return nil }
+
+type resourceDir struct {
+	path    string
+	node    *resourceNode
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *resourceDir) Stat() (fs.FileInfo, error) { return d.node, nil }
+
+func (d *resourceDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: errors.New("is a directory")}
+}
+
+func (d *resourceDir) Close() error { return nil }
+
+func (d *resourceDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		d.entries = d.node.entries()
+	}
+
+	rest := d.entries[d.offset:]
+
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+
+	if count > len(rest) {
+		count = len(rest)
+	}
+
+	d.offset += count
+
+	return rest[:count], nil
+}
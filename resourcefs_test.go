@@ -0,0 +1,183 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceFS_WalkDir(t *testing.T) {
+	tag := testTagFromFS(t, testFS, ".", &PayloadOptions{Root: "/"})
+
+	rfs, err := tag.Payload.FS()
+	require.Nil(t, err)
+
+	var declared []string
+
+	err = fs.WalkDir(rfs, ".", func(p string, d fs.DirEntry, err error) error {
+		require.Nil(t, err)
+		if !d.IsDir() {
+			declared = append(declared, p)
+		}
+		return nil
+	})
+	require.Nil(t, err)
+
+	var expected []string
+
+	err = fs.WalkDir(testFS, ".", func(p string, d fs.DirEntry, err error) error {
+		require.Nil(t, err)
+		if d.Type().IsRegular() {
+			expected = append(expected, p)
+		}
+		return nil
+	})
+	require.Nil(t, err)
+
+	assert.Equal(t, expected, declared)
+
+	matches, err := fs.Glob(rfs, "opt/acme/lib/*.so")
+	require.Nil(t, err)
+	assert.Equal(t, []string{"opt/acme/lib/librr.so"}, matches)
+
+	fi, err := fs.Stat(rfs, "opt/acme/bin/rrdetector")
+	require.Nil(t, err)
+	assert.Equal(t, "rrdetector", fi.Name())
+	assert.Equal(t, int64(len("roadrunner detector")), fi.Size())
+	assert.Equal(t, fs.FileMode(0444), fi.Mode())
+	assert.True(t, fi.ModTime().IsZero())
+
+	r, ok := fi.Sys().(ResolvedItem)
+	require.True(t, ok)
+	assert.Equal(t, testSha256(t, "roadrunner detector"), r.File.Hash)
+}
+
+func TestResourceFS_synthesised_dirs(t *testing.T) {
+	rfs, err := testWalkPayload().FS()
+	require.Nil(t, err)
+
+	entries, err := rfs.ReadDir(".")
+	require.Nil(t, err)
+
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"%programdata%", "%temp%", "README.txt"}, names)
+
+	// synthesised from the location of the rrdetector directory
+	fi, err := rfs.Stat("%programdata%/acme")
+	require.Nil(t, err)
+	assert.True(t, fi.IsDir())
+	assert.Equal(t, fs.ModeDir|0555, fi.Mode())
+	assert.Nil(t, fi.Sys())
+
+	fi, err = rfs.Stat("%programdata%/acme/rrdetector/plugins/coyote.dll")
+	require.Nil(t, err)
+	assert.True(t, fi.Sys().(ResolvedItem).Key)
+
+	_, err = rfs.Stat("%programdata%/acme/rrdetector/bin")
+	assert.Nil(t, err)
+
+	_, err = rfs.Stat("%temp%/missing")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	_, err = rfs.Open("/%temp%")
+	assert.True(t, errors.Is(err, fs.ErrInvalid))
+
+	_, err = rfs.ReadDir("README.txt")
+	assert.EqualError(t, err, "readdir README.txt: not a directory")
+}
+
+func TestResourceFS_Open(t *testing.T) {
+	rfs, err := testWalkPayload().FS()
+	require.Nil(t, err)
+
+	f, err := rfs.Open("README.txt")
+	require.Nil(t, err)
+
+	_, err = io.ReadAll(f)
+	assert.True(t, errors.Is(err, ErrNoContent))
+
+	fi, err := f.Stat()
+	require.Nil(t, err)
+	assert.Equal(t, int64(0), fi.Size())
+	assert.Nil(t, f.Close())
+
+	f, err = rfs.Open("%programdata%/acme/rrdetector")
+	require.Nil(t, err)
+
+	d, ok := f.(fs.ReadDirFile)
+	require.True(t, ok)
+
+	_, err = d.Read(nil)
+	assert.EqualError(t, err, "read %programdata%/acme/rrdetector: is a directory")
+
+	entries, err := d.ReadDir(1)
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "bin", entries[0].Name())
+	assert.Equal(t, fs.ModeDir, entries[0].Type())
+
+	entries, err = d.ReadDir(5)
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "plugins", entries[0].Name())
+
+	_, err = d.ReadDir(1)
+	assert.Equal(t, io.EOF, err)
+
+	entries, err = d.ReadDir(-1)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 0)
+
+	assert.Nil(t, d.Close())
+
+	entries, err = rfs.ReadDir(".")
+	require.Nil(t, err)
+
+	info, err := entries[2].Info()
+	require.Nil(t, err)
+	assert.Equal(t, "README.txt", info.Name())
+}
+
+func TestResourceFS_ko(t *testing.T) {
+	for _, tv := range []struct {
+		In          []File
+		ExpectedErr string
+	}{
+		{
+			In:          []File{{FileSystemItem: FileSystemItem{Location: "..", FsName: "setup.py"}}},
+			ExpectedErr: `path "../setup.py" cannot be represented in the file system view`,
+		},
+		{
+			In: []File{
+				{FileSystemItem: FileSystemItem{Root: "/", FsName: "setup.py"}},
+				{FileSystemItem: FileSystemItem{FsName: "setup.py"}},
+			},
+			ExpectedErr: "setup.py: duplicate item",
+		},
+		{
+			In: []File{
+				{FileSystemItem: FileSystemItem{FsName: "bin"}},
+				{FileSystemItem: FileSystemItem{Location: "bin", FsName: "rrdetector"}},
+			},
+			ExpectedErr: "bin/rrdetector: bin is a file",
+		},
+	} {
+		p := NewPayload()
+		for _, f := range tv.In {
+			require.Nil(t, p.AddFile(f))
+		}
+
+		_, err := p.FS()
+		assert.EqualError(t, err, tv.ExpectedErr)
+	}
+}
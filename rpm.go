@@ -0,0 +1,546 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// RPMMediaType is the media type of RPM packages
+const RPMMediaType = "application/x-rpm"
+
+// RPMOptions controls how NewCorpusTagFromRPM reads an RPM package
+type RPMOptions struct {
+	// The TagCreator is recorded as tag creator. HashAlgIDs are used to hash
+	// the package itself: if none is supplied, SHA-256 is used. Shipped
+	// files are described using the digests recorded in the header.
+	ImportOptions
+
+	// The distributor of the package if the header has no Vendor tag. If
+	// empty, the packager is used instead.
+	Vendor string
+
+	// The package URL namespace, e.g., "fedora" or "opensuse". If empty,
+	// the package URLs have no namespace.
+	Namespace string
+
+	// The name of the package file, recorded as artifact of the
+	// installation media link. If empty, the canonical file name
+	// <name>-<version>-<release>.<arch>.rpm is used.
+	Artifact string
+
+	// The URI of the package file, recorded as href of the installation
+	// media link. If empty, the artifact is used.
+	Href string
+}
+
+// NewCorpusTagFromRPM reads an RPM package from r and returns a corpus tag
+// describing it. Only the package headers are decoded: the payload archive is
+// read to compute the hashes of the package, but not decompressed. The tag
+// has:
+//
+//   - a package URL as tag ID, e.g.,
+//     pkg:rpm/fedora/curl@7.76.1-2.fc34?arch=x86_64&epoch=1;
+//   - the version, prefixed with the epoch if any (e.g., "1:7.76.1"), as
+//     software version, and the release as revision in the software meta,
+//     along with the summary, the description and the source package name;
+//   - the vendor (tag creator unless one is supplied) and the packager as
+//     distributor and maintainer entities. If there is no vendor, the
+//     packager is also the distributor;
+//   - a "requires" link for each required (required use, optional if the
+//     requirement is weak) and recommended (recommended use) package,
+//     referencing its package URL with no version. Requirements on files,
+//     shared libraries and other capabilities, which cannot be resolved to a
+//     package without a repository, are not recorded;
+//   - a payload listing the regular files, with their size and the digest
+//     recorded in the header, if computed with a registered algorithm
+//     (see RegisterHashAlgorithm for MD5 and SHA-1);
+//   - an "installation-media" link to the package file, carrying the hashes
+//     of the package in the Hashes extension.
+func NewCorpusTagFromRPM(r io.Reader, opts *RPMOptions) (*SoftwareIdentity, error) {
+	var o RPMOptions
+
+	if opts != nil {
+		o = *opts
+	}
+
+	if len(o.HashAlgIDs) == 0 {
+		o.HashAlgIDs = []uint64{Sha256}
+	}
+
+	mh, err := newMultiHasher(o.HashAlgIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	tr := io.TeeReader(r, mh)
+
+	h, err := readRPMHeaders(tr)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := o.newRPMPackage(h)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := p.newTag(o.TagCreator)
+	if err != nil {
+		return nil, err
+	}
+
+	tag.Corpus = true
+
+	entries, err := rpmFiles(h)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setPayload(tag, entries); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(io.Discard, tr); err != nil {
+		return nil, err
+	}
+
+	hashes, err := mh.Sum()
+	if err != nil {
+		return nil, err
+	}
+
+	artifact := o.Artifact
+	if artifact == "" {
+		artifact = fmt.Sprintf("%s-%s-%s.%s.rpm",
+			h.str(rpmTagName), h.str(rpmTagVersion), h.str(rpmTagRelease), h.str(rpmTagArch))
+	}
+
+	href := o.Href
+	if href == "" {
+		href = artifact
+	}
+
+	l, err := NewLink(href, *NewRel(RelInstallationMedia))
+	if err != nil {
+		return nil, err
+	}
+
+	l.Artifact = artifact
+	l.MediaType = RPMMediaType
+	l.Hashes = hashes
+
+	if err := tag.AddLink(*l); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// RPM header tags
+const (
+	rpmTagName           = 1000
+	rpmTagVersion        = 1001
+	rpmTagRelease        = 1002
+	rpmTagEpoch          = 1003
+	rpmTagSummary        = 1004
+	rpmTagDescription    = 1005
+	rpmTagVendor         = 1011
+	rpmTagPackager       = 1015
+	rpmTagURL            = 1020
+	rpmTagArch           = 1022
+	rpmTagOldFileNames   = 1027
+	rpmTagFileSizes      = 1028
+	rpmTagFileModes      = 1030
+	rpmTagFileDigests    = 1035
+	rpmTagFileFlags      = 1037
+	rpmTagSourceRPM      = 1044
+	rpmTagRequireFlags   = 1048
+	rpmTagRequireName    = 1049
+	rpmTagDirIndexes     = 1116
+	rpmTagBaseNames      = 1117
+	rpmTagDirNames       = 1118
+	rpmTagLongFileSizes  = 5008
+	rpmTagFileDigestAlgo = 5011
+	rpmTagRecommendName  = 5046
+)
+
+// RPM header data types
+const (
+	rpmTypeChar        = 1
+	rpmTypeInt8        = 2
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeInt64       = 5
+	rpmTypeString      = 6
+	rpmTypeBin         = 7
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+const (
+	rpmSenseMissingOK = 1 << 19
+	rpmFileGhost      = 1 << 6
+	rpmFileTypeMask   = 0170000
+	rpmFileRegular    = 0100000
+)
+
+// the names of the OpenPGP hash algorithms used for file digests (RFC 4880,
+// Section 9.4)
+var rpmDigestAlgs = map[int64]string{
+	1:  "md5",
+	2:  "sha1",
+	8:  "sha-256",
+	9:  "sha-384",
+	10: "sha-512",
+}
+
+const (
+	rpmLeadSize        = 96
+	rpmMaxHeaderIndex  = 0xffff
+	rpmMaxHeaderData   = 256 << 20
+	rpmHeaderEntrySize = 16
+)
+
+var (
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+// rpmHeader holds the decoded entries of an RPM header: strings and string
+// arrays as []string, integers as []int64 and binary data as []byte
+type rpmHeader map[int32]interface{}
+
+// str returns the first string of the entry, if any
+func (h rpmHeader) str(tag int32) string {
+	if v, ok := h[tag].([]string); ok && len(v) != 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (h rpmHeader) strs(tag int32) []string {
+	v, _ := h[tag].([]string)
+	return v
+}
+
+func (h rpmHeader) ints(tag int32) []int64 {
+	v, _ := h[tag].([]int64)
+	return v
+}
+
+// readRPMHeaders reads the lead, the signature header and the main header of
+// an RPM package, and returns the main header
+func readRPMHeaders(r io.Reader) (rpmHeader, error) {
+	lead := make([]byte, rpmLeadSize)
+
+	if _, err := io.ReadFull(r, lead); err != nil || !bytes.HasPrefix(lead, rpmLeadMagic) {
+		return nil, errors.New("not an RPM package: bad lead")
+	}
+
+	n, _, err := readRPMHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("signature header: %w", err)
+	}
+
+	// the signature header is padded to a multiple of 8 bytes
+	if pad := (8 - n%8) % 8; pad != 0 {
+		if _, err := io.CopyN(io.Discard, r, int64(pad)); err != nil {
+			return nil, fmt.Errorf("signature header: %w", unexpectedEOF(err))
+		}
+	}
+
+	_, h, err := readRPMHeader(r)
+	if err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+
+	return h, nil
+}
+
+// readRPMHeader reads a header structure and returns its size and entries
+func readRPMHeader(r io.Reader) (int, rpmHeader, error) {
+	intro := make([]byte, 16)
+
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+
+	if !bytes.HasPrefix(intro, rpmHeaderMagic) {
+		return 0, nil, errors.New("bad magic")
+	}
+
+	nindex := binary.BigEndian.Uint32(intro[8:])
+	hsize := binary.BigEndian.Uint32(intro[12:])
+
+	if nindex > rpmMaxHeaderIndex || hsize > rpmMaxHeaderData {
+		return 0, nil, fmt.Errorf("header too large: %d entries, %d bytes", nindex, hsize)
+	}
+
+	index := make([]byte, int(nindex)*rpmHeaderEntrySize)
+	store := make([]byte, hsize)
+
+	if _, err := io.ReadFull(r, index); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+
+	if _, err := io.ReadFull(r, store); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+
+	h := rpmHeader{}
+
+	for i := 0; i < len(index); i += rpmHeaderEntrySize {
+		tag := int32(binary.BigEndian.Uint32(index[i:]))
+		typ := binary.BigEndian.Uint32(index[i+4:])
+		offset := binary.BigEndian.Uint32(index[i+8:])
+		count := binary.BigEndian.Uint32(index[i+12:])
+
+		v, err := decodeRPMEntry(typ, store, offset, count)
+		if err != nil {
+			return 0, nil, fmt.Errorf("tag %d: %w", tag, err)
+		}
+
+		if v != nil {
+			h[tag] = v
+		}
+	}
+
+	return len(intro) + len(index) + len(store), h, nil
+}
+
+func decodeRPMEntry(typ uint32, store []byte, offset, count uint32) (interface{}, error) {
+	if int64(offset) >= int64(len(store)) {
+		return nil, fmt.Errorf("offset %d out of bounds", offset)
+	}
+
+	data := store[offset:]
+
+	switch typ {
+	case rpmTypeString, rpmTypeI18NString, rpmTypeStringArray:
+		if typ == rpmTypeString {
+			count = 1
+		}
+
+		// the count cannot exceed the number of terminators
+		if int64(count) > int64(len(data)) {
+			return nil, fmt.Errorf("count %d out of bounds", count)
+		}
+
+		ss := make([]string, 0, count)
+
+		for i := uint32(0); i < count; i++ {
+			end := bytes.IndexByte(data, 0)
+			if end < 0 {
+				return nil, errors.New("unterminated string")
+			}
+			ss = append(ss, string(data[:end]))
+			data = data[end+1:]
+		}
+
+		return ss, nil
+	case rpmTypeChar, rpmTypeInt8, rpmTypeInt16, rpmTypeInt32, rpmTypeInt64:
+		size := map[uint32]int64{
+			rpmTypeChar: 1, rpmTypeInt8: 1, rpmTypeInt16: 2, rpmTypeInt32: 4, rpmTypeInt64: 8,
+		}[typ]
+
+		if int64(count)*size > int64(len(data)) {
+			return nil, fmt.Errorf("count %d out of bounds", count)
+		}
+
+		vs := make([]int64, count)
+
+		for i := range vs {
+			b := data[int64(i)*size:]
+			switch size {
+			case 1:
+				vs[i] = int64(b[0])
+			case 2:
+				vs[i] = int64(binary.BigEndian.Uint16(b))
+			case 4:
+				vs[i] = int64(binary.BigEndian.Uint32(b))
+			case 8:
+				vs[i] = int64(binary.BigEndian.Uint64(b))
+			}
+		}
+
+		return vs, nil
+	case rpmTypeBin:
+		if int64(count) > int64(len(data)) {
+			return nil, fmt.Errorf("count %d out of bounds", count)
+		}
+
+		return data[:count], nil
+	default:
+		// unknown types are ignored
+		return nil, nil
+	}
+}
+
+func (o RPMOptions) newRPMPackage(h rpmHeader) (*installedPackage, error) {
+	name, version, release := h.str(rpmTagName), h.str(rpmTagVersion), h.str(rpmTagRelease)
+
+	if name == "" || version == "" {
+		return nil, errors.New("missing name or version")
+	}
+
+	purl := packageURL{
+		Type:       "rpm",
+		Namespace:  o.Namespace,
+		Name:       name,
+		Version:    version,
+		Qualifiers: map[string]string{"arch": h.str(rpmTagArch)},
+	}
+
+	if release != "" {
+		purl.Version += "-" + release
+	}
+
+	softwareVersion := version
+
+	if epoch := h.ints(rpmTagEpoch); len(epoch) != 0 {
+		e := strconv.FormatInt(epoch[0], 10)
+		purl.Qualifiers["epoch"] = e
+		softwareVersion = e + ":" + version
+	}
+
+	p := installedPackage{
+		purl:        purl,
+		name:        name,
+		version:     softwareVersion,
+		summary:     h.str(rpmTagSummary),
+		description: h.str(rpmTagDescription),
+		product:     rpmSourceName(h.str(rpmTagSourceRPM)),
+		revision:    release,
+		distributor: h.str(rpmTagVendor),
+		maintainer:  entityName(h.str(rpmTagPackager)),
+		homepage:    h.str(rpmTagURL),
+	}
+
+	// packages built outside a distribution often have no Vendor tag
+	if p.distributor == "" {
+		p.distributor = o.Vendor
+	}
+
+	if p.distributor == "" {
+		p.distributor = p.maintainer
+	}
+
+	flags := h.ints(rpmTagRequireFlags)
+
+	for i, req := range h.strs(rpmTagRequireName) {
+		use := UseRequired
+		if i < len(flags) && flags[i]&rpmSenseMissingOK != 0 {
+			use = UseOptional
+		}
+
+		if d, ok := rpmDependency(purl, req, use); ok {
+			p.deps = append(p.deps, d)
+		}
+	}
+
+	for _, rec := range h.strs(rpmTagRecommendName) {
+		if d, ok := rpmDependency(purl, rec, UseRecommended); ok {
+			p.deps = append(p.deps, d)
+		}
+	}
+
+	return &p, nil
+}
+
+// rpmDependency returns a reference to the package with the supplied name,
+// unless it names a capability rather than a package, e.g., "/bin/sh",
+// "libc.so.6()(64bit)" or "rpmlib(PayloadIsZstd)"
+func rpmDependency(from packageURL, name string, use int64) (dependency, bool) {
+	if name == "" || strings.ContainsAny(name, "/()") {
+		return dependency{}, false
+	}
+
+	ref := from.versionless()
+	ref.Name = name
+
+	return dependency{href: ref.String(), use: use}, true
+}
+
+// rpmSourceName returns the name of the source package, given its file name,
+// e.g., "curl" for "curl-7.76.1-2.fc34.src.rpm"
+func rpmSourceName(srpm string) string {
+	s := strings.TrimSuffix(srpm, ".src.rpm")
+
+	for i := 0; i < 2; i++ {
+		j := strings.LastIndexByte(s, '-')
+		if j <= 0 {
+			return ""
+		}
+		s = s[:j]
+	}
+
+	return s
+}
+
+// rpmFiles returns the regular files listed in the header. Ghost files, which
+// are not shipped, are skipped.
+func rpmFiles(h rpmHeader) ([]PathEntry, error) {
+	paths := h.strs(rpmTagOldFileNames)
+
+	if paths == nil {
+		dirs, idx := h.strs(rpmTagDirNames), h.ints(rpmTagDirIndexes)
+
+		for i, base := range h.strs(rpmTagBaseNames) {
+			if i >= len(idx) || idx[i] < 0 || idx[i] >= int64(len(dirs)) {
+				return nil, fmt.Errorf("%s: bad directory index", base)
+			}
+			paths = append(paths, dirs[idx[i]]+base)
+		}
+	}
+
+	sizes := h.ints(rpmTagLongFileSizes)
+	if sizes == nil {
+		sizes = h.ints(rpmTagFileSizes)
+	}
+
+	modes, flags, digests := h.ints(rpmTagFileModes), h.ints(rpmTagFileFlags), h.strs(rpmTagFileDigests)
+
+	// MD5 is the default digest algorithm
+	alg := rpmDigestAlgs[1]
+	if a := h.ints(rpmTagFileDigestAlgo); len(a) != 0 {
+		alg = rpmDigestAlgs[a[0]]
+	}
+
+	var entries []PathEntry
+
+	for i, p := range paths {
+		if i >= len(modes) || modes[i]&rpmFileTypeMask != rpmFileRegular {
+			continue
+		}
+
+		if i < len(flags) && flags[i]&rpmFileGhost != 0 {
+			continue
+		}
+
+		var f File
+
+		if i < len(sizes) {
+			size := sizes[i]
+			f.Size = &size
+		}
+
+		if i < len(digests) && alg != "" {
+			if d, ok := registeredDigest(alg, digests[i]); ok {
+				f.Hash = &d
+			}
+		}
+
+		entries = append(entries, PathEntry{Path: path.Clean(p), File: f})
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,316 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testRPMEntry struct {
+	tag   int32
+	typ   uint32
+	value interface{}
+}
+
+// testRPMHeader encodes a header structure holding the supplied entries, with
+// values of type string, []string, []uint16, []int32 or []int64
+func testRPMHeader(t *testing.T, entries ...testRPMEntry) []byte {
+	var index, store bytes.Buffer
+
+	for _, e := range entries {
+		align := map[uint32]int{rpmTypeInt16: 2, rpmTypeInt32: 4, rpmTypeInt64: 8}[e.typ]
+		for align != 0 && store.Len()%align != 0 {
+			store.WriteByte(0)
+		}
+
+		offset := store.Len()
+
+		var count int
+
+		switch v := e.value.(type) {
+		case string:
+			store.WriteString(v + "\x00")
+			count = 1
+		case []string:
+			for _, s := range v {
+				store.WriteString(s + "\x00")
+			}
+			count = len(v)
+		case []uint16:
+			require.Nil(t, binary.Write(&store, binary.BigEndian, v))
+			count = len(v)
+		case []int32:
+			require.Nil(t, binary.Write(&store, binary.BigEndian, v))
+			count = len(v)
+		case []int64:
+			require.Nil(t, binary.Write(&store, binary.BigEndian, v))
+			count = len(v)
+		default:
+			t.Fatalf("unsupported value %v", v)
+		}
+
+		require.Nil(t, binary.Write(&index, binary.BigEndian, []uint32{
+			uint32(e.tag), e.typ, uint32(offset), uint32(count),
+		}))
+	}
+
+	var b bytes.Buffer
+
+	b.Write(rpmHeaderMagic)
+	b.Write(make([]byte, 4))
+	require.Nil(t, binary.Write(&b, binary.BigEndian, []uint32{uint32(len(entries)), uint32(store.Len())}))
+	b.Write(index.Bytes())
+	b.Write(store.Bytes())
+
+	return b.Bytes()
+}
+
+func testRPM(t *testing.T, header []byte) []byte {
+	var b bytes.Buffer
+
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmLeadMagic)
+	b.Write(lead)
+
+	// a signature header of 16+16+5 bytes, padded to 40 bytes
+	b.Write(testRPMHeader(t, testRPMEntry{1000, rpmTypeString, "abcd"}))
+	b.Write(make([]byte, 3))
+
+	b.Write(header)
+	b.WriteString("compressed cpio payload")
+
+	return b.Bytes()
+}
+
+func testRPMMainHeader(t *testing.T, extra ...testRPMEntry) []byte {
+	sum := sha256.Sum256([]byte("roadrunner detector"))
+
+	return testRPMHeader(t, append([]testRPMEntry{
+		{rpmTagName, rpmTypeString, "rrdetector"},
+		{rpmTagVersion, rpmTypeString, "4.1.5"},
+		{rpmTagRelease, rpmTypeString, "2.fc34"},
+		{rpmTagSummary, rpmTypeI18NString, []string{"detects roadrunners"}},
+		{rpmTagDescription, rpmTypeI18NString, []string{"The ACME Roadrunner Detector."}},
+		{rpmTagPackager, rpmTypeString, "Wile E. Coyote <wile@acme.example>"},
+		{rpmTagURL, rpmTypeString, "https://acme.example/rrd"},
+		{rpmTagArch, rpmTypeString, "x86_64"},
+		{rpmTagSourceRPM, rpmTypeString, "rr-detector-4.1.5-2.fc34.src.rpm"},
+		{rpmTagFileSizes, rpmTypeInt32, []int32{19, 4096, 10, 0}},
+		{rpmTagFileModes, rpmTypeInt16, []uint16{0100755, 040755, 0120777, 0100644}},
+		{rpmTagFileDigests, rpmTypeStringArray, []string{hex.EncodeToString(sum[:]), "", "", ""}},
+		{rpmTagFileFlags, rpmTypeInt32, []int32{0, 0, 0, rpmFileGhost}},
+		{rpmTagRequireFlags, rpmTypeInt32, []int32{0, 1 << 24, 0, rpmSenseMissingOK, 0}},
+		{rpmTagRequireName, rpmTypeStringArray, []string{
+			"librr", "rpmlib(CompressedFileNames)", "/bin/sh", "anvil", "libc.so.6()(64bit)",
+		}},
+		{rpmTagDirIndexes, rpmTypeInt32, []int32{0, 1, 0, 2}},
+		{rpmTagBaseNames, rpmTypeStringArray, []string{"rrdetector", "rrdetector", "rrd", "rrd.log"}},
+		{rpmTagDirNames, rpmTypeStringArray, []string{"/usr/bin/", "/usr/share/", "/var/log/"}},
+		{rpmTagFileDigestAlgo, rpmTypeInt32, []int32{8}},
+		{rpmTagRecommendName, rpmTypeStringArray, []string{"rrdetector-doc"}},
+	}, extra...)...)
+}
+
+func TestNewCorpusTagFromRPM(t *testing.T) {
+	rpm := testRPM(t, testRPMMainHeader(t,
+		testRPMEntry{rpmTagEpoch, rpmTypeInt32, []int32{1}},
+		testRPMEntry{rpmTagVendor, rpmTypeString, "ACME"},
+	))
+
+	tag, err := NewCorpusTagFromRPM(bytes.NewReader(rpm), &RPMOptions{Namespace: "fedora"})
+	require.Nil(t, err)
+
+	assert.True(t, tag.Corpus)
+	assert.Equal(t, "pkg:rpm/fedora/rrdetector@4.1.5-2.fc34?arch=x86_64&epoch=1", tag.TagID.String())
+	assert.Equal(t, "rrdetector", tag.SoftwareName)
+	assert.Equal(t, "1:4.1.5", tag.SoftwareVersion)
+
+	meta := (*tag.SoftwareMetas)[0]
+	assert.Equal(t, "2.fc34", meta.Revision)
+	assert.Equal(t, "detects roadrunners", meta.Summary)
+	assert.Equal(t, "The ACME Roadrunner Detector.", meta.Description)
+	assert.Equal(t, "rr-detector", meta.Product)
+
+	require.Len(t, tag.Entities, 2)
+	assert.Equal(t, "ACME", tag.Entities[0].EntityName)
+	assert.Equal(t, "tagCreator distributor", tag.Entities[0].Roles.String())
+	assert.Equal(t, "Wile E. Coyote", tag.Entities[1].EntityName)
+
+	var links []string
+	for _, l := range *tag.Links {
+		use := ""
+		if l.Use != nil {
+			use = l.Use.String()
+		}
+		links = append(links, l.Rel.String()+" "+l.Href+" "+use)
+	}
+
+	assert.Equal(t, []string{
+		"see also https://acme.example/rrd ",
+		"requires pkg:rpm/fedora/librr required",
+		"requires pkg:rpm/fedora/anvil optional",
+		"requires pkg:rpm/fedora/rrdetector-doc recommended",
+		"installation media rrdetector-4.1.5-2.fc34.x86_64.rpm ",
+	}, links)
+
+	media := (*tag.Links)[4]
+	assert.Equal(t, RPMMediaType, media.MediaType)
+	sum := sha256.Sum256(rpm)
+	assert.Equal(t, HashEntries{{HashAlgID: Sha256, HashValue: sum[:]}}, media.Hashes)
+
+	files := map[string]*File{}
+	require.Nil(t, tag.Payload.Walk(func(r ResolvedItem) error {
+		if !r.IsDir() {
+			files[r.FullPath()] = r.File
+		}
+		return nil
+	}))
+
+	require.Len(t, files, 1)
+	f := files["/usr/bin/rrdetector"]
+	require.NotNil(t, f)
+	assert.Equal(t, int64(19), *f.Size)
+	assert.Equal(t, testSha256(t, "roadrunner detector"), f.Hash)
+}
+
+func TestNewCorpusTagFromRPM_old_file_names(t *testing.T) {
+	testRegisterMD5(t)
+
+	header := testRPMHeader(t,
+		testRPMEntry{rpmTagName, rpmTypeString, "rrdetector"},
+		testRPMEntry{rpmTagVersion, rpmTypeString, "4.1.5"},
+		testRPMEntry{rpmTagOldFileNames, rpmTypeStringArray, []string{"/usr/bin/rrdetector"}},
+		testRPMEntry{rpmTagLongFileSizes, rpmTypeInt64, []int64{19}},
+		testRPMEntry{rpmTagFileModes, rpmTypeInt16, []uint16{0100755}},
+		testRPMEntry{rpmTagFileDigests, rpmTypeStringArray, []string{testMD5("roadrunner detector")}},
+	)
+
+	creator, err := NewEntity("ACME Inventory", RoleTagCreator)
+	require.Nil(t, err)
+
+	tag, err := NewCorpusTagFromRPM(bytes.NewReader(testRPM(t, header)), &RPMOptions{
+		ImportOptions: ImportOptions{TagCreator: creator},
+		Artifact:      "rrd.rpm",
+		Href:          "https://acme.example/rrd.rpm",
+	})
+	require.Nil(t, err)
+
+	assert.Equal(t, "pkg:rpm/rrdetector@4.1.5", tag.TagID.String())
+	assert.Equal(t, "4.1.5", tag.SoftwareVersion)
+	assert.Nil(t, tag.SoftwareMetas)
+	require.Len(t, tag.Entities, 1)
+
+	media := (*tag.Links)[0]
+	assert.Equal(t, "rrd.rpm", media.Artifact)
+	assert.Equal(t, "https://acme.example/rrd.rpm", media.Href)
+
+	f := (*tag.Payload.Directories)[0]
+	require.NotNil(t, f.PathElements.Files)
+	rrd := (*f.PathElements.Files)[0]
+	assert.Equal(t, "rrdetector", rrd.FsName)
+	assert.Equal(t, testMD5HashAlg, rrd.Hash.HashAlgID)
+	assert.Equal(t, testMD5("roadrunner detector"), hex.EncodeToString(rrd.Hash.HashValue))
+}
+
+func TestNewCorpusTagFromRPM_noVendor(t *testing.T) {
+	rpm := testRPM(t, testRPMMainHeader(t))
+
+	tag, err := NewCorpusTagFromRPM(bytes.NewReader(rpm), nil)
+	require.Nil(t, err)
+
+	// the packager is also the distributor
+	require.Len(t, tag.Entities, 1)
+	assert.Equal(t, "Wile E. Coyote", tag.Entities[0].EntityName)
+	assert.Equal(t, "tagCreator distributor maintainer", tag.Entities[0].Roles.String())
+
+	// unless a vendor is supplied
+	tag, err = NewCorpusTagFromRPM(bytes.NewReader(rpm), &RPMOptions{Vendor: "ACME"})
+	require.Nil(t, err)
+
+	require.Len(t, tag.Entities, 2)
+	assert.Equal(t, "ACME", tag.Entities[0].EntityName)
+	assert.Equal(t, "Wile E. Coyote", tag.Entities[1].EntityName)
+}
+
+func TestNewCorpusTagFromRPM_ko(t *testing.T) {
+	truncated := testRPM(t, testRPMMainHeader(t))
+
+	badOffset := testRPMHeader(t, testRPMEntry{rpmTagName, rpmTypeString, "rrdetector"})
+	badOffset[16+11] = 0xff
+
+	for _, tv := range []struct {
+		rpm         []byte
+		expectedErr string
+	}{
+		{[]byte("not an rpm"), "not an RPM package: bad lead"},
+		{truncated[:rpmLeadSize+8], "signature header: unexpected EOF"},
+		{truncated[:rpmLeadSize+16+16+5+1], "signature header: unexpected EOF"},
+		{truncated[:rpmLeadSize+40+20], "header: unexpected EOF"},
+		{testRPM(t, []byte("bad header magic")), "header: bad magic"},
+		{testRPM(t, append(append([]byte{}, rpmHeaderMagic...), 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0)), "header: header too large: 65536 entries, 0 bytes"},
+		{testRPM(t, testRPMHeader(t, testRPMEntry{rpmTagName, rpmTypeString, "rrdetector"})), "missing name or version"},
+		{testRPM(t, badOffset), "header: tag 1000: offset 255 out of bounds"},
+	} {
+		_, err := NewCorpusTagFromRPM(bytes.NewReader(tv.rpm), &RPMOptions{Vendor: "ACME"})
+		assert.EqualError(t, err, tv.expectedErr)
+	}
+
+	// no vendor nor packager
+	header := testRPMHeader(t,
+		testRPMEntry{rpmTagName, rpmTypeString, "rrdetector"},
+		testRPMEntry{rpmTagVersion, rpmTypeString, "4.1.5"},
+	)
+
+	_, err := NewCorpusTagFromRPM(bytes.NewReader(testRPM(t, header)), nil)
+	assert.EqualError(t, err, "no tag creator: the package has no distributor")
+
+	// a broken directory index
+	header = testRPMHeader(t,
+		testRPMEntry{rpmTagName, rpmTypeString, "rrdetector"},
+		testRPMEntry{rpmTagVersion, rpmTypeString, "4.1.5"},
+		testRPMEntry{rpmTagDirIndexes, rpmTypeInt32, []int32{3}},
+		testRPMEntry{rpmTagBaseNames, rpmTypeStringArray, []string{"rrdetector"}},
+		testRPMEntry{rpmTagDirNames, rpmTypeStringArray, []string{"/usr/bin/"}},
+	)
+
+	_, err = NewCorpusTagFromRPM(bytes.NewReader(testRPM(t, header)), &RPMOptions{Vendor: "ACME"})
+	assert.EqualError(t, err, "rrdetector: bad directory index")
+}
+
+func TestDecodeRPMEntry_ko(t *testing.T) {
+	store := []byte("abc\x00def")
+
+	for _, tv := range []struct {
+		typ, offset, count uint32
+		expectedErr        string
+	}{
+		{rpmTypeString, 8, 1, "offset 8 out of bounds"},
+		{rpmTypeString, 4, 1, "unterminated string"},
+		{rpmTypeStringArray, 0, 8, "count 8 out of bounds"},
+		{rpmTypeInt32, 0, 2, "count 2 out of bounds"},
+		{rpmTypeBin, 4, 5, "count 5 out of bounds"},
+	} {
+		_, err := decodeRPMEntry(tv.typ, store, tv.offset, tv.count)
+		assert.EqualError(t, err, tv.expectedErr)
+	}
+
+	v, err := decodeRPMEntry(rpmTypeBin, store, 4, 3)
+	require.Nil(t, err)
+	assert.Equal(t, []byte("def"), v)
+
+	v, err = decodeRPMEntry(rpmTypeChar, store, 0, 2)
+	require.Nil(t, err)
+	assert.Equal(t, []int64{'a', 'b'}, v)
+
+	v, err = decodeRPMEntry(42, store, 0, 1)
+	require.Nil(t, err)
+	assert.Nil(t, v)
+}
@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"fmt"
+	"strings"
 )
 
 // SoftwareIdentity represents the top-level SWID
@@ -229,3 +231,62 @@ func (t *SoftwareIdentity) AddSoftwareMeta(m SoftwareMeta) error {
 
 	return nil
 }
+
+// InferHashAlgIDs replaces any unknown hash-alg-id found in the receiver
+// SoftwareIdentity (entity thumbprints, link hashes, and the files and
+// resource digests of payload and evidence) with the most likely algorithm
+// given the length of the associated hash value. This is typically used after
+// converting tags from ISO SWID, which do not allow an algorithm to be
+// identified. The entries whose algorithm cannot be inferred are left
+// unknown, and reported together in the returned error.
+func (t *SoftwareIdentity) InferHashAlgIDs() error {
+	var a algInferrer
+
+	for i := range t.Entities {
+		if t.Entities[i].Thumbprint != nil {
+			a.infer(fmt.Sprintf("entity %q thumbprint", t.Entities[i].EntityName), t.Entities[i].Thumbprint)
+		}
+	}
+
+	if t.Links != nil {
+		for i := range *t.Links {
+			l := &(*t.Links)[i]
+			a.inferAll(fmt.Sprintf("link %q", l.Href), l.Hashes)
+		}
+	}
+
+	if t.Payload != nil {
+		a.scope = "payload: "
+		t.Payload.ResourceCollection.inferHashAlgIDs(&a)
+	}
+
+	if t.Evidence != nil {
+		a.scope = "evidence: "
+		t.Evidence.ResourceCollection.inferHashAlgIDs(&a)
+	}
+
+	if len(a.errs) != 0 {
+		return errors.New(strings.Join(a.errs, "; "))
+	}
+
+	return nil
+}
+
+// algInferrer infers the algorithm of hash entries, collecting the errors
+type algInferrer struct {
+	// the prefix of the errors (e.g., "payload: ")
+	scope string
+	errs  []string
+}
+
+func (a *algInferrer) infer(where string, h *HashEntry) {
+	if err := h.InferAlgID(); err != nil {
+		a.errs = append(a.errs, a.scope+where+": "+err.Error())
+	}
+}
+
+func (a *algInferrer) inferAll(where string, hashes HashEntries) {
+	for i := range hashes {
+		a.infer(where, &hashes[i])
+	}
+}
@@ -310,3 +310,87 @@ func TestTag_RoundtripPSABundle(t *testing.T) {
 
 	roundTripper(t, tv, expectedCBOR)
 }
+
+func TestTag_InferHashAlgIDs(t *testing.T) {
+	data := []byte(`<SoftwareIdentity tagId="com.acme.rrd2013-ce-sp1-v4-1-5-0" name="ACME Roadrunner Detector 2013 Coyote Edition SP1" version="4.1.5"><Entity name="The ACME Corporation" regid="acme.com" role="tagCreator softwareCreator"></Entity><Payload><Directory name="rrdetector" root="%programdata%"><File name="rrdetector.exe" size="532712" hash="unknown;oxT8LcZjrnpra8Z4dZQFc5bms/VpzVD9XdtNG7r9K2o="></File></Directory></Payload></SoftwareIdentity>`)
+
+	var tag SoftwareIdentity
+	require.Nil(t, tag.FromXML(data))
+
+	f := (*(*tag.Payload.Directories)[0].Files)[0]
+	assert.Equal(t, UnknownHashAlg, f.Hash.HashAlgID)
+
+	// alg-id 0 survives conversion to CoSWID
+	cbor, err := tag.ToCBOR()
+	require.Nil(t, err)
+
+	var fromCBOR SoftwareIdentity
+	require.Nil(t, fromCBOR.FromCBOR(cbor))
+	f = (*(*fromCBOR.Payload.Directories)[0].Files)[0]
+	assert.Equal(t, UnknownHashAlg, f.Hash.HashAlgID)
+
+	require.Nil(t, tag.InferHashAlgIDs())
+	f = (*(*tag.Payload.Directories)[0].Files)[0]
+	assert.Equal(t, Sha256, f.Hash.HashAlgID)
+}
+
+func TestTag_InferHashAlgIDs_fail(t *testing.T) {
+	tag, err := NewTag("example.acme.roadrunner-sw-v1-0-0", "Roadrunner software", "1.0.0")
+	require.Nil(t, err)
+
+	payload := NewPayload()
+	require.Nil(t, payload.AddFile(File{
+		FileSystemItem: FileSystemItem{FsName: "roadrunner.bin"},
+		Hash: &HashEntry{
+			HashAlgID: UnknownHashAlg,
+			HashValue: []byte{0xde, 0xad, 0xbe, 0xef},
+		},
+	}))
+	tag.Payload = payload
+
+	assert.EqualError(t,
+		tag.InferHashAlgIDs(),
+		`payload: file "roadrunner.bin": cannot infer hash algorithm from a 4 bytes value`,
+	)
+}
+
+func TestTag_InferHashAlgIDs_allEntries(t *testing.T) {
+	tag, err := NewTag("example.acme.roadrunner-sw-v1-0-0", "Roadrunner software", "1.0.0")
+	require.Nil(t, err)
+
+	sha256Value := MustHexDecode(t, "e1a8b2a7bd3a2c6ba3a8e8a3e8fda3b40c6c52c7c5a3c0f9d1e8a2b0c1d2e3f4")
+	unknown := func(v []byte) HashEntry { return HashEntry{HashAlgID: UnknownHashAlg, HashValue: v} }
+
+	link, err := NewLink("example.acme.roadrunner-hw-v1-0-0", *NewRel(RelRequires))
+	require.Nil(t, err)
+	link.Hashes = HashEntries{unknown(sha256Value)}
+	require.Nil(t, tag.AddLink(*link))
+
+	payload := NewPayload()
+	require.Nil(t, payload.AddFile(File{
+		FileSystemItem: FileSystemItem{FsName: "roadrunner.bin"},
+		FileExtension:  FileExtension{Hashes: HashEntries{unknown([]byte{0xde, 0xad}), unknown(sha256Value)}},
+	}))
+	tag.Payload = payload
+
+	evidence := NewEvidence("")
+	require.Nil(t, evidence.AddResource(Resource{
+		ResourceExtension: ResourceExtension{Digests: HashEntries{unknown(sha256Value)}},
+		Type:              "pcr",
+	}))
+	tag.Evidence = evidence
+
+	// the odd digest does not prevent the other entries from being inferred
+	assert.EqualError(t,
+		tag.InferHashAlgIDs(),
+		`payload: file "roadrunner.bin": cannot infer hash algorithm from a 2 bytes value`,
+	)
+
+	assert.Equal(t, Sha256, (*tag.Links)[0].Hashes[0].HashAlgID)
+
+	hashes := (*tag.Payload.Files)[0].Hashes
+	assert.Equal(t, UnknownHashAlg, hashes[0].HashAlgID)
+	assert.Equal(t, Sha256, hashes[1].HashAlgID)
+
+	assert.Equal(t, Sha256, (*tag.Evidence.Resources)[0].Digests[0].HashAlgID)
+}
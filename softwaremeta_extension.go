@@ -3,7 +3,10 @@
 
 package swid
 
-// SoftwareMetaExtension is a placeholder for $$software-meta-extension
+// SoftwareMetaExtension models $$software-meta-extension
 type SoftwareMetaExtension struct {
-	// no software-meta-extension defined
+	// The checksum of the source of the software component, as recorded by
+	// its package ecosystem (e.g., the "h1:" hash of a Go module, as found in
+	// go.sum). In CoSWID it uses private index -1.
+	SourceChecksum string `cbor:"-1,keyasint,omitempty" json:"source-checksum,omitempty" xml:"sourceChecksum,attr,omitempty"`
 }
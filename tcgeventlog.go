@@ -0,0 +1,494 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// TCGEventType is the type of a TCG PC Client event log entry
+type TCGEventType uint32
+
+// Commonly used TCG event types (TCG PC Client Platform Firmware Profile)
+const (
+	TCGEventPrebootCert                TCGEventType = 0x00000000
+	TCGEventPostCode                   TCGEventType = 0x00000001
+	TCGEventNoAction                   TCGEventType = 0x00000003
+	TCGEventSeparator                  TCGEventType = 0x00000004
+	TCGEventAction                     TCGEventType = 0x00000005
+	TCGEventEventTag                   TCGEventType = 0x00000006
+	TCGEventSCRTMContents              TCGEventType = 0x00000007
+	TCGEventSCRTMVersion               TCGEventType = 0x00000008
+	TCGEventCPUMicrocode               TCGEventType = 0x00000009
+	TCGEventPlatformConfigFlags        TCGEventType = 0x0000000a
+	TCGEventTableOfDevices             TCGEventType = 0x0000000b
+	TCGEventCompactHash                TCGEventType = 0x0000000c
+	TCGEventIPL                        TCGEventType = 0x0000000d
+	TCGEventIPLPartitionData           TCGEventType = 0x0000000e
+	TCGEventNonhostCode                TCGEventType = 0x0000000f
+	TCGEventNonhostConfig              TCGEventType = 0x00000010
+	TCGEventNonhostInfo                TCGEventType = 0x00000011
+	TCGEventOmitBootDeviceEvents       TCGEventType = 0x00000012
+	TCGEventEFIVariableDriverConfig    TCGEventType = 0x80000001
+	TCGEventEFIVariableBoot            TCGEventType = 0x80000002
+	TCGEventEFIBootServicesApplication TCGEventType = 0x80000003
+	TCGEventEFIBootServicesDriver      TCGEventType = 0x80000004
+	TCGEventEFIRuntimeServicesDriver   TCGEventType = 0x80000005
+	TCGEventEFIGPTEvent                TCGEventType = 0x80000006
+	TCGEventEFIAction                  TCGEventType = 0x80000007
+	TCGEventEFIPlatformFirmwareBlob    TCGEventType = 0x80000008
+	TCGEventEFIHandoffTables           TCGEventType = 0x80000009
+	TCGEventEFIPlatformFirmwareBlob2   TCGEventType = 0x8000000a
+	TCGEventEFIHandoffTables2          TCGEventType = 0x8000000b
+	TCGEventEFIVariableBoot2           TCGEventType = 0x8000000c
+	TCGEventEFIHCRTMEvent              TCGEventType = 0x80000010
+	TCGEventEFIVariableAuthority       TCGEventType = 0x800000e0
+	TCGEventEFISPDMFirmwareBlob        TCGEventType = 0x800000e1
+	TCGEventEFISPDMFirmwareConfig      TCGEventType = 0x800000e2
+)
+
+var tcgEventTypeToString = map[TCGEventType]string{
+	TCGEventPrebootCert:                "EV_PREBOOT_CERT",
+	TCGEventPostCode:                   "EV_POST_CODE",
+	TCGEventNoAction:                   "EV_NO_ACTION",
+	TCGEventSeparator:                  "EV_SEPARATOR",
+	TCGEventAction:                     "EV_ACTION",
+	TCGEventEventTag:                   "EV_EVENT_TAG",
+	TCGEventSCRTMContents:              "EV_S_CRTM_CONTENTS",
+	TCGEventSCRTMVersion:               "EV_S_CRTM_VERSION",
+	TCGEventCPUMicrocode:               "EV_CPU_MICROCODE",
+	TCGEventPlatformConfigFlags:        "EV_PLATFORM_CONFIG_FLAGS",
+	TCGEventTableOfDevices:             "EV_TABLE_OF_DEVICES",
+	TCGEventCompactHash:                "EV_COMPACT_HASH",
+	TCGEventIPL:                        "EV_IPL",
+	TCGEventIPLPartitionData:           "EV_IPL_PARTITION_DATA",
+	TCGEventNonhostCode:                "EV_NONHOST_CODE",
+	TCGEventNonhostConfig:              "EV_NONHOST_CONFIG",
+	TCGEventNonhostInfo:                "EV_NONHOST_INFO",
+	TCGEventOmitBootDeviceEvents:       "EV_OMIT_BOOT_DEVICE_EVENTS",
+	TCGEventEFIVariableDriverConfig:    "EV_EFI_VARIABLE_DRIVER_CONFIG",
+	TCGEventEFIVariableBoot:            "EV_EFI_VARIABLE_BOOT",
+	TCGEventEFIBootServicesApplication: "EV_EFI_BOOT_SERVICES_APPLICATION",
+	TCGEventEFIBootServicesDriver:      "EV_EFI_BOOT_SERVICES_DRIVER",
+	TCGEventEFIRuntimeServicesDriver:   "EV_EFI_RUNTIME_SERVICES_DRIVER",
+	TCGEventEFIGPTEvent:                "EV_EFI_GPT_EVENT",
+	TCGEventEFIAction:                  "EV_EFI_ACTION",
+	TCGEventEFIPlatformFirmwareBlob:    "EV_EFI_PLATFORM_FIRMWARE_BLOB",
+	TCGEventEFIHandoffTables:           "EV_EFI_HANDOFF_TABLES",
+	TCGEventEFIPlatformFirmwareBlob2:   "EV_EFI_PLATFORM_FIRMWARE_BLOB2",
+	TCGEventEFIHandoffTables2:          "EV_EFI_HANDOFF_TABLES2",
+	TCGEventEFIVariableBoot2:           "EV_EFI_VARIABLE_BOOT2",
+	TCGEventEFIHCRTMEvent:              "EV_EFI_HCRTM_EVENT",
+	TCGEventEFIVariableAuthority:       "EV_EFI_VARIABLE_AUTHORITY",
+	TCGEventEFISPDMFirmwareBlob:        "EV_EFI_SPDM_FIRMWARE_BLOB",
+	TCGEventEFISPDMFirmwareConfig:      "EV_EFI_SPDM_FIRMWARE_CONFIG",
+}
+
+// String returns the name of the event type as found in the TCG
+// specifications, e.g., EV_SEPARATOR
+func (t TCGEventType) String() string {
+	if s, ok := tcgEventTypeToString[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("EV_UNKNOWN(0x%08x)", uint32(t))
+}
+
+// TPM 2.0 algorithm identifiers (TCG Algorithm Registry) mapped to hash
+// algorithm IDs. Digests computed with algorithms not listed here (e.g., SHA-1
+// and SM3) are recorded with the unknown hash algorithm.
+var tpmAlgToHashAlg = map[uint16]uint64{
+	0x000b: Sha256,
+	0x000c: Sha384,
+	0x000d: Sha512,
+	0x0027: Sha3_256,
+	0x0028: Sha3_384,
+	0x0029: Sha3_512,
+}
+
+// TCGEvent is an entry of a crypto-agile TCG PC Client event log
+// (TCG_PCR_EVENT2)
+type TCGEvent struct {
+	PCR  uint32
+	Type TCGEventType
+
+	// One digest per hash algorithm used by the log
+	Digests HashEntries
+
+	// The event data, whose format depends on the event type
+	Data []byte
+}
+
+// TCGEventLog is a parsed crypto-agile TCG PC Client event log
+type TCGEventLog struct {
+	// The version of the specification the log conforms to, as recorded in
+	// the Spec ID event (e.g., "2.0")
+	SpecVersion string
+
+	// The TPM algorithm identifiers of the digests found in each event, with
+	// their sizes, in the order declared in the Spec ID event
+	Algorithms []TCGAlgorithm
+
+	// The events following the Spec ID event
+	Events []TCGEvent
+}
+
+// TCGAlgorithm is a digest algorithm declared in the Spec ID event
+type TCGAlgorithm struct {
+	TPMAlgID   uint16
+	DigestSize uint16
+}
+
+const (
+	tcgSpecIDSignature = "Spec ID Event03\x00"
+	tcgSHA1DigestSize  = 20
+
+	// upper bounds used to reject corrupted logs before allocating memory
+	tcgMaxEventSize  = 16 << 20
+	tcgMaxAlgorithms = 32
+)
+
+// ParseTCGEventLog parses a binary TCG PC Client event log in the
+// crypto-agile format, e.g., as read from
+// /sys/kernel/security/tpm0/binary_bios_measurements. The first event must be
+// the Spec ID event declaring the digest algorithms in use.
+func ParseTCGEventLog(r io.Reader) (*TCGEventLog, error) {
+	br := bufio.NewReader(r)
+
+	l, err := parseTCGSpecIDEvent(br)
+	if err != nil {
+		return nil, fmt.Errorf("spec ID event: %w", err)
+	}
+
+	sizes := map[uint16]uint16{}
+	for _, a := range l.Algorithms {
+		sizes[a.TPMAlgID] = a.DigestSize
+	}
+
+	for n := 1; ; n++ {
+		if _, err := br.Peek(1); err == io.EOF {
+			break
+		}
+
+		e, err := parseTCGEvent(br, sizes)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", n, unexpectedEOF(err))
+		}
+
+		l.Events = append(l.Events, *e)
+	}
+
+	return l, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func readEventData(r io.Reader) ([]byte, error) {
+	var size uint32
+
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+
+	if size > tcgMaxEventSize {
+		return nil, fmt.Errorf("event size %d exceeds the maximum of %d", size, tcgMaxEventSize)
+	}
+
+	data := make([]byte, size)
+
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// parseTCGSpecIDEvent parses the first event, which uses the SHA-1 log format
+// (TCG_PCClientPCREvent) and carries a TCG_EfiSpecIdEvent
+func parseTCGSpecIDEvent(r io.Reader) (*TCGEventLog, error) {
+	var hdr struct {
+		PCR    uint32
+		Type   uint32
+		Digest [tcgSHA1DigestSize]byte
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	if TCGEventType(hdr.Type) != TCGEventNoAction {
+		return nil, fmt.Errorf("unexpected event type %s", TCGEventType(hdr.Type))
+	}
+
+	data, err := readEventData(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	d := bytes.NewReader(data)
+
+	var spec struct {
+		Signature     [16]byte
+		PlatformClass uint32
+		VersionMinor  uint8
+		VersionMajor  uint8
+		Errata        uint8
+		UintnSize     uint8
+		NumAlgorithms uint32
+	}
+
+	if err := binary.Read(d, binary.LittleEndian, &spec); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	if string(spec.Signature[:]) != tcgSpecIDSignature {
+		return nil, errors.New("not a crypto-agile event log")
+	}
+
+	if spec.NumAlgorithms == 0 || spec.NumAlgorithms > tcgMaxAlgorithms {
+		return nil, fmt.Errorf("bad number of algorithms %d", spec.NumAlgorithms)
+	}
+
+	l := TCGEventLog{
+		SpecVersion: fmt.Sprintf("%d.%d", spec.VersionMajor, spec.VersionMinor),
+		Algorithms:  make([]TCGAlgorithm, spec.NumAlgorithms),
+	}
+
+	if err := binary.Read(d, binary.LittleEndian, l.Algorithms); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return &l, nil
+}
+
+func parseTCGEvent(r io.Reader, sizes map[uint16]uint16) (*TCGEvent, error) {
+	var hdr struct {
+		PCR   uint32
+		Type  uint32
+		Count uint32
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+
+	if hdr.Count > uint32(len(sizes)) {
+		return nil, fmt.Errorf("%d digests found, but only %d algorithms declared", hdr.Count, len(sizes))
+	}
+
+	e := TCGEvent{PCR: hdr.PCR, Type: TCGEventType(hdr.Type)}
+
+	for i := uint32(0); i < hdr.Count; i++ {
+		var algID uint16
+
+		if err := binary.Read(r, binary.LittleEndian, &algID); err != nil {
+			return nil, err
+		}
+
+		size, ok := sizes[algID]
+		if !ok {
+			return nil, fmt.Errorf("undeclared digest algorithm 0x%04x", algID)
+		}
+
+		value := make([]byte, size)
+
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, err
+		}
+
+		var h HashEntry
+
+		if err := h.Set(tpmAlgToHashAlg[algID], value); err != nil {
+			return nil, fmt.Errorf("digest algorithm 0x%04x: %w", algID, err)
+		}
+
+		e.Digests = append(e.Digests, h)
+	}
+
+	data, err := readEventData(r)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Data = data
+
+	return &e, nil
+}
+
+// TCGEventResourceType is the type of the resources that record TCG event log
+// entries in an Evidence
+const TCGEventResourceType = "tcg-event"
+
+// AddTCGEvents adds the supplied TCG events to the Evidence receiver as
+// resources of type TCGEventResourceType, recording the PCR index, the event
+// type and the digests. EV_NO_ACTION events are skipped, as they are not
+// extended into PCRs.
+func (e *Evidence) AddTCGEvents(events []TCGEvent) error {
+	for _, te := range events {
+		if te.Type == TCGEventNoAction {
+			continue
+		}
+
+		pcr, eventType := te.PCR, uint32(te.Type)
+
+		r := Resource{
+			Type: TCGEventResourceType,
+			ResourceExtension: ResourceExtension{
+				PCR:       &pcr,
+				EventType: &eventType,
+				Digests:   te.Digests,
+			},
+		}
+
+		if err := e.AddResource(r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MeasuredFile is a reference file whose hashes match the digests of one or
+// more measurements
+type MeasuredFile struct {
+	// The full path of the file as declared in the reference tag
+	Path string
+
+	// The file declared in the reference tag
+	File *File
+
+	// The matching measurements, i.e., evidence resources of type
+	// TCGEventResourceType
+	Measurements []*Resource
+}
+
+// MeasuredBootTagAppraisal is the appraisal of measured boot evidence against
+// a reference tag
+type MeasuredBootTagAppraisal struct {
+	// The reference tag
+	Tag *SoftwareIdentity
+
+	// Either AppraisalMatched if all the hashed reference files are
+	// measured, AppraisalPartial if some are, or AppraisalNoMatch
+	Status AppraisalStatus
+
+	// The reference files found in the measurements
+	Measured []MeasuredFile
+
+	// The paths of the hashed reference files that are not found in the
+	// measurements
+	NotMeasured []string
+}
+
+// MeasuredBootAppraisal is the result produced by AppraiseMeasuredBoot
+type MeasuredBootAppraisal struct {
+	// One entry per reference tag, in the order in which the reference tags
+	// are supplied
+	Tags []MeasuredBootTagAppraisal
+
+	// The measurements whose digests do not match any reference file
+	Unmatched []*Resource
+}
+
+// AppraiseMeasuredBoot matches the TCG event resources of the supplied
+// Evidence against the files declared in the payloads of the supplied
+// reference tags (e.g., TCG PC Client RIMs). A reference file matches a
+// measurement if any of its hashes equals the digest computed by the same
+// algorithm. Reference files without hashes are ignored.
+func AppraiseMeasuredBoot(ev *Evidence, refs []*SoftwareIdentity) (*MeasuredBootAppraisal, error) {
+	if ev == nil {
+		return nil, errors.New("no evidence to appraise")
+	}
+
+	var measurements []*Resource
+
+	if ev.Resources != nil {
+		for i := range *ev.Resources {
+			if r := &(*ev.Resources)[i]; r.Type == TCGEventResourceType {
+				measurements = append(measurements, r)
+			}
+		}
+	}
+
+	// measurements indexed by digest
+	byDigest := map[string][]int{}
+
+	for i, m := range measurements {
+		for _, d := range m.Digests {
+			if d.HashAlgID != UnknownHashAlg {
+				k := d.String()
+				byDigest[k] = append(byDigest[k], i)
+			}
+		}
+	}
+
+	var res MeasuredBootAppraisal
+
+	matched := make([]bool, len(measurements))
+
+	for i, ref := range refs {
+		if ref == nil {
+			return nil, fmt.Errorf("reference tag at index %d is nil", i)
+		}
+
+		ta := MeasuredBootTagAppraisal{Tag: ref}
+
+		if ref.Payload != nil {
+			_ = ref.Payload.Walk(func(r ResolvedItem) error {
+				if r.IsDir() || len(r.File.AllHashes()) == 0 {
+					return nil
+				}
+
+				mf := MeasuredFile{Path: r.FullPath(), File: r.File}
+				seen := map[int]bool{}
+
+				for _, h := range r.File.AllHashes() {
+					for _, j := range byDigest[h.String()] {
+						if !seen[j] {
+							seen[j] = true
+							matched[j] = true
+							mf.Measurements = append(mf.Measurements, measurements[j])
+						}
+					}
+				}
+
+				if len(mf.Measurements) == 0 {
+					ta.NotMeasured = append(ta.NotMeasured, mf.Path)
+				} else {
+					ta.Measured = append(ta.Measured, mf)
+				}
+
+				return nil
+			})
+		}
+
+		switch {
+		case len(ta.Measured) == 0:
+			ta.Status = AppraisalNoMatch
+		case len(ta.NotMeasured) != 0:
+			ta.Status = AppraisalPartial
+		default:
+			ta.Status = AppraisalMatched
+		}
+
+		res.Tags = append(res.Tags, ta)
+	}
+
+	for i, m := range measurements {
+		if !matched[i] {
+			res.Unmatched = append(res.Unmatched, m)
+		}
+	}
+
+	return &res, nil
+}
@@ -0,0 +1,290 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testTCGEvent struct {
+	PCR  uint32
+	Type TCGEventType
+	Data []byte
+}
+
+func writeLE(t *testing.T, w io.Writer, v interface{}) {
+	require.Nil(t, binary.Write(w, binary.LittleEndian, v))
+}
+
+func testTCGSpecIDEvent(t *testing.T, sig string, algs []TCGAlgorithm) []byte {
+	var spec bytes.Buffer
+
+	spec.WriteString(sig)
+	writeLE(t, &spec, uint32(0))         // platform class
+	spec.Write([]byte{0, 2, 0, 8})       // version minor, major, errata, uintn size
+	writeLE(t, &spec, uint32(len(algs))) // number of algorithms
+	writeLE(t, &spec, algs)              // digest sizes
+	spec.WriteByte(0)                    // vendor info size
+
+	var b bytes.Buffer
+
+	writeLE(t, &b, uint32(0))
+	writeLE(t, &b, uint32(TCGEventNoAction))
+	b.Write(make([]byte, 20))
+	writeLE(t, &b, uint32(spec.Len()))
+	b.Write(spec.Bytes())
+
+	return b.Bytes()
+}
+
+// testTCGEventLog builds a crypto-agile log whose events carry the SHA-1 and
+// SHA-256 digests of their data
+func testTCGEventLog(t *testing.T, events []testTCGEvent) []byte {
+	var b bytes.Buffer
+
+	b.Write(testTCGSpecIDEvent(t, tcgSpecIDSignature, []TCGAlgorithm{
+		{TPMAlgID: 0x0004, DigestSize: 20},
+		{TPMAlgID: 0x000b, DigestSize: 32},
+	}))
+
+	for _, e := range events {
+		writeLE(t, &b, e.PCR)
+		writeLE(t, &b, uint32(e.Type))
+		writeLE(t, &b, uint32(2))
+
+		s1, s256 := sha1.Sum(e.Data), sha256.Sum256(e.Data)
+
+		writeLE(t, &b, uint16(0x0004))
+		b.Write(s1[:])
+		writeLE(t, &b, uint16(0x000b))
+		b.Write(s256[:])
+
+		writeLE(t, &b, uint32(len(e.Data)))
+		b.Write(e.Data)
+	}
+
+	return b.Bytes()
+}
+
+var testTCGEvents = []testTCGEvent{
+	{PCR: 0, Type: TCGEventSCRTMVersion, Data: []byte("ACME CRTM 1.0")},
+	{PCR: 0, Type: TCGEventEFIPlatformFirmwareBlob, Data: []byte("acme firmware volume")},
+	{PCR: 0, Type: TCGEventNoAction, Data: []byte("StartupLocality")},
+	{PCR: 4, Type: TCGEventEFIBootServicesApplication, Data: []byte("shimx64.efi")},
+	{PCR: 7, Type: TCGEventSeparator, Data: []byte{0, 0, 0, 0}},
+}
+
+func TestParseTCGEventLog(t *testing.T) {
+	l, err := ParseTCGEventLog(bytes.NewReader(testTCGEventLog(t, testTCGEvents)))
+	require.Nil(t, err)
+
+	assert.Equal(t, "2.0", l.SpecVersion)
+	assert.Equal(t, []TCGAlgorithm{{0x0004, 20}, {0x000b, 32}}, l.Algorithms)
+	require.Len(t, l.Events, 5)
+
+	e := l.Events[3]
+	assert.Equal(t, uint32(4), e.PCR)
+	assert.Equal(t, TCGEventEFIBootServicesApplication, e.Type)
+	assert.Equal(t, []byte("shimx64.efi"), e.Data)
+	require.Len(t, e.Digests, 2)
+
+	s1 := sha1.Sum([]byte("shimx64.efi"))
+	assert.Equal(t, HashEntry{HashAlgID: UnknownHashAlg, HashValue: s1[:]}, e.Digests[0])
+	assert.Equal(t, *testSha256(t, "shimx64.efi"), e.Digests[1])
+}
+
+func TestParseTCGEventLog_ko(t *testing.T) {
+	good := testTCGEventLog(t, testTCGEvents[:1])
+	specLen := len(testTCGEventLog(t, nil))
+
+	var badCount bytes.Buffer
+	badCount.Write(good[:specLen])
+	writeLE(t, &badCount, []uint32{0, 1, 3})
+
+	var badAlg bytes.Buffer
+	badAlg.Write(good[:specLen])
+	writeLE(t, &badAlg, []uint32{0, 1, 1})
+	writeLE(t, &badAlg, uint16(0x000c))
+
+	var badSize bytes.Buffer
+	badSize.Write(good[:specLen])
+	writeLE(t, &badSize, []uint32{0, 1, 0, tcgMaxEventSize + 1})
+
+	notSpecID := testTCGSpecIDEvent(t, tcgSpecIDSignature, nil)
+	notSpecID[4] = byte(TCGEventSeparator)
+
+	for _, tv := range []struct {
+		In          []byte
+		ExpectedErr string
+	}{
+		{nil, "spec ID event: unexpected EOF"},
+		{good[:10], "spec ID event: unexpected EOF"},
+		{notSpecID, "spec ID event: unexpected event type EV_SEPARATOR"},
+		{testTCGSpecIDEvent(t, "Spec ID Event00\x00", nil), "spec ID event: not a crypto-agile event log"},
+		{testTCGSpecIDEvent(t, tcgSpecIDSignature, nil), "spec ID event: bad number of algorithms 0"},
+		{good[:specLen+20], "event 1: unexpected EOF"},
+		{good[:len(good)-1], "event 1: unexpected EOF"},
+		{badCount.Bytes(), "event 1: 3 digests found, but only 2 algorithms declared"},
+		{badAlg.Bytes(), "event 1: undeclared digest algorithm 0x000c"},
+		{badSize.Bytes(), "event 1: event size 16777217 exceeds the maximum of 16777216"},
+	} {
+		_, err := ParseTCGEventLog(bytes.NewReader(tv.In))
+		assert.EqualError(t, err, tv.ExpectedErr)
+	}
+
+	// the declared digest size must match the registered algorithm
+	var b bytes.Buffer
+	b.Write(testTCGSpecIDEvent(t, tcgSpecIDSignature, []TCGAlgorithm{{TPMAlgID: 0x000b, DigestSize: 20}}))
+	writeLE(t, &b, []uint32{0, 1, 1})
+	writeLE(t, &b, uint16(0x000b))
+	b.Write(make([]byte, 20))
+
+	_, err := ParseTCGEventLog(&b)
+	assert.EqualError(t, err, "event 1: digest algorithm 0x000b: length mismatch for hash algorithm sha-256: want 32 bytes, got 20")
+}
+
+func TestTCGEventType_String(t *testing.T) {
+	assert.Equal(t, "EV_EFI_BOOT_SERVICES_APPLICATION", TCGEventEFIBootServicesApplication.String())
+	assert.Equal(t, "EV_UNKNOWN(0x80000fff)", TCGEventType(0x80000fff).String())
+}
+
+func TestEvidence_AddTCGEvents(t *testing.T) {
+	l, err := ParseTCGEventLog(bytes.NewReader(testTCGEventLog(t, testTCGEvents)))
+	require.Nil(t, err)
+
+	e := NewEvidence("BAD809B1-7032-43D9-8F94-BF128E5D061D")
+	require.Nil(t, e.AddTCGEvents(l.Events))
+
+	// EV_NO_ACTION is skipped
+	require.Len(t, *e.Resources, 4)
+
+	r := (*e.Resources)[2]
+	assert.Equal(t, TCGEventResourceType, r.Type)
+	assert.Equal(t, uint32(4), *r.PCR)
+	assert.Equal(t, uint32(TCGEventEFIBootServicesApplication), *r.EventType)
+	assert.Equal(t, l.Events[3].Digests, r.Digests)
+
+	// serializations
+	pcr, eventType := uint32(4), uint32(TCGEventEFIBootServicesApplication)
+	tv := Resource{
+		Type: TCGEventResourceType,
+		ResourceExtension: ResourceExtension{
+			PCR:       &pcr,
+			EventType: &eventType,
+			Digests:   HashEntries{*testSha256(t, "shimx64.efi")},
+		},
+	}
+
+	data, err := em.Marshal(tv)
+	require.Nil(t, err)
+
+	var actual Resource
+	require.Nil(t, dm.Unmarshal(data, &actual))
+	assert.Equal(t, tv, actual)
+
+	j, err := json.Marshal(tv)
+	require.Nil(t, err)
+	assert.JSONEq(t, `{
+		"type": "tcg-event",
+		"pcr": 4,
+		"event-type": 2147483651,
+		"digests": [ "`+testSha256(t, "shimx64.efi").String()+`" ]
+	}`, string(j))
+
+	x, err := xml.Marshal(tv)
+	require.Nil(t, err)
+
+	actual = Resource{}
+	require.Nil(t, xml.Unmarshal(x, &actual))
+	assert.Equal(t, tv, actual)
+}
+
+func TestAppraiseMeasuredBoot(t *testing.T) {
+	l, err := ParseTCGEventLog(bytes.NewReader(testTCGEventLog(t, testTCGEvents)))
+	require.Nil(t, err)
+
+	ev := NewEvidence("BAD809B1-7032-43D9-8F94-BF128E5D061D")
+	require.Nil(t, ev.AddTCGEvents(l.Events))
+	require.Nil(t, ev.AddFile(File{FileSystemItem: FileSystemItem{FsName: "ignored"}}))
+
+	firmware, err := NewTag("com.acme.firmware", "ACME Firmware", "1.0")
+	require.Nil(t, err)
+	firmware.Payload = NewPayload()
+	require.Nil(t, firmware.Payload.AddFile(File{
+		FileSystemItem: FileSystemItem{FsName: "crtm"},
+		Hash:           testSha256(t, "ACME CRTM 1.0"),
+	}))
+	require.Nil(t, firmware.Payload.AddFile(File{
+		FileSystemItem: FileSystemItem{FsName: "fv.bin"},
+		Hash:           testSha256(t, "acme firmware volume"),
+	}))
+
+	shim, err := NewTag("com.acme.shim", "ACME Shim", "15.4")
+	require.Nil(t, err)
+	shim.Payload = NewPayload()
+	require.Nil(t, shim.Payload.AddDirectory(Directory{
+		FileSystemItem: FileSystemItem{Location: "EFI", FsName: "BOOT"},
+		PathElements: &PathElements{
+			Files: &Files{
+				{FileSystemItem: FileSystemItem{FsName: "shimx64.efi"}, Hash: testSha256(t, "shimx64.efi")},
+				{FileSystemItem: FileSystemItem{FsName: "mmx64.efi"}, Hash: testSha256(t, "mmx64.efi")},
+				{FileSystemItem: FileSystemItem{FsName: "BOOTX64.CSV"}},
+			},
+		},
+	}))
+
+	grub, err := NewTag("com.acme.grub", "ACME GRUB", "2.06")
+	require.Nil(t, err)
+	grub.Payload = NewPayload()
+	require.Nil(t, grub.Payload.AddFile(File{
+		FileSystemItem: FileSystemItem{FsName: "grubx64.efi"},
+		Hash:           testSha256(t, "grubx64.efi"),
+	}))
+
+	noPayload, err := NewTag("com.acme.empty", "Empty", "1.0")
+	require.Nil(t, err)
+
+	res, err := AppraiseMeasuredBoot(ev, []*SoftwareIdentity{firmware, shim, grub, noPayload})
+	require.Nil(t, err)
+	require.Len(t, res.Tags, 4)
+
+	ta := res.Tags[0]
+	assert.Equal(t, AppraisalMatched, ta.Status)
+	require.Len(t, ta.Measured, 2)
+	assert.Equal(t, "fv.bin", ta.Measured[1].Path)
+	require.Len(t, ta.Measured[1].Measurements, 1)
+	assert.Equal(t, uint32(TCGEventEFIPlatformFirmwareBlob), *ta.Measured[1].Measurements[0].EventType)
+
+	ta = res.Tags[1]
+	assert.Equal(t, AppraisalPartial, ta.Status)
+	assert.Equal(t, "EFI/BOOT/shimx64.efi", ta.Measured[0].Path)
+	assert.Equal(t, []string{"EFI/BOOT/mmx64.efi"}, ta.NotMeasured)
+
+	assert.Equal(t, AppraisalNoMatch, res.Tags[2].Status)
+	assert.Equal(t, AppraisalNoMatch, res.Tags[3].Status)
+
+	require.Len(t, res.Unmatched, 1)
+	assert.Equal(t, uint32(TCGEventSeparator), *res.Unmatched[0].EventType)
+
+	_, err = AppraiseMeasuredBoot(nil, nil)
+	assert.EqualError(t, err, "no evidence to appraise")
+
+	_, err = AppraiseMeasuredBoot(ev, []*SoftwareIdentity{nil})
+	assert.EqualError(t, err, "reference tag at index 0 is nil")
+
+	res, err = AppraiseMeasuredBoot(NewEvidence(""), []*SoftwareIdentity{firmware})
+	require.Nil(t, err)
+	assert.Equal(t, AppraisalNoMatch, res.Tags[0].Status)
+	assert.Equal(t, []string{"crtm", "fv.bin"}, res.Tags[0].NotMeasured)
+}
@@ -0,0 +1,272 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ResolvedItem is a directory or file from a resource collection, with its
+// path resolved against the enclosing directories
+type ResolvedItem struct {
+	// The effective root, i.e., the closest root found walking up the tree.
+	// Empty if no root is set, in which case Path is relative to the
+	// location of the tag.
+	Root string
+
+	// The slash separated path of the item relative to Root
+	Path string
+
+	// Whether the item, or any of its parent directories, is a key item
+	Key bool
+
+	// Exactly one of Directory and File is set
+	Directory *Directory
+	File      *File
+}
+
+// FullPath returns the path of the item including its root
+func (r ResolvedItem) FullPath() string {
+	return path.Join(r.Root, r.Path)
+}
+
+// IsDir returns true if the item is a directory
+func (r ResolvedItem) IsDir() bool {
+	return r.Directory != nil
+}
+
+func resolveItem(parent ResolvedItem, fsi FileSystemItem) ResolvedItem {
+	r := ResolvedItem{
+		Root: parent.Root,
+		Path: parent.Path,
+		Key:  parent.Key || (fsi.Key != nil && *fsi.Key),
+	}
+
+	if fsi.Root != "" {
+		r.Root, r.Path = fsi.Root, ""
+	}
+
+	r.Path = path.Join(r.Path, fsi.Location, fsi.FsName)
+
+	return r
+}
+
+// WalkFunc is the type of the function called by Walk for each item. If the
+// function returns fs.SkipDir when invoked on a directory, the content of the
+// directory is skipped. Any other error stops the walk and is returned by
+// Walk.
+type WalkFunc func(item ResolvedItem) error
+
+// Walk calls fn for each directory and file in the resource collection
+// receiver (e.g., a Payload or an Evidence), depth first, with directories
+// visited before their content, and in the order in which they appear in the
+// collection
+func (rc *ResourceCollection) Walk(fn WalkFunc) error {
+	return walkResolvedFrom(ResolvedItem{}, &rc.PathElements, fn)
+}
+
+func walkResolvedFrom(parent ResolvedItem, pe *PathElements, fn WalkFunc) error {
+	if pe == nil {
+		return nil
+	}
+
+	if pe.Directories != nil {
+		for i := range *pe.Directories {
+			d := &(*pe.Directories)[i]
+
+			r := resolveItem(parent, d.FileSystemItem)
+			r.Directory = d
+
+			if err := fn(r); err != nil {
+				if errors.Is(err, fs.SkipDir) {
+					continue
+				}
+				return err
+			}
+
+			if err := walkResolvedFrom(r, d.PathElements, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	if pe.Files != nil {
+		for i := range *pe.Files {
+			f := &(*pe.Files)[i]
+
+			r := resolveItem(parent, f.FileSystemItem)
+			r.File = f
+
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// PathEntry associates a file path to the metadata of the file
+type PathEntry struct {
+	// Slash separated path of the file. Absolute paths are placed under the
+	// "/" root, relative paths under no root.
+	Path string
+
+	// The file metadata (e.g., size and hashes). Its FsName, Location and
+	// Root are set by NewPathElementsFromPaths.
+	File File
+}
+
+// NewPathElementsFromPaths builds a minimal nested directory tree holding the
+// supplied files. Chains of directories with no files and a single
+// subdirectory are collapsed into the location of the innermost directory.
+// Directories and files are sorted by name. Paths that do not name a file
+// below their root, e.g., "/..", "a/.." or "../a", are rejected.
+func NewPathElementsFromPaths(entries []PathEntry) (*PathElements, error) {
+	abs, rel := newPathNode(), newPathNode()
+
+	for _, e := range entries {
+		if e.Path == "" || strings.HasSuffix(e.Path, "/") {
+			return nil, fmt.Errorf("invalid file path %q", e.Path)
+		}
+
+		n, p := rel, path.Clean(e.Path)
+		if path.IsAbs(p) {
+			n, p = abs, strings.TrimPrefix(p, "/")
+		}
+
+		if p == "" || p == "." || p == ".." || strings.HasPrefix(p, "../") {
+			return nil, fmt.Errorf("invalid file path %q", e.Path)
+		}
+
+		if err := n.add(strings.Split(p, "/"), e.File); err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Path, err)
+		}
+	}
+
+	var pe PathElements
+
+	rel.emit("", &pe)
+
+	var absPE PathElements
+
+	abs.emit("", &absPE)
+	setRoot(&absPE, "/")
+
+	if absPE.Directories != nil {
+		for _, d := range *absPE.Directories {
+			pe.addDirectory(d)
+		}
+	}
+
+	if absPE.Files != nil {
+		for _, f := range *absPE.Files {
+			pe.addFile(f)
+		}
+	}
+
+	return &pe, nil
+}
+
+type pathNode struct {
+	dirs  map[string]*pathNode
+	files map[string]File
+}
+
+func newPathNode() *pathNode {
+	return &pathNode{
+		dirs:  map[string]*pathNode{},
+		files: map[string]File{},
+	}
+}
+
+func (n *pathNode) add(elems []string, f File) error {
+	name := elems[0]
+
+	if len(elems) == 1 {
+		if _, ok := n.files[name]; ok {
+			return errors.New("duplicate file")
+		}
+		if _, ok := n.dirs[name]; ok {
+			return errors.New("file clashes with directory")
+		}
+		n.files[name] = f
+		return nil
+	}
+
+	if _, ok := n.files[name]; ok {
+		return errors.New("directory clashes with file")
+	}
+
+	child, ok := n.dirs[name]
+	if !ok {
+		child = newPathNode()
+		n.dirs[name] = child
+	}
+
+	return child.add(elems[1:], f)
+}
+
+// emit adds the content of the node to pe, using loc as the location of
+// the added items
+func (n *pathNode) emit(loc string, pe *PathElements) {
+	for _, name := range sortedKeys(n.dirs) {
+		child := n.dirs[name]
+
+		if len(child.files) == 0 && len(child.dirs) == 1 {
+			child.emit(path.Join(loc, name), pe)
+			continue
+		}
+
+		sub := PathElements{}
+		child.emit("", &sub)
+
+		pe.addDirectory(Directory{
+			FileSystemItem: FileSystemItem{Location: loc, FsName: name},
+			PathElements:   &sub,
+		})
+	}
+
+	names := make([]string, 0, len(n.files))
+	for name := range n.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := n.files[name]
+		f.Root, f.Location, f.FsName = "", loc, name
+		pe.addFile(f)
+	}
+}
+
+func sortedKeys(m map[string]*pathNode) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (p *PathElements) addDirectory(d Directory) {
+	if p.Directories == nil {
+		p.Directories = new(Directories)
+	}
+
+	*p.Directories = append(*p.Directories, d)
+}
+
+func (p *PathElements) addFile(f File) {
+	if p.Files == nil {
+		p.Files = new(Files)
+	}
+
+	*p.Files = append(*p.Files, f)
+}
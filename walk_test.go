@@ -0,0 +1,227 @@
+// Copyright 2021 Contributors to the Veraison project.
+// SPDX-License-Identifier: Apache-2.0
+
+package swid
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testWalkPayload() *Payload {
+	yes, no := true, false
+
+	p := NewPayload()
+
+	_ = p.AddDirectory(Directory{
+		FileSystemItem: FileSystemItem{
+			Root:     "%programdata%",
+			Location: "acme",
+			FsName:   "rrdetector",
+			Key:      &yes,
+		},
+		PathElements: &PathElements{
+			Directories: &Directories{
+				{
+					FileSystemItem: FileSystemItem{FsName: "plugins"},
+					PathElements: &PathElements{
+						Files: &Files{
+							{FileSystemItem: FileSystemItem{FsName: "coyote.dll", Key: &no}},
+						},
+					},
+				},
+				{
+					FileSystemItem: FileSystemItem{FsName: "tmp", Root: "%temp%"},
+					PathElements: &PathElements{
+						Files: &Files{
+							{FileSystemItem: FileSystemItem{FsName: "rr.log"}},
+						},
+					},
+				},
+			},
+			Files: &Files{
+				{FileSystemItem: FileSystemItem{FsName: "rrdetector.exe", Location: "bin"}},
+			},
+		},
+	})
+
+	_ = p.AddFile(File{FileSystemItem: FileSystemItem{FsName: "README.txt"}})
+
+	return p
+}
+
+func TestResourceCollection_Walk(t *testing.T) {
+	type item struct {
+		Path  string
+		Key   bool
+		IsDir bool
+	}
+
+	var actual []item
+
+	err := testWalkPayload().Walk(func(r ResolvedItem) error {
+		actual = append(actual, item{r.FullPath(), r.Key, r.IsDir()})
+		return nil
+	})
+	require.Nil(t, err)
+
+	expected := []item{
+		{"%programdata%/acme/rrdetector", true, true},
+		{"%programdata%/acme/rrdetector/plugins", true, true},
+		// key flag is inherited
+		{"%programdata%/acme/rrdetector/plugins/coyote.dll", true, false},
+		// root resets the path
+		{"%temp%/tmp", true, true},
+		{"%temp%/tmp/rr.log", true, false},
+		{"%programdata%/acme/rrdetector/bin/rrdetector.exe", true, false},
+		// no root: relative to the tag
+		{"README.txt", false, false},
+	}
+
+	assert.Equal(t, expected, actual)
+}
+
+func TestResourceCollection_Walk_skip_and_stop(t *testing.T) {
+	var paths []string
+
+	err := testWalkPayload().Walk(func(r ResolvedItem) error {
+		paths = append(paths, r.FullPath())
+		if r.IsDir() && r.Directory.FsName == "plugins" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	require.Nil(t, err)
+	assert.NotContains(t, paths, "%programdata%/acme/rrdetector/plugins/coyote.dll")
+	assert.Contains(t, paths, "%temp%/tmp/rr.log")
+
+	stop := errors.New("stop")
+	n := 0
+
+	err = testWalkPayload().Walk(func(r ResolvedItem) error {
+		n++
+		if r.File != nil {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 3, n)
+
+	e := NewEvidence("BAD809B1-7032-43D9-8F94-BF128E5D061D")
+	_ = e.AddFile(File{FileSystemItem: FileSystemItem{Root: "/", Location: "usr/bin", FsName: "ls"}})
+
+	err = e.Walk(func(r ResolvedItem) error {
+		assert.Equal(t, "/", r.Root)
+		assert.Equal(t, "usr/bin/ls", r.Path)
+		return nil
+	})
+	assert.Nil(t, err)
+}
+
+func TestNewPathElementsFromPaths(t *testing.T) {
+	size := int64(42)
+
+	entries := []PathEntry{
+		{Path: "/usr/share/doc/rrdetector/copyright"},
+		{Path: "/usr/share/doc/rrdetector/README", File: File{Size: &size}},
+		{Path: "/usr/bin/rrdetector"},
+		{Path: "/etc/rrdetector.conf"},
+		{Path: "/LICENSE"},
+		{Path: "rrdetector-4.1.5.dist-info/RECORD"},
+		{Path: "setup.cfg"},
+	}
+
+	pe, err := NewPathElementsFromPaths(entries)
+	require.Nil(t, err)
+
+	dirs := *pe.Directories
+	require.Len(t, dirs, 3)
+
+	assert.Equal(t, FileSystemItem{FsName: "rrdetector-4.1.5.dist-info"}, dirs[0].FileSystemItem)
+	assert.Equal(t, FileSystemItem{Root: "/", FsName: "etc"}, dirs[1].FileSystemItem)
+	assert.Equal(t, FileSystemItem{Root: "/", FsName: "usr"}, dirs[2].FileSystemItem)
+
+	usr := *dirs[2].Directories
+	require.Len(t, usr, 2)
+	assert.Equal(t, FileSystemItem{FsName: "bin"}, usr[0].FileSystemItem)
+	// collapsed chain
+	assert.Equal(t, FileSystemItem{Location: "share/doc", FsName: "rrdetector"}, usr[1].FileSystemItem)
+	assert.Equal(t, "README", (*usr[1].Files)[0].FsName)
+	assert.Equal(t, &size, (*usr[1].Files)[0].Size)
+
+	files := *pe.Files
+	require.Len(t, files, 2)
+	assert.Equal(t, FileSystemItem{FsName: "setup.cfg"}, files[0].FileSystemItem)
+	assert.Equal(t, FileSystemItem{Root: "/", FsName: "LICENSE"}, files[1].FileSystemItem)
+
+	// resolving the tree gives back the original paths
+	rc := ResourceCollection{PathElements: *pe}
+
+	var paths []string
+
+	_ = rc.Walk(func(r ResolvedItem) error {
+		if !r.IsDir() {
+			paths = append(paths, r.FullPath())
+		}
+		return nil
+	})
+
+	var expected []string
+	for _, e := range entries {
+		expected = append(expected, e.Path)
+	}
+
+	assert.ElementsMatch(t, expected, paths)
+}
+
+func TestNewPathElementsFromPaths_ko(t *testing.T) {
+	for _, tv := range []struct {
+		In          []PathEntry
+		ExpectedErr string
+	}{
+		{
+			In:          []PathEntry{{Path: ""}},
+			ExpectedErr: `invalid file path ""`,
+		},
+		{
+			In:          []PathEntry{{Path: "/usr/bin/"}},
+			ExpectedErr: `invalid file path "/usr/bin/"`,
+		},
+		{
+			In:          []PathEntry{{Path: "/.."}},
+			ExpectedErr: `invalid file path "/.."`,
+		},
+		{
+			In:          []PathEntry{{Path: "a/.."}},
+			ExpectedErr: `invalid file path "a/.."`,
+		},
+		{
+			In:          []PathEntry{{Path: "../evil"}},
+			ExpectedErr: `invalid file path "../evil"`,
+		},
+		{
+			In:          []PathEntry{{Path: "a/../../b"}},
+			ExpectedErr: `invalid file path "a/../../b"`,
+		},
+		{
+			In:          []PathEntry{{Path: "/usr/bin/ls"}, {Path: "/usr//bin/ls"}},
+			ExpectedErr: "/usr//bin/ls: duplicate file",
+		},
+		{
+			In:          []PathEntry{{Path: "/usr/bin/ls"}, {Path: "/usr/bin"}},
+			ExpectedErr: "/usr/bin: file clashes with directory",
+		},
+		{
+			In:          []PathEntry{{Path: "/usr/bin"}, {Path: "/usr/bin/ls"}},
+			ExpectedErr: "/usr/bin/ls: directory clashes with file",
+		},
+	} {
+		_, err := NewPathElementsFromPaths(tv.In)
+		assert.EqualError(t, err, tv.ExpectedErr)
+	}
+}